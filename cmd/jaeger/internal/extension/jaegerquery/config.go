@@ -22,6 +22,13 @@ type Config struct {
 	TraceStorageArchive     string `valid:"optional" mapstructure:"trace_storage_archive"`
 	confighttp.ServerConfig `mapstructure:",squash"`
 	Tenancy                 tenancy.Options `mapstructure:"multi_tenancy"`
+	GRPC                    GRPCConfig      `mapstructure:"grpc"`
+}
+
+// GRPCConfig configures the gRPC server of the query service.
+type GRPCConfig struct {
+	// Endpoint is the host:port the gRPC server listens on, defaults to ports.QueryGRPC.
+	Endpoint string `mapstructure:"endpoint"`
 }
 
 func (cfg *Config) Validate() error {
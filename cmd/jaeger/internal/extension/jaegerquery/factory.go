@@ -28,6 +28,9 @@ func createDefaultConfig() component.Config {
 		ServerConfig: confighttp.ServerConfig{
 			Endpoint: ports.PortToHostPort(ports.QueryHTTP),
 		},
+		GRPC: GRPCConfig{
+			Endpoint: ports.PortToHostPort(ports.QueryGRPC),
+		},
 	}
 }
 
@@ -119,12 +119,16 @@ func (s *server) addArchiveStorage(opts *querysvc.QueryServiceOptions, host comp
 }
 
 func (s *server) makeQueryOptions() *queryApp.QueryOptions {
+	grpcHostPort := s.config.GRPC.Endpoint
+	if grpcHostPort == "" {
+		grpcHostPort = ports.PortToHostPort(ports.QueryGRPC)
+	}
 	return &queryApp.QueryOptions{
 		QueryOptionsBase: s.config.QueryOptionsBase,
 
 		// TODO expose via config
 		HTTPHostPort: ports.PortToHostPort(ports.QueryHTTP),
-		GRPCHostPort: ports.PortToHostPort(ports.QueryGRPC),
+		GRPCHostPort: grpcHostPort,
 	}
 }
 
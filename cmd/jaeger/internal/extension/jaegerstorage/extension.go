@@ -8,6 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
+	"sync"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/extension"
@@ -38,38 +41,170 @@ type storageExt struct {
 	config    *Config
 	logger    *zap.Logger
 	factories map[string]storage.Factory
+
+	registeredMu sync.RWMutex
+	// registered holds the factories added with RegisterStorageFactory, which the extension does not own.
+	registered map[string]storage.Factory
+
+	// newESPurger and newOSPurger create the storage.Purger of the Elasticsearch and
+	// OpenSearch factories respectively.
+	newESPurger func(*es.Factory) storage.Purger
+	newOSPurger func(*es.Factory) storage.Purger
+}
+
+// StorageNotFoundError is returned by GetStorageFactory when no storage
+// with the requested name is declared in the extension.
+type StorageNotFoundError struct {
+	// Name is the requested storage name.
+	Name string
+	// Available lists the names of the declared storages, when known.
+	Available []string
+}
+
+func (e *StorageNotFoundError) Error() string {
+	msg := fmt.Sprintf("cannot find storage '%s' declared with '%s' extension", e.Name, componentType)
+	if len(e.Available) > 0 {
+		msg += fmt.Sprintf(" (available storages: %s)", strings.Join(e.Available, ", "))
+	}
+	return msg
 }
 
 // GetStorageFactory locates the extension in Host and retrieves a storage factory from it with the given name.
 func GetStorageFactory(name string, host component.Host) (storage.Factory, error) {
-	var comp component.Component
-	for id, ext := range host.GetExtensions() {
-		if id.Type() == componentType {
-			comp = ext
-			break
-		}
-	}
-	if comp == nil {
-		return nil, fmt.Errorf(
-			"cannot find extension '%s' (make sure it's defined earlier in the config)",
-			componentType,
-		)
+	comp, err := findExtension(host)
+	if err != nil {
+		return nil, err
 	}
 	f, ok := comp.(Extension).Factory(name)
 	if !ok {
-		return nil, fmt.Errorf(
-			"cannot find storage '%s' declared with '%s' extension",
-			name, componentType,
-		)
+		notFound := &StorageNotFoundError{Name: name}
+		if lister, ok := comp.(storageLister); ok {
+			notFound.Available = lister.StorageNames()
+		}
+		return nil, notFound
 	}
 	return f, nil
 }
 
+// ListStorageFactories returns the sorted names of all storage factories
+// registered with the jaeger_storage extension.
+func ListStorageFactories(host component.Host) ([]string, error) {
+	comp, err := findExtension(host)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := comp.(storageLister)
+	if !ok {
+		return nil, fmt.Errorf("extension '%s' does not support listing storages", componentType)
+	}
+	return lister.StorageNames(), nil
+}
+
+type storageLister interface {
+	StorageNames() []string
+}
+
+// RegisterStorageFactory adds a storage factory under the given name to the jaeger_storage
+// extension of the host, next to the configured ones, so that components resolving storages
+// with GetStorageFactory, such as storage_cleaner, find it. It allows integration tests to
+// exercise a custom backend without registering it as a storage kind of the extension.
+// The returned function removes the factory, it is typically called at the end of the test.
+// The factory is neither initialized nor closed by the extension.
+func RegisterStorageFactory(host component.Host, name string, factory storage.Factory) (unregister func(), err error) {
+	comp, err := findExtension(host)
+	if err != nil {
+		return nil, err
+	}
+	ext, ok := comp.(*storageExt)
+	if !ok {
+		return nil, fmt.Errorf("extension '%s' does not support registering storages", componentType)
+	}
+	return ext.register(name, factory)
+}
+
+func findExtension(host component.Host) (component.Component, error) {
+	for id, ext := range host.GetExtensions() {
+		if id.Type() == componentType {
+			return ext, nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"cannot find extension '%s' (make sure it's defined earlier in the config)",
+		componentType,
+	)
+}
+
+// Capabilities describes which optional interfaces a storage factory supports.
+type Capabilities struct {
+	// Purger is true if the factory implements storage.Purger (or its legacy version).
+	Purger bool
+	// RangePurger is true if the factory implements storage.RangePurger.
+	RangePurger bool
+	// ServicePurger is true if the factory implements storage.ServicePurger.
+	ServicePurger bool
+	// ServiceRangePurger is true if the factory implements storage.ServiceRangePurger.
+	ServiceRangePurger bool
+	// TracePurger is true if the factory implements storage.TracePurger.
+	TracePurger bool
+	// PatternPurger is true if the factory implements storage.PatternPurger.
+	PatternPurger bool
+	// AttributePurger is true if the factory implements storage.AttributePurger.
+	AttributePurger bool
+	// BatchPurger is true if the factory implements storage.BatchPurger.
+	BatchPurger bool
+	// ExpiredPurger is true if the factory implements storage.ExpiredPurger.
+	ExpiredPurger bool
+	// TenantPurger is true if the factory implements storage.TenantPurger.
+	TenantPurger bool
+	// DependencyPurger is true if the factory implements storage.DependencyPurger.
+	DependencyPurger bool
+	// Counter is true if the factory implements storage.Counter.
+	Counter bool
+	// ArchiveStorage is true if the factory implements storage.ArchiveFactory.
+	ArchiveStorage bool
+	// SamplingStore is true if the factory implements storage.SamplingStoreFactory.
+	SamplingStore bool
+}
+
+// GetStorageCapabilities locates the storage factory with the given name, like GetStorageFactory,
+// and reports which optional interfaces it supports.
+func GetStorageCapabilities(name string, host component.Host) (Capabilities, error) {
+	f, err := GetStorageFactory(name, host)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return FactoryCapabilities(f), nil
+}
+
+// FactoryCapabilities reports which optional interfaces the factory supports. It only
+// inspects the type of the factory and never calls it.
+func FactoryCapabilities(f storage.Factory) Capabilities {
+	var capabilities Capabilities
+	_, capabilities.Purger = storage.GetPurger(f)
+	_, capabilities.RangePurger = f.(storage.RangePurger)
+	_, capabilities.ServicePurger = f.(storage.ServicePurger)
+	_, capabilities.ServiceRangePurger = f.(storage.ServiceRangePurger)
+	_, capabilities.TracePurger = f.(storage.TracePurger)
+	_, capabilities.PatternPurger = f.(storage.PatternPurger)
+	_, capabilities.AttributePurger = f.(storage.AttributePurger)
+	_, capabilities.BatchPurger = f.(storage.BatchPurger)
+	_, capabilities.ExpiredPurger = f.(storage.ExpiredPurger)
+	_, capabilities.TenantPurger = f.(storage.TenantPurger)
+	_, capabilities.DependencyPurger = f.(storage.DependencyPurger)
+	_, capabilities.Counter = f.(storage.Counter)
+	_, capabilities.ArchiveStorage = f.(storage.ArchiveFactory)
+	_, capabilities.SamplingStore = f.(storage.SamplingStoreFactory)
+	return capabilities
+}
+
 func newStorageExt(config *Config, otel component.TelemetrySettings) *storageExt {
 	return &storageExt{
 		config:    config,
 		logger:    otel.Logger,
 		factories: make(map[string]storage.Factory),
+		// both backends support the same delete-by-query
+		newESPurger: es.NewPurger,
+		newOSPurger: es.NewPurger,
 	}
 }
 
@@ -80,6 +215,23 @@ type starter[Config any, Factory storage.Factory] struct {
 	builder     func(Config, metrics.Factory, *zap.Logger) (Factory, error)
 }
 
+// esFactory is an Elasticsearch or OpenSearch factory along with the storage.Purger
+// of its backend, so that consumers such as storage_cleaner need not know which it is.
+type esFactory struct {
+	*es.Factory
+	storage.Purger
+}
+
+func newESFactoryBuilder(newPurger func(*es.Factory) storage.Purger) func(esCfg.Configuration, metrics.Factory, *zap.Logger) (*esFactory, error) {
+	return func(cfg esCfg.Configuration, metricsFactory metrics.Factory, logger *zap.Logger) (*esFactory, error) {
+		f, err := es.NewFactoryWithConfig(cfg, metricsFactory, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &esFactory{Factory: f, Purger: newPurger(f)}, nil
+	}
+}
+
 func (s *starter[Config, Factory]) build(ctx context.Context, host component.Host) error {
 	for name, cfg := range s.cfg {
 		if _, ok := s.ext.factories[name]; ok {
@@ -124,17 +276,17 @@ func (s *storageExt) Start(ctx context.Context, host component.Host) error {
 		cfg:         s.config.GRPC,
 		builder:     grpc.NewFactoryWithConfig,
 	}
-	esStarter := &starter[esCfg.Configuration, *es.Factory]{
+	esStarter := &starter[esCfg.Configuration, *esFactory]{
 		ext:         s,
 		storageKind: "elasticsearch",
 		cfg:         s.config.Elasticsearch,
-		builder:     es.NewFactoryWithConfig,
+		builder:     newESFactoryBuilder(s.newESPurger),
 	}
-	osStarter := &starter[esCfg.Configuration, *es.Factory]{
+	osStarter := &starter[esCfg.Configuration, *esFactory]{
 		ext:         s,
 		storageKind: "opensearch",
 		cfg:         s.config.Opensearch,
-		builder:     es.NewFactoryWithConfig,
+		builder:     newESFactoryBuilder(s.newOSPurger),
 	}
 	cassandraStarter := &starter[cassandraCfg.Configuration, *cassandra.Factory]{
 		ext:         s,
@@ -174,6 +326,47 @@ func (s *storageExt) Shutdown(ctx context.Context) error {
 }
 
 func (s *storageExt) Factory(name string) (storage.Factory, bool) {
-	f, ok := s.factories[name]
+	if f, ok := s.factories[name]; ok {
+		return f, ok
+	}
+	s.registeredMu.RLock()
+	defer s.registeredMu.RUnlock()
+	f, ok := s.registered[name]
 	return f, ok
 }
+
+// StorageNames returns the sorted names of the declared and registered storages.
+func (s *storageExt) StorageNames() []string {
+	s.registeredMu.RLock()
+	defer s.registeredMu.RUnlock()
+	names := make([]string, 0, len(s.factories)+len(s.registered))
+	for name := range s.factories {
+		names = append(names, name)
+	}
+	for name := range s.registered {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *storageExt) register(name string, factory storage.Factory) (func(), error) {
+	if factory == nil {
+		return nil, fmt.Errorf("cannot register storage '%s': factory is nil", name)
+	}
+	s.registeredMu.Lock()
+	defer s.registeredMu.Unlock()
+	_, declared := s.factories[name]
+	if _, registered := s.registered[name]; declared || registered {
+		return nil, fmt.Errorf("duplicate storage name '%s'", name)
+	}
+	if s.registered == nil {
+		s.registered = make(map[string]storage.Factory)
+	}
+	s.registered[name] = factory
+	return func() {
+		s.registeredMu.Lock()
+		defer s.registeredMu.Unlock()
+		delete(s.registered, name)
+	}, nil
+}
@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
@@ -23,6 +24,7 @@ import (
 	"github.com/jaegertracing/jaeger/pkg/metrics"
 	"github.com/jaegertracing/jaeger/pkg/testutils"
 	badgerCfg "github.com/jaegertracing/jaeger/plugin/storage/badger"
+	"github.com/jaegertracing/jaeger/plugin/storage/es"
 	"github.com/jaegertracing/jaeger/storage"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
@@ -104,6 +106,34 @@ func TestStorageFactoryBadNameError(t *testing.T) {
 	host := storageHost{t: t, storageExtension: startStorageExtension(t, "foo")}
 	_, err := GetStorageFactory("bar", host)
 	require.ErrorContains(t, err, "cannot find storage 'bar'")
+	require.ErrorContains(t, err, "(available storages: foo)")
+	var notFound *StorageNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "bar", notFound.Name)
+	assert.Equal(t, []string{"foo"}, notFound.Available)
+}
+
+func TestStorageNames(t *testing.T) {
+	storageExtension := &storageExt{
+		factories: map[string]storage.Factory{
+			"foo": errorFactory{},
+			"bar": errorFactory{},
+		},
+	}
+	assert.Equal(t, []string{"bar", "foo"}, storageExtension.StorageNames())
+}
+
+func TestListStorageFactories(t *testing.T) {
+	storageExtension := startStorageExtension(t, "memstore")
+	// a fake backend registered next to the configured memory storage
+	storageExtension.(*storageExt).factories["fake"] = errorFactory{}
+	host := storageHost{t: t, storageExtension: storageExtension}
+	names, err := ListStorageFactories(host)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fake", "memstore"}, names)
+
+	_, err = ListStorageFactories(componenttest.NewNopHost())
+	require.ErrorContains(t, err, "cannot find extension")
 }
 
 func TestStorageFactoryBadShutdownError(t *testing.T) {
@@ -125,6 +155,38 @@ func TestStorageExtension(t *testing.T) {
 	require.NotNil(t, f)
 }
 
+func TestGetStorageCapabilities(t *testing.T) {
+	const name = "foo"
+	host := storageHost{t: t, storageExtension: startStorageExtension(t, name)}
+	capabilities, err := GetStorageCapabilities(name, host)
+	require.NoError(t, err)
+	require.Equal(t, Capabilities{
+		Purger:             true,
+		RangePurger:        true,
+		ServicePurger:      true,
+		ServiceRangePurger: true,
+		TracePurger:        true,
+		AttributePurger:    true,
+		TenantPurger:       true,
+		Counter:            true,
+		ArchiveStorage:     true,
+		SamplingStore:      true,
+	}, capabilities)
+
+	host = storageHost{t: t, storageExtension: &storageExt{
+		factories: map[string]storage.Factory{
+			// errorFactory panics when called, so the capabilities must come from its type alone
+			name: errorFactory{},
+		},
+	}}
+	capabilities, err = GetStorageCapabilities(name, host)
+	require.NoError(t, err)
+	require.Equal(t, Capabilities{}, capabilities)
+
+	_, err = GetStorageCapabilities("bar", host)
+	require.ErrorContains(t, err, "cannot find storage 'bar'")
+}
+
 func TestBadgerStorageExtension(t *testing.T) {
 	storageExtension := makeStorageExtenion(t, &Config{
 		Badger: map[string]badgerCfg.NamespaceConfig{
@@ -181,6 +243,55 @@ func TestESStorageExtension(t *testing.T) {
 	require.NoError(t, storageExtension.Shutdown(ctx))
 }
 
+// fakePurger counts its purges.
+type fakePurger struct {
+	purges int
+}
+
+func (p *fakePurger) Purge(context.Context) error {
+	p.purges++
+	return nil
+}
+
+func TestOpenSearchPurger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":{"Number":"2"},"TagLine":"The OpenSearch Project: https://opensearch.org/"}`))
+	}))
+	defer server.Close()
+	cfg := esCfg.Configuration{Servers: []string{server.URL}, LogLevel: "error"}
+	storageExtension := makeStorageExtenion(t, &Config{
+		Opensearch:    map[string]esCfg.Configuration{"os": cfg},
+		Elasticsearch: map[string]esCfg.Configuration{"es": cfg},
+	})
+	osPurger, esPurger := &fakePurger{}, &fakePurger{}
+	ext := storageExtension.(*storageExt)
+	ext.newESPurger = func(*es.Factory) storage.Purger { return esPurger }
+	ext.newOSPurger = func(*es.Factory) storage.Purger { return osPurger }
+	ctx := context.Background()
+	require.NoError(t, storageExtension.Start(ctx, componenttest.NewNopHost()))
+	defer func() {
+		require.NoError(t, storageExtension.Shutdown(ctx))
+	}()
+	host := storageHost{t: t, storageExtension: storageExtension}
+
+	f, err := GetStorageFactory("os", host)
+	require.NoError(t, err)
+	purger, ok := f.(storage.Purger)
+	require.True(t, ok)
+	require.NoError(t, purger.Purge(ctx))
+	assert.Equal(t, 1, osPurger.purges)
+	assert.Zero(t, esPurger.purges)
+	// the other optional interfaces of the factory are kept
+	_, ok = f.(storage.ArchiveFactory)
+	assert.True(t, ok)
+
+	f, err = GetStorageFactory("es", host)
+	require.NoError(t, err)
+	require.NoError(t, f.(storage.Purger).Purge(ctx))
+	assert.Equal(t, 1, osPurger.purges)
+	assert.Equal(t, 1, esPurger.purges)
+}
+
 func TestESStorageExtensionError(t *testing.T) {
 	defer testutils.VerifyGoLeaksOnce(t)
 
@@ -236,3 +347,31 @@ func startStorageExtension(t *testing.T, memstoreName string) component.Componen
 	})
 	return storageExtension
 }
+
+func TestRegisterStorageFactory(t *testing.T) {
+	storageExtension := startStorageExtension(t, "memstore")
+	host := storageHost{t: t, storageExtension: storageExtension}
+
+	custom := errorFactory{closeErr: fmt.Errorf("not closed by the extension")}
+	unregister, err := RegisterStorageFactory(host, "custom", custom)
+	require.NoError(t, err)
+	f, err := GetStorageFactory("custom", host)
+	require.NoError(t, err)
+	assert.Equal(t, custom, f)
+	names, err := ListStorageFactories(host)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"custom", "memstore"}, names)
+
+	_, err = RegisterStorageFactory(host, "custom", custom)
+	require.ErrorContains(t, err, "duplicate storage name 'custom'")
+	_, err = RegisterStorageFactory(host, "memstore", custom)
+	require.ErrorContains(t, err, "duplicate storage name 'memstore'")
+	_, err = RegisterStorageFactory(host, "nil", nil)
+	require.ErrorContains(t, err, "factory is nil")
+	_, err = RegisterStorageFactory(componenttest.NewNopHost(), "custom", custom)
+	require.ErrorContains(t, err, "cannot find extension")
+
+	unregister()
+	_, err = GetStorageFactory("custom", host)
+	require.ErrorContains(t, err, "cannot find storage 'custom'")
+}
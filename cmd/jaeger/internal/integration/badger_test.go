@@ -4,28 +4,24 @@
 package integration
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/integration/storagecleaner"
+	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/plugin/storage/integration"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
-func cleanUp(t *testing.T) {
-	Addr := fmt.Sprintf("http://0.0.0.0:%s%s", storagecleaner.Port, storagecleaner.URL)
-	r, err := http.NewRequest(http.MethodPost, Addr, nil)
-	require.NoError(t, err)
-
-	client := &http.Client{}
-
-	resp, err := client.Do(r)
-	require.NoError(t, err)
-	defer resp.Body.Close()
-
-	require.Equal(t, http.StatusOK, resp.StatusCode)
+// cleanUp purges the storage through the storage_cleaner of the generated config.
+func (s *E2EStorageIntegration) cleanUp(t *testing.T) {
+	require.NoError(t, s.storageCleaner().Purge(context.Background()))
 }
 
 func TestBadgerStorage(t *testing.T) {
@@ -34,18 +30,221 @@ func TestBadgerStorage(t *testing.T) {
 	s := &E2EStorageIntegration{
 		ConfigFile: "../../badger_config.yaml",
 		StorageIntegration: integration.StorageIntegration{
-			SkipBinaryAttrs: true,
-			SkipArchiveTest: true,
-			CleanUp:         cleanUp,
+			SkipBinaryAttrs:       true,
+			SkipArchiveTest:       true,
+			DependenciesFromSpans: true,
+
+			// Every span goes through a full OTLP round trip to the collector,
+			// so fewer services are written than with direct storage.
+			ManyServicesCount: 200,
 
 			// TODO: remove this once badger supports returning spanKind from GetOperations
 			// Cf https://github.com/jaegertracing/jaeger/issues/1922
 			GetOperationsMissingSpanKind: true,
 		},
 	}
+	s.CleanUp = s.cleanUp
 	s.e2eInitialize(t)
 	t.Cleanup(func() {
 		s.e2eCleanUp(t)
 	})
 	s.RunAll(t)
 }
+
+// TestBadgerStorageOTLPHTTP writes spans through the OTLP/HTTP receiver
+// and reads them back through the query service.
+func TestBadgerStorageOTLPHTTP(t *testing.T) {
+	integration.SkipUnlessEnv(t, "badger")
+
+	s := &E2EStorageIntegration{
+		ConfigFile:  "../../badger_config.yaml",
+		UseOTLPHTTP: true,
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.CleanUp = s.cleanUp
+	s.e2eInitialize(t)
+	t.Cleanup(func() {
+		s.e2eCleanUp(t)
+	})
+	s.CleanUp(t)
+
+	span := &model.Span{
+		TraceID:       model.NewTraceID(0, 4318),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "otlp_http",
+		StartTime:     time.Now().Add(-time.Minute).Truncate(time.Microsecond),
+		Duration:      time.Millisecond,
+		Process:       model.NewProcess("otlp_http_service", model.KeyValues{}),
+	}
+	require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), span))
+	trace := s.WaitForSpan(t, span.TraceID, 30*time.Second)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, "otlp_http", trace.Spans[0].OperationName)
+	assert.Equal(t, "otlp_http_service", trace.Spans[0].Process.ServiceName)
+}
+
+// TestBadgerStorageBatchedWrites writes 10k spans through the batching SpanWriter
+// and reads them back through the query service.
+func TestBadgerStorageBatchedWrites(t *testing.T) {
+	integration.SkipUnlessEnv(t, "badger")
+
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		BatchSize:  1000,
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.CleanUp = s.cleanUp
+	s.e2eInitialize(t)
+	t.Cleanup(func() {
+		s.e2eCleanUp(t)
+	})
+	s.CleanUp(t)
+
+	const traces, spansPerTrace = 100, 100
+	startTime := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+	for i := 0; i < traces; i++ {
+		for j := 0; j < spansPerTrace; j++ {
+			span := &model.Span{
+				TraceID:       model.NewTraceID(0, uint64(i+1)),
+				SpanID:        model.NewSpanID(uint64(j + 1)),
+				OperationName: fmt.Sprintf("operation_%d", j),
+				StartTime:     startTime,
+				Duration:      time.Millisecond,
+				Process:       model.NewProcess("batched_service", model.KeyValues{}),
+			}
+			require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), span))
+		}
+	}
+	s.FlushWriter(t)
+
+	for i := 0; i < traces; i++ {
+		traceID := model.NewTraceID(0, uint64(i+1))
+		require.Eventually(t, func() bool {
+			trace, err := s.SpanReader.GetTrace(context.Background(), traceID)
+			return err == nil && len(trace.Spans) == spansPerTrace
+		}, 30*time.Second, 100*time.Millisecond, "trace %s is incomplete", traceID)
+	}
+	found, err := s.SpanReader.FindTraces(context.Background(), &spanstore.TraceQueryParameters{
+		ServiceName:  "batched_service",
+		StartTimeMin: startTime.Add(-time.Minute),
+		StartTimeMax: startTime.Add(time.Minute),
+		NumTraces:    1000,
+	})
+	require.NoError(t, err)
+	assert.Len(t, found, traces)
+	assert.EqualValues(t, traces, s.CountTraces(t))
+	assert.EqualValues(t, traces*spansPerTrace, s.CountSpans(t))
+	// one request per batch
+	stats := s.WriteLatencyStats()
+	assert.Equal(t, traces*spansPerTrace/s.BatchSize, stats.Count)
+	assert.LessOrEqual(t, stats.P50, stats.P99)
+}
+
+// TestBadgerStorageFixture replays an OTLP fixture and reads it back through the query service.
+func TestBadgerStorageFixture(t *testing.T) {
+	integration.SkipUnlessEnv(t, "badger")
+
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.CleanUp = s.cleanUp
+	s.e2eInitialize(t)
+	t.Cleanup(func() {
+		s.e2eCleanUp(t)
+	})
+	s.CleanUp(t)
+
+	spans := s.WriteFixture(t, "testdata/otlp_trace.json")
+	trace := s.WaitForSpan(t, spans[0].TraceID, 30*time.Second)
+	require.Eventually(t, func() bool {
+		trace, _ = s.SpanReader.GetTrace(context.Background(), spans[0].TraceID)
+		return trace != nil && len(trace.Spans) == len(spans)
+	}, 30*time.Second, 100*time.Millisecond)
+	for _, span := range trace.Spans {
+		assert.Equal(t, "fixture-frontend", span.Process.ServiceName)
+		assert.WithinDuration(t, time.Now(), span.StartTime, time.Minute)
+	}
+}
+
+// TestBadgerStorageFlushCollector reads a span right after FlushCollector, without polling.
+func TestBadgerStorageFlushCollector(t *testing.T) {
+	integration.SkipUnlessEnv(t, "badger")
+
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.CleanUp = s.cleanUp
+	s.e2eInitialize(t)
+	t.Cleanup(func() {
+		s.e2eCleanUp(t)
+	})
+	s.CleanUp(t)
+
+	span := &model.Span{
+		TraceID:       model.NewTraceID(0, 4242),
+		SpanID:        model.NewSpanID(1),
+		OperationName: "flushed",
+		StartTime:     time.Now().Add(-time.Minute).Truncate(time.Microsecond),
+		Duration:      time.Millisecond,
+		Process:       model.NewProcess("flush_service", model.KeyValues{}),
+	}
+	require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), span))
+	s.FlushCollector(t)
+	trace, err := s.SpanReader.GetTrace(context.Background(), span.TraceID)
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, "flushed", trace.Spans[0].OperationName)
+}
+
+func TestBadgerStorageCleanerConfig(t *testing.T) {
+	integration.SkipUnlessEnv(t, "badger")
+
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.CleanUp = s.cleanUp
+	s.e2eInitialize(t)
+	t.Cleanup(func() {
+		s.e2eCleanUp(t)
+	})
+
+	config := s.StorageCleanerConfig(t)
+	assert.Equal(t, "badger_main", config.TraceStorage)
+	assert.Equal(t, storagecleaner.ConcurrencySerialize, config.Concurrency)
+}
+
+// TestBadgerCollectorLogs checks the startup lines of the collector.
+func TestBadgerCollectorLogs(t *testing.T) {
+	integration.SkipUnlessEnv(t, "badger")
+
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.CleanUp = s.cleanUp
+	s.e2eInitialize(t)
+	t.Cleanup(func() {
+		s.e2eCleanUp(t)
+	})
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(s.CollectorLogs(), "Everything is ready")
+	}, 10*time.Second, 100*time.Millisecond)
+	s.AssertCollectorLogContains(t, "Starting jaeger...")
+	s.AssertCollectorLogNotContains(t, "\terror\t")
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	jaeger2otlp "github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/jaeger"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// WriteFixture writes the spans of a fixture file through the SpanWriter, e.g. to reproduce
+// traces captured from a real system. The file holds either OTLP JSON, as exported by the
+// OpenTelemetry SDKs and the collector's file exporter, or a Jaeger trace in JSON, as in
+// the fixtures of StorageIntegration. The timestamps of the spans are shifted so that the
+// last span ends now, which keeps them within the lookback of the queries.
+// It returns the spans as written, for the assertions of the test.
+func (s *E2EStorageIntegration) WriteFixture(t *testing.T, path string) []*model.Span {
+	spans, err := loadFixture(path, time.Now())
+	require.NoError(t, err)
+	for _, span := range spans {
+		require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), span), "cannot write span %s of fixture %s", span.SpanID, path)
+	}
+	s.FlushWriter(t)
+	return spans
+}
+
+// loadFixture reads the spans of the fixture file at path, shifted so that the last one ends at now.
+func loadFixture(path string, now time.Time) ([]*model.Span, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read fixture: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("cannot parse fixture %s: %w", path, err)
+	}
+	var spans []*model.Span
+	if _, ok := fields["resourceSpans"]; ok {
+		spans, err = otlpFixtureSpans(data)
+	} else {
+		spans, err = jaegerFixtureSpans(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse fixture %s: %w", path, err)
+	}
+	if len(spans) == 0 {
+		return nil, fmt.Errorf("fixture %s has no spans", path)
+	}
+	shiftSpans(spans, now)
+	return spans, nil
+}
+
+func otlpFixtureSpans(data []byte) ([]*model.Span, error) {
+	traces, err := new(ptrace.JSONUnmarshaler).UnmarshalTraces(data)
+	if err != nil {
+		return nil, err
+	}
+	// ProtoFromTraces does not return errors
+	batches, _ := jaeger2otlp.ProtoFromTraces(traces)
+	var spans []*model.Span
+	for _, batch := range batches {
+		for _, span := range batch.Spans {
+			if span.Process == nil {
+				span.Process = batch.Process
+			}
+			spans = append(spans, span)
+		}
+	}
+	return spans, nil
+}
+
+func jaegerFixtureSpans(data []byte) ([]*model.Span, error) {
+	var trace model.Trace
+	if err := jsonpb.Unmarshal(bytes.NewReader(data), &trace); err != nil {
+		return nil, err
+	}
+	return trace.Spans, nil
+}
+
+// shiftSpans moves the timestamps of the spans and their logs by the same offset,
+// so that the span ending last ends at now, truncated to the precision of storages.
+func shiftSpans(spans []*model.Span, now time.Time) {
+	var end time.Time
+	for _, span := range spans {
+		if spanEnd := span.StartTime.Add(span.Duration); spanEnd.After(end) {
+			end = spanEnd
+		}
+	}
+	offset := now.Truncate(time.Microsecond).Sub(end)
+	for _, span := range spans {
+		span.StartTime = span.StartTime.Add(offset)
+		for i := range span.Logs {
+			span.Logs[i].Timestamp = span.Logs[i].Timestamp.Add(offset)
+		}
+	}
+}
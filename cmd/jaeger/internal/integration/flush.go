@@ -0,0 +1,112 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultBatchTimeout is the timeout of the batch processor when its config does not set one,
+	// after which it sends the spans it holds even if the batch is not full.
+	defaultBatchTimeout = 200 * time.Millisecond
+	// maxFlushWait bounds the wait of FlushCollector for the batch processors to time out.
+	maxFlushWait = 10 * time.Second
+	// flushGrace leaves the spans sent by the batch processors time to be written to storage.
+	flushGrace = 100 * time.Millisecond
+	// flushRequestTimeout bounds the request to FlushURL.
+	flushRequestTimeout = 30 * time.Second
+)
+
+// batchProcessorConfig is the part of the config of a batch processor FlushCollector depends on.
+type batchProcessorConfig struct {
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// batchTimeout returns the longest timeout of the batch processors in config,
+// e.g. "batch" or "batch/traces", and zero when there are none.
+func batchTimeout(config map[string]interface{}) (time.Duration, error) {
+	var processors map[string]interface{}
+	if err := decodeConfig(config, "processors", &processors); err != nil {
+		return 0, fmt.Errorf("invalid processors in config: %w", err)
+	}
+	var timeout time.Duration
+	for name := range processors {
+		if name != "batch" && !strings.HasPrefix(name, "batch/") {
+			continue
+		}
+		processor := batchProcessorConfig{Timeout: defaultBatchTimeout}
+		if err := decodeConfig(config, "processors::"+name, &processor); err != nil {
+			return 0, fmt.Errorf("invalid processors.%s in config: %w", name, err)
+		}
+		timeout = max(timeout, processor.Timeout)
+	}
+	return timeout, nil
+}
+
+// FlushCollector makes sure that the spans written so far are persisted before they are read,
+// which the batch processors of the collector may otherwise delay. It sends the spans buffered
+// by the SpanWriter, then asks the collector to flush its batches with a POST request to FlushURL.
+// Without FlushURL, or when the collector does not serve it, it waits for the batch processors
+// to time out instead, bounded by maxFlushWait.
+func (s *E2EStorageIntegration) FlushCollector(t *testing.T) {
+	s.FlushWriter(t)
+	require.NoError(t, s.flushCollector(context.Background()))
+}
+
+func (s *E2EStorageIntegration) flushCollector(ctx context.Context) error {
+	if s.FlushURL != "" {
+		flushed, err := s.requestFlush(ctx)
+		if err != nil || flushed {
+			return err
+		}
+	}
+	wait := s.batchTimeout
+	if s.configFile == "" {
+		// the config of a collector started outside of the test is unknown
+		wait = defaultBatchTimeout
+	}
+	if wait == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(min(wait, maxFlushWait) + flushGrace):
+		return nil
+	}
+}
+
+// requestFlush posts to FlushURL, it returns false when the collector does not serve it.
+func (s *E2EStorageIntegration) requestFlush(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, flushRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.FlushURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("cannot create flush request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("cannot flush the collector: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		if s.logger != nil {
+			s.logger.Warn("Flush endpoint not found, waiting for the batch processors instead", zap.String("url", s.FlushURL))
+		}
+		return false, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return false, fmt.Errorf("cannot flush the collector: %s responded %s", s.FlushURL, resp.Status)
+	}
+	return true, nil
+}
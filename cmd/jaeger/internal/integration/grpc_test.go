@@ -35,6 +35,7 @@ func TestGRPCStorage(t *testing.T) {
 	s := &GRPCStorageIntegration{}
 	s.ConfigFile = "../../grpc_config.yaml"
 	s.SkipBinaryAttrs = true
+	s.SkipArchiveTest = true
 
 	s.initialize(t)
 	s.e2eInitialize(t)
@@ -4,21 +4,64 @@
 package integration
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/confmap"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/integration/storagecleaner"
+	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/pkg/testutils"
 	"github.com/jaegertracing/jaeger/plugin/storage/integration"
 	"github.com/jaegertracing/jaeger/ports"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
-const otlpPort = 4317
+const (
+	defaultStartupTimeout      = 30 * time.Second
+	defaultShutdownGracePeriod = 10 * time.Second
+
+	// purgeVerifyTimeout is how long PurgeAndVerifyEmpty waits for the purged traces
+	// to disappear from the SpanReader.
+	purgeVerifyTimeout = 30 * time.Second
+	// searchLookback is how far back PurgeAndVerifyEmpty and the count helpers search for
+	// traces when DefaultLookback is unset, it covers the fixtures dated two days before
+	// TimeReference.
+	searchLookback = 7 * 24 * time.Hour
+	// countSearchDepth is the maximum number of traces per service found by the count helpers.
+	countSearchDepth = 100_000
+
+	// The collector binary is looked up relative to the root of this project,
+	// which is four levels up from the directory of the e2e tests.
+	defaultBinaryPath = "./cmd/jaeger/jaeger"
+	defaultWorkingDir = "../../../.."
+
+	// raceWarning starts each report of the race detector, which ends with raceSeparator.
+	raceWarning   = "WARNING: DATA RACE"
+	raceSeparator = "=================="
+)
 
 // E2EStorageIntegration holds components for e2e mode of Jaeger-v2
 // storage integration test. The intended usage is as follows:
@@ -33,35 +76,801 @@ const otlpPort = 4317
 type E2EStorageIntegration struct {
 	integration.StorageIntegration
 	ConfigFile string
+
+	// QueryExtension is the name of the jaeger_query extension whose trace storage
+	// is purged by storage_cleaner, e.g. "jaeger_query/tenantA". It can be left
+	// empty when the config contains a single jaeger_query extension.
+	QueryExtension string
+
+	// StartupTimeout is how long to wait for the collector to start accepting
+	// connections, defaults to defaultStartupTimeout. Slow backends may extend it.
+	StartupTimeout time.Duration
+
+	// ShutdownGracePeriod is how long to wait for the collector to exit after
+	// SIGTERM before killing it, defaults to defaultShutdownGracePeriod.
+	ShutdownGracePeriod time.Duration
+
+	// ExtraExtensions lists additional extensions, e.g. "zpages" or "memory_ballast/custom",
+	// enabled in the collector config along with storage_cleaner. Extensions not defined
+	// in the config are added with an empty, i.e. default, configuration.
+	ExtraExtensions []string
+
+	// FeatureGates lists the feature gates the collector is started with, e.g.
+	// "jaeger.es.newCodePath" to enable a gate or "-jaeger.es.newCodePath" to disable it.
+	FeatureGates []string
+
+	// KeepConfig makes the generated collector config outlive the test, for inspection after
+	// a failure. It is written to a path derived from the test name under the temp directory
+	// of the system, which is logged, instead of a directory removed when the test ends.
+	KeepConfig bool
+
+	// PortsFile, when set, is the path of a JSON file the ports picked for the collector
+	// are written to once it is ready, e.g. {"otlp":4317,"query_grpc":16685}, so that
+	// external tools such as load generators can send traffic to it.
+	PortsFile string
+
+	// BinaryPath is the path of the collector binary, defaults to defaultBinaryPath.
+	// A relative path is resolved against WorkingDir.
+	BinaryPath string
+
+	// RaceBuildPath, when set, is the path of a collector binary built with the race
+	// detector, i.e. "go build -race", run instead of BinaryPath. The test fails with
+	// the race reports if the collector output contains any once it is stopped.
+	// A relative path is resolved against WorkingDir.
+	RaceBuildPath string
+
+	// WorkingDir is the directory the collector runs in, defaults to the root of
+	// this project since jaeger_query's ui_config points to "./cmd/jaeger/config-ui.json".
+	// A relative path is resolved against the current directory.
+	WorkingDir string
+
+	// SchemaProbe, when set, reports whether the schema of the backend, e.g. the
+	// Elasticsearch index templates, has been created by the collector. EnsureSchema
+	// waits for it to return nil before the tests begin. It is left unset for backends
+	// creating their schema synchronously at startup, such as memory or badger.
+	SchemaProbe func(ctx context.Context) error
+
+	// UseOTLPHTTP makes the SpanWriter send spans to the collector's OTLP/HTTP receiver,
+	// which many SDKs use, instead of the OTLP gRPC one.
+	UseOTLPHTTP bool
+
+	// BatchSize, when greater than zero, makes the SpanWriter buffer spans and send them
+	// BatchSize at a time, e.g. 1000, so that high-volume tests can write tens of thousands
+	// of spans quickly. FlushWriter must be called before reading the spans back, hence
+	// it is not meant for the tests of the embedded StorageIntegration.
+	BatchSize int
+
+	// BatchFlushInterval, when set with BatchSize, also sends the buffered spans periodically.
+	BatchFlushInterval time.Duration
+
+	// QueryGRPCPort is the port of the query service gRPC endpoint used by the SpanReader,
+	// defaults to a free port, or to ports.QueryGRPC with SkipCollectorStart. It is set as
+	// the grpc endpoint of the jaeger_query extension in the generated config.
+	QueryGRPCPort int
+
+	// SkipCollectorStart makes e2eInitialize attach to a collector started outside of the
+	// test, e.g. under a debugger, instead of spawning one. The collector must listen on
+	// ExistingOTLPPort and ExistingQueryPort, and, since its config is not generated,
+	// the archive tests must be skipped. CollectorPID and RestartCollector are unavailable.
+	SkipCollectorStart bool
+
+	// ExistingOTLPPort is the port of the OTLP receiver of a collector started outside of
+	// the test, gRPC or HTTP depending on UseOTLPHTTP. It is required by SkipCollectorStart.
+	ExistingOTLPPort int
+
+	// ExistingQueryPort is the port of the query service gRPC endpoint of a collector
+	// started outside of the test, defaults to QueryGRPCPort.
+	ExistingQueryPort int
+
+	// DefaultLookback, when set, makes the SpanReader look up traces and search spans
+	// without explicit time range within DefaultLookback before TimeReference, instead
+	// of the default window of the backend, e.g. the max_span_age of Elasticsearch.
+	// Tests writing spans dated days ago extend it so that the spans are found.
+	DefaultLookback time.Duration
+
+	// ReadRetry defines how the SpanReader retries the reads failing with a transient gRPC
+	// error, e.g. Unavailable while the backend warms up or after RestartCollector.
+	// By default, reads failing with Unavailable are retried a few times.
+	ReadRetry ReadRetryPolicy
+
+	// Keepalive, when set, makes the gRPC connections of the SpanWriter and SpanReader ping
+	// the collector when idle, so that proxies or backends with idle timeouts do not drop
+	// them between subtests. Note that grpc-go raises Time to at least 10 seconds, and that
+	// the collector closes connections pinging more often than its enforcement policy allows.
+	Keepalive *configgrpc.KeepaliveClientConfig
+
+	// FlushURL, when set, is an admin endpoint of the collector forcing the spans held by its
+	// processors to be written to storage, which FlushCollector posts to. Without it, or when
+	// the collector responds 404 Not Found, FlushCollector waits for the batch processors to
+	// time out instead.
+	FlushURL string
+
+	// TraceCounter, when set, returns the number of traces and spans in the backend,
+	// e.g. with a count request to Elasticsearch. It is used by CountTraces and CountSpans
+	// instead of searching the traces through the SpanReader.
+	TraceCounter func(ctx context.Context) (traces, spans int64, err error)
+
+	// otlpPort is the free port picked for the collector's OTLP gRPC receiver.
+	otlpPort int
+	// otlpHTTPPort is the free port picked for the collector's OTLP/HTTP receiver
+	// when UseOTLPHTTP is set.
+	otlpHTTPPort int
+	// archiveOTLPPort is the free port picked for the OTLP gRPC receiver
+	// that writes into the archive storage, unless SkipArchiveTest is set.
+	archiveOTLPPort int
+	// collectorLogs captures the stdout and stderr of the collector process.
+	collectorLogs *syncBuffer
+	// writeLatencies records the latencies of the SpanWriter, across collector restarts.
+	writeLatencies *latencyRecorder
+	// configFile is the generated config the collector is started with.
+	configFile string
+	// batchTimeout is the longest timeout of the batch processors in the generated config.
+	batchTimeout time.Duration
+	// collector is the currently running collector process.
+	collector *collectorProcess
+	logger    *zap.Logger
+	// storageCleanerEndpoint is the base URL of storage_cleaner as set in the generated
+	// config, defaults to storagecleaner.DefaultEndpoint.
+	storageCleanerEndpoint string
+	// storageCleanerAuthToken is the auth_token of storage_cleaner in the generated config.
+	storageCleanerAuthToken string
+}
+
+// errProcessExited is returned by waitForPorts when the process
+// that should listen on the ports exits first.
+var errProcessExited = errors.New("process exited")
+
+// collectorProcess is a started collector whose exit is observed in the background,
+// so that waiting for it to become ready can stop as soon as it crashes.
+// exec.Cmd.Wait can only be called once, the process must be stopped through it.
+type collectorProcess struct {
+	cmd *exec.Cmd
+	// exited is closed once cmd.Wait has returned and cmd.ProcessState is set.
+	exited chan struct{}
+}
+
+// startProcess starts the command and waits for it in the background.
+func startProcess(cmd *exec.Cmd) (*collectorProcess, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &collectorProcess{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		// the exit status is read from cmd.ProcessState
+		_ = cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// hasExited reports whether the process has exited.
+func (p *collectorProcess) hasExited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop asks the process to terminate with SIGTERM so that it can flush
+// in-flight data, and kills it if it does not exit within the grace period.
+// It does nothing if the process has already exited.
+func (p *collectorProcess) stop(gracePeriod time.Duration) error {
+	if p.hasExited() {
+		return nil
+	}
+	if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	select {
+	case <-p.exited:
+		return nil
+	case <-time.After(gracePeriod):
+		return p.kill()
+	}
+}
+
+// kill kills the process and waits for it to exit.
+func (p *collectorProcess) kill() error {
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-p.exited
+	return nil
+}
+
+// collectorPorts is the content of PortsFile.
+type collectorPorts struct {
+	OTLP        int `json:"otlp"`
+	OTLPHTTP    int `json:"otlp_http,omitempty"`
+	QueryGRPC   int `json:"query_grpc"`
+	ArchiveOTLP int `json:"archive_otlp,omitempty"`
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
 
 // e2eInitialize starts the Jaeger-v2 collector with the provided config file,
-// it also initialize the SpanWriter and SpanReader below.
+// it also initialize the SpanWriter and SpanReader below. With SkipCollectorStart,
+// it only connects them to the existing collector.
 // This function should be called before any of the tests start.
 func (s *E2EStorageIntegration) e2eInitialize(t *testing.T) {
-	logger, _ := testutils.NewLogger()
-	configFile := createStorageCleanerConfig(t, s.ConfigFile)
-
-	cmd := exec.Cmd{
-		Path: "./cmd/jaeger/jaeger",
-		Args: []string{"jaeger", "--config", configFile},
-		// Change the working directory to the root of this project
-		// since the binary config file jaeger_query's ui_config points to
-		// "./cmd/jaeger/config-ui.json"
-		Dir:    "../../../..",
-		Stdout: os.Stderr,
-		Stderr: os.Stderr,
-	}
-	require.NoError(t, cmd.Start())
-	t.Cleanup(func() {
-		require.NoError(t, cmd.Process.Kill())
+	s.logger, _ = testutils.NewLogger()
+	if s.SkipCollectorStart {
+		require.NotZero(t, s.ExistingOTLPPort, "SkipCollectorStart requires ExistingOTLPPort")
+		require.True(t, s.SkipArchiveTest, "SkipCollectorStart requires SkipArchiveTest")
+		s.otlpPort = s.ExistingOTLPPort
+		if s.UseOTLPHTTP {
+			s.otlpHTTPPort = s.ExistingOTLPPort
+		}
+		if s.ExistingQueryPort != 0 {
+			s.QueryGRPCPort = s.ExistingQueryPort
+		}
+	} else {
+		s.otlpPort = getFreePort(t)
+		if s.UseOTLPHTTP {
+			s.otlpHTTPPort = getFreePort(t)
+		}
+		if !s.SkipArchiveTest {
+			s.archiveOTLPPort = getFreePort(t)
+		}
+		if s.QueryGRPCPort == 0 {
+			s.QueryGRPCPort = getFreePort(t)
+		}
+	}
+	if s.QueryGRPCPort == 0 {
+		s.QueryGRPCPort = ports.QueryGRPC
+	}
+	if s.StartupTimeout == 0 {
+		s.StartupTimeout = defaultStartupTimeout
+	}
+	if s.ShutdownGracePeriod == 0 {
+		s.ShutdownGracePeriod = defaultShutdownGracePeriod
+	}
+	if !s.SkipCollectorStart {
+		s.configFile = s.createStorageCleanerConfig(t)
+		s.collectorLogs = &syncBuffer{}
+
+		t.Cleanup(func() {
+			// RestartCollector may have replaced the process, stop the current one
+			// unless it failed to start. stop is a no-op if it has already exited.
+			if s.collector != nil {
+				require.NoError(t, s.collector.stop(s.ShutdownGracePeriod))
+			}
+			if s.RaceBuildPath != "" {
+				s.assertNoDataRace(t)
+			}
+			if t.Failed() {
+				t.Logf("Collector output:\n%s", s.CollectorLogs())
+			}
+		})
+		s.startCollector(t)
+	}
+	s.connect(t)
+	s.EnsureSchema(t)
+	if s.PortsFile != "" {
+		require.NoError(t, s.writePortsFile())
+	}
+}
+
+// EnsureSchema waits until SchemaProbe reports that the schema of the backend exists,
+// so that tests reading right away do not fail with errors such as "index not found".
+// It fails the test if the schema is not ready within StartupTimeout, and does nothing
+// when SchemaProbe is not set.
+func (s *E2EStorageIntegration) EnsureSchema(t *testing.T) {
+	if s.SchemaProbe == nil {
+		return
+	}
+	require.NoError(t, waitForSchema(s.SchemaProbe, s.StartupTimeout), "backend schema is not ready")
+}
+
+// waitForSchema calls probe with exponential backoff until it succeeds or the timeout elapses.
+func waitForSchema(probe func(ctx context.Context) error, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	backoff := 50 * time.Millisecond
+	for {
+		err := probe(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for schema: %w", err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Second)
+	}
+}
+
+// HTTPSchemaProbe returns a SchemaProbe that succeeds once all the given URLs respond
+// with 200 OK, e.g. "http://localhost:9200/_template/jaeger-span" for Elasticsearch.
+func HTTPSchemaProbe(urls ...string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for _, url := range urls {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("%s responded with %s", url, resp.Status)
+			}
+		}
+		return nil
+	}
+}
+
+// writePortsFile writes the collector ports to PortsFile. The file is replaced
+// atomically so that processes watching it never read a partial write.
+func (s *E2EStorageIntegration) writePortsFile() error {
+	data, err := json.Marshal(collectorPorts{
+		OTLP:        s.otlpPort,
+		OTLPHTTP:    s.otlpHTTPPort,
+		QueryGRPC:   s.QueryGRPCPort,
+		ArchiveOTLP: s.archiveOTLPPort,
 	})
+	if err != nil {
+		return err
+	}
+	tmp := s.PortsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("cannot write ports file: %w", err)
+	}
+	if err := os.Rename(tmp, s.PortsFile); err != nil {
+		return fmt.Errorf("cannot write ports file: %w", err)
+	}
+	return nil
+}
+
+// startCollector starts the collector process and waits until it accepts connections.
+func (s *E2EStorageIntegration) startCollector(t *testing.T) {
+	require.NoError(t, s.launchCollector(), "collector did not become ready")
+}
+
+// launchCollector starts the collector process and waits until it accepts connections.
+// If the process exits before, e.g. because of an invalid config, it returns right away
+// with the exit code and the collector output instead of waiting for StartupTimeout.
+func (s *E2EStorageIntegration) launchCollector() error {
+	cmd, err := s.collectorCommand()
+	if err != nil {
+		return err
+	}
+	s.collector, err = startProcess(cmd)
+	if err != nil {
+		return fmt.Errorf("cannot start collector: %w", err)
+	}
+	listenPorts := []int{s.otlpPort, s.QueryGRPCPort}
+	if s.otlpHTTPPort != 0 {
+		listenPorts = append(listenPorts, s.otlpHTTPPort)
+	}
+	return s.waitForCollectorPorts(listenPorts...)
+}
+
+// waitForCollectorPorts waits until the collector accepts connections on the given ports.
+func (s *E2EStorageIntegration) waitForCollectorPorts(ports ...int) error {
+	err := waitForPorts(s.collector.exited, s.StartupTimeout, ports...)
+	if errors.Is(err, errProcessExited) {
+		return fmt.Errorf("collector exited with code %d, output:\n%s",
+			s.collector.cmd.ProcessState.ExitCode(), s.CollectorLogs())
+	}
+	return err
+}
+
+// collectorCommand returns the command running the collector binary with the
+// generated config, with BinaryPath and WorkingDir resolved to absolute paths.
+func (s *E2EStorageIntegration) collectorCommand() (*exec.Cmd, error) {
+	dir := s.WorkingDir
+	if dir == "" {
+		dir = defaultWorkingDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve working directory: %w", err)
+	}
+	binary := s.BinaryPath
+	if s.RaceBuildPath != "" {
+		binary = s.RaceBuildPath
+	}
+	if binary == "" {
+		binary = defaultBinaryPath
+	}
+	if !filepath.IsAbs(binary) {
+		binary = filepath.Join(dir, binary)
+	}
+	args := []string{"jaeger", "--config", s.configFile}
+	if len(s.FeatureGates) > 0 {
+		args = append(args, "--feature-gates="+strings.Join(s.FeatureGates, ","))
+	}
+	return &exec.Cmd{
+		Path:   binary,
+		Args:   args,
+		Dir:    dir,
+		Stdout: s.collectorLogs,
+		Stderr: s.collectorLogs,
+	}, nil
+}
+
+// connect creates the SpanWriter, SpanReader and DependencyReader, and the
+// archive counterparts unless SkipArchiveTest is set.
+func (s *E2EStorageIntegration) connect(t *testing.T) {
+	var writer *spanWriter
+	var err error
+	if s.UseOTLPHTTP {
+		writer, err = createHTTPSpanWriter(s.logger, s.otlpHTTPPort)
+	} else {
+		writer, err = createSpanWriter(s.logger, s.otlpPort, s.Keepalive)
+	}
+	require.NoError(t, err)
+	if s.writeLatencies == nil {
+		s.writeLatencies = &latencyRecorder{}
+	}
+	writer.latencies = s.writeLatencies
+	s.SpanWriter = writer
+	if s.BatchSize > 0 {
+		s.SpanWriter = newBatchingSpanWriter(writer, s.BatchSize, s.BatchFlushInterval)
+	}
+	reader, err := createSpanReader(s.QueryGRPCPort, s.Keepalive)
+	require.NoError(t, err)
+	if s.TimeReference.IsZero() {
+		// the reader and the fixtures share the reference, see StorageIntegration.TimeReference
+		s.TimeReference = time.Now()
+	}
+	reader.lookback = s.DefaultLookback
+	reader.timeReference = s.TimeReference
+	retryingReader := newRetryingSpanReader(reader, s.ReadRetry)
+	s.SpanReader = retryingReader
+	s.DependencyReader = retryingReader
+	if !s.SkipArchiveTest {
+		s.e2eInitializeArchive(t, s.logger)
+	}
+}
 
+// FlushWriter sends the spans buffered by the SpanWriter when BatchSize is set,
+// it must be called before reading them back. It does nothing otherwise.
+func (s *E2EStorageIntegration) FlushWriter(t *testing.T) {
+	if writer, ok := s.SpanWriter.(*batchingSpanWriter); ok {
+		require.NoError(t, writer.Flush(context.Background()))
+	}
+}
+
+// WriteLatencyStats returns the percentiles of the latencies of the requests the SpanWriter
+// has sent to the collector so far, one per span or per batch with BatchSize, e.g. to fail
+// a test when writes get slower than a threshold. Failed requests are not accounted for.
+func (s *E2EStorageIntegration) WriteLatencyStats() LatencyStats {
+	if s.writeLatencies == nil {
+		return LatencyStats{}
+	}
+	return s.writeLatencies.stats()
+}
+
+// GetTraceInRange looks up a trace expected to start within [start, end] through the
+// SpanReader, passing the bounds to the query service. Backends ignoring the bounds
+// return the whole trace, as does a SpanReader that does not support them.
+func (s *E2EStorageIntegration) GetTraceInRange(ctx context.Context, traceID model.TraceID, start, end time.Time) (*model.Trace, error) {
+	if reader, ok := s.SpanReader.(interface {
+		GetTraceInRange(ctx context.Context, traceID model.TraceID, start, end time.Time) (*model.Trace, error)
+	}); ok {
+		return reader.GetTraceInRange(ctx, traceID, start, end)
+	}
+	return s.SpanReader.GetTrace(ctx, traceID)
+}
+
+// StorageCleanerConfig returns the storage_cleaner configuration the collector actually
+// loaded, after environment variables were expanded and defaults applied, which helps
+// diagnosing a purge hitting the wrong backend. The collector does not expose its
+// effective config, so it is read from the config endpoint of the extension itself.
+func (s *E2EStorageIntegration) StorageCleanerConfig(t *testing.T) *storagecleaner.Config {
+	config, err := s.storageCleaner().Config(context.Background())
+	require.NoError(t, err)
+	return config
+}
+
+// SupportsCapability reports whether the storages purged by storage_cleaner implement the
+// interface behind the capability, e.g. storagecleaner.CapabilityRangePurge, as resolved
+// by the collector, so that tests can skip what the backend does not support:
+//
+//	if !s.SupportsCapability(t, storagecleaner.CapabilityRangePurge) {
+//		t.Skip("range purge is not supported")
+//	}
+func (s *E2EStorageIntegration) SupportsCapability(t *testing.T, capability storagecleaner.Capability) bool {
+	status, err := s.storageCleaner().Status(context.Background())
+	require.NoError(t, err)
+	return slices.Contains(status.Capabilities, capability)
+}
+
+func (s *E2EStorageIntegration) storageCleaner() *storagecleaner.Client {
+	return &storagecleaner.Client{
+		Endpoint:  s.storageCleanerEndpoint,
+		AuthToken: s.storageCleanerAuthToken,
+	}
+}
+
+// PurgeAndVerifyEmpty purges the storage through storage_cleaner, then polls the
+// SpanReader with exponential backoff until none of the services it lists has traces
+// left, for backends applying deletes with a delay. Services without traces are
+// tolerated since some backends keep their names after a purge. It fails the test
+// if traces remain after purgeVerifyTimeout.
+func (s *E2EStorageIntegration) PurgeAndVerifyEmpty(t *testing.T) {
+	require.NoError(t, s.storageCleaner().Purge(context.Background()))
+	start, end := s.searchWindow()
+	require.NoError(t, waitForEmpty(s.SpanReader, start, end, purgeVerifyTimeout))
+}
+
+// searchWindow returns the time range searched for all the traces of the storage,
+// DefaultLookback or searchLookback up to now or TimeReference, whichever is later.
+func (s *E2EStorageIntegration) searchWindow() (start, end time.Time) {
+	lookback := s.DefaultLookback
+	if lookback == 0 {
+		lookback = searchLookback
+	}
+	end = time.Now()
+	if s.TimeReference.After(end) {
+		end = s.TimeReference
+	}
+	return end.Add(-lookback), end
+}
+
+// CountTraces returns the number of traces in the storage, see CountSpans.
+func (s *E2EStorageIntegration) CountTraces(t *testing.T) int64 {
+	traces, _ := s.count(t)
+	return traces
+}
+
+// CountSpans returns the number of spans in the storage. It is counted by TraceCounter
+// when set, and otherwise estimated by searching the traces of every service through
+// the SpanReader, which only finds the traces within the search window and up to
+// countSearchDepth traces per service.
+func (s *E2EStorageIntegration) CountSpans(t *testing.T) int64 {
+	_, spans := s.count(t)
+	return spans
+}
+
+func (s *E2EStorageIntegration) count(t *testing.T) (traces, spans int64) {
 	var err error
-	s.SpanWriter, err = createSpanWriter(logger, otlpPort)
+	if s.TraceCounter != nil {
+		traces, spans, err = s.TraceCounter(context.Background())
+	} else {
+		start, end := s.searchWindow()
+		traces, spans, err = countTraces(s.SpanReader, start, end)
+	}
+	require.NoError(t, err)
+	return traces, spans
+}
+
+// countTraces counts the traces starting within [start, end] found for each service.
+// Traces spanning several services are counted once.
+func countTraces(reader spanstore.Reader, start, end time.Time) (traces, spans int64, err error) {
+	services, err := reader.GetServices(context.Background())
+	if err != nil {
+		return 0, 0, err
+	}
+	spansByTrace := make(map[model.TraceID]int)
+	for _, service := range services {
+		found, err := reader.FindTraces(context.Background(), &spanstore.TraceQueryParameters{
+			ServiceName:  service,
+			StartTimeMin: start,
+			StartTimeMax: end,
+			NumTraces:    countSearchDepth,
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, trace := range found {
+			if len(trace.Spans) > 0 {
+				spansByTrace[trace.Spans[0].TraceID] = len(trace.Spans)
+			}
+		}
+	}
+	for _, n := range spansByTrace {
+		spans += int64(n)
+	}
+	return int64(len(spansByTrace)), spans, nil
+}
+
+func waitForEmpty(reader spanstore.Reader, start, end time.Time, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 10 * time.Millisecond
+	for {
+		err := findRemainingTraces(reader, start, end)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("timed out waiting for the storage to be empty: %w", err)
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, time.Second)
+	}
+}
+
+// findRemainingTraces returns an error naming a service with traces starting within
+// [start, end], or the error of the SpanReader.
+func findRemainingTraces(reader spanstore.Reader, start, end time.Time) error {
+	services, err := reader.GetServices(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		traces, err := reader.FindTraces(context.Background(), &spanstore.TraceQueryParameters{
+			ServiceName:  service,
+			StartTimeMin: start,
+			StartTimeMax: end,
+			NumTraces:    1,
+		})
+		if err != nil {
+			return err
+		}
+		if len(traces) > 0 {
+			return fmt.Errorf("service %s still has traces", service)
+		}
+	}
+	return nil
+}
+
+// CollectorPID returns the process ID of the running collector.
+func (s *E2EStorageIntegration) CollectorPID() int {
+	return s.collector.cmd.Process.Pid
+}
+
+// RestartCollector kills the running collector and starts a new one with the
+// same config, then re-establishes the SpanWriter and SpanReader connections.
+// It is meant for tests that verify clients recover from a collector crash.
+func (s *E2EStorageIntegration) RestartCollector(t *testing.T) {
+	s.e2eCleanUp(t)
+	require.NoError(t, s.collector.kill())
+
+	listenPorts := []int{s.otlpPort, s.QueryGRPCPort}
+	if s.otlpHTTPPort != 0 {
+		listenPorts = append(listenPorts, s.otlpHTTPPort)
+	}
+	if !s.SkipArchiveTest {
+		listenPorts = append(listenPorts, s.archiveOTLPPort)
+	}
+	err := waitForPortsFree(s.StartupTimeout, listenPorts...)
+	require.NoError(t, err, "collector ports were not released")
+
+	s.startCollector(t)
+	s.connect(t)
+}
+
+// e2eInitializeArchive initializes the ArchiveSpanWriter and ArchiveSpanReader.
+// The writer sends spans to a dedicated OTLP receiver whose pipeline exports
+// into the archive storage of jaeger_query. The reader is the query service,
+// which falls back to the archive storage when a trace is not found in the
+// primary one. This requires the archive storage factory to implement
+// storage.ArchiveFactory, otherwise jaeger_query does not initialize it
+// (e.g. badger) and the archive tests must be skipped.
+func (s *E2EStorageIntegration) e2eInitializeArchive(t *testing.T, logger *zap.Logger) {
+	err := s.waitForCollectorPorts(s.archiveOTLPPort)
+	require.NoError(t, err, "collector archive receiver did not become ready")
+	s.ArchiveSpanWriter, err = createSpanWriter(logger, s.archiveOTLPPort, s.Keepalive)
 	require.NoError(t, err)
-	s.SpanReader, err = createSpanReader(ports.QueryGRPC)
+	s.ArchiveSpanReader = s.SpanReader
+}
+
+// RunAll runs all integration tests of the embedded StorageIntegration,
+// followed by the e2e-specific ones.
+func (s *E2EStorageIntegration) RunAll(t *testing.T) {
+	s.StorageIntegration.RunAll(t)
+	t.Run("ArchiveRoundTrip", s.testArchiveRoundTrip)
+}
+
+// testArchiveRoundTrip verifies that a trace written to the archive storage
+// is readable via the archive reader but is not stored in the primary storage.
+func (s *E2EStorageIntegration) testArchiveRoundTrip(t *testing.T) {
+	if s.SkipArchiveTest {
+		t.Skip("Skipping ArchiveRoundTrip test because archive storage is not supported")
+	}
+	traceID := model.NewTraceID(uint64(33), uint64(44))
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        model.NewSpanID(66),
+		OperationName: "archive_round_trip",
+		StartTime:     time.Now().Add(-time.Minute).Truncate(time.Microsecond),
+		Duration:      time.Millisecond,
+		Process:       model.NewProcess("archive_round_trip_service", model.KeyValues{}),
+	}
+	require.NoError(t, s.ArchiveSpanWriter.WriteSpan(context.Background(), span))
+
+	require.Eventually(t, func() bool {
+		trace, err := s.ArchiveSpanReader.GetTrace(context.Background(), traceID)
+		return err == nil && len(trace.Spans) == 1
+	}, 30*time.Second, 100*time.Millisecond, "trace not found in archive storage")
+
+	// FindTraces only searches the primary storage.
+	traces, err := s.SpanReader.FindTraces(context.Background(), &spanstore.TraceQueryParameters{
+		ServiceName:  span.Process.ServiceName,
+		StartTimeMin: span.StartTime.Add(-time.Minute),
+		StartTimeMax: span.StartTime.Add(time.Minute),
+		NumTraces:    10,
+	})
 	require.NoError(t, err)
+	assert.Empty(t, traces, "archived trace must not be stored in primary storage")
+}
+
+// CollectorLogs returns the output the collector has produced so far.
+func (s *E2EStorageIntegration) CollectorLogs() string {
+	if s.collectorLogs == nil {
+		return ""
+	}
+	return s.collectorLogs.String()
+}
+
+// AssertCollectorLogContains asserts that a line the collector has logged so far contains
+// substring, e.g. a deprecation warning. It returns whether the assertion succeeded.
+func (s *E2EStorageIntegration) AssertCollectorLogContains(t *testing.T, substring string) bool {
+	_, found := findLogLine(s.CollectorLogs(), substring)
+	return assert.True(t, found, "collector logs do not contain %q", substring)
+}
+
+// AssertCollectorLogNotContains asserts that no line the collector has logged so far contains
+// substring, e.g. "error". It returns whether the assertion succeeded.
+func (s *E2EStorageIntegration) AssertCollectorLogNotContains(t *testing.T, substring string) bool {
+	line, found := findLogLine(s.CollectorLogs(), substring)
+	return assert.False(t, found, "collector logs contain %q: %s", substring, line)
+}
+
+// findLogLine returns the first line of logs containing substring.
+func findLogLine(logs, substring string) (string, bool) {
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.Contains(line, substring) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// assertNoDataRace asserts that the race detector has not reported any data race
+// in the collector output. It returns whether the assertion succeeded.
+func (s *E2EStorageIntegration) assertNoDataRace(t *testing.T) bool {
+	reports := findRaceReports(s.CollectorLogs())
+	return assert.Empty(t, reports, "collector detected %d data race(s):\n%s",
+		len(reports), strings.Join(reports, "\n"))
+}
+
+// findRaceReports returns the data race reports of the race detector found in logs,
+// each starting with raceWarning and ending with the line of raceSeparator after it.
+func findRaceReports(logs string) []string {
+	var reports []string
+	var report []string
+	for _, line := range strings.Split(logs, "\n") {
+		switch {
+		case strings.Contains(line, raceWarning):
+			report = []string{line}
+		case report == nil:
+		case strings.HasPrefix(line, raceSeparator):
+			reports = append(reports, strings.Join(report, "\n"))
+			report = nil
+		default:
+			report = append(report, line)
+		}
+	}
+	if report != nil {
+		// the collector was killed while the report was written
+		reports = append(reports, strings.Join(report, "\n"))
+	}
+	return reports
 }
 
 // e2eCleanUp closes the SpanReader and SpanWriter gRPC connection.
@@ -69,31 +878,414 @@ func (s *E2EStorageIntegration) e2eInitialize(t *testing.T) {
 func (s *E2EStorageIntegration) e2eCleanUp(t *testing.T) {
 	require.NoError(t, s.SpanReader.(io.Closer).Close())
 	require.NoError(t, s.SpanWriter.(io.Closer).Close())
+	if s.ArchiveSpanWriter != nil {
+		require.NoError(t, s.ArchiveSpanWriter.(io.Closer).Close())
+	}
 }
 
-func createStorageCleanerConfig(t *testing.T, configFile string) string {
-	data, err := os.ReadFile(configFile)
+// getFreePort asks the kernel for a free ephemeral port.
+func getFreePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "localhost:0")
 	require.NoError(t, err)
-	var config map[string]interface{}
-	err = yaml.Unmarshal(data, &config)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitForPorts polls the given local ports with exponential backoff
+// until all of them accept TCP connections or the timeout elapses.
+// It returns errProcessExited as soon as exited is closed.
+func waitForPorts(exited <-chan struct{}, timeout time.Duration, ports ...int) error {
+	deadline := time.Now().Add(timeout)
+	for _, port := range ports {
+		addr := fmt.Sprintf("localhost:%d", port)
+		backoff := 50 * time.Millisecond
+		for {
+			conn, err := net.DialTimeout("tcp", addr, time.Second)
+			if err == nil {
+				conn.Close()
+				break
+			}
+			if time.Now().Add(backoff).After(deadline) {
+				return fmt.Errorf("timed out waiting for %s: %w", addr, err)
+			}
+			select {
+			case <-exited:
+				return errProcessExited
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Second)
+		}
+	}
+	return nil
+}
+
+// WaitForSpan polls SpanReader.GetTrace with exponential backoff until the trace
+// is readable or the timeout elapses, for backends that make writes visible with a
+// delay (e.g. after an index refresh). It returns the trace or fails the test.
+func (s *E2EStorageIntegration) WaitForSpan(t *testing.T, traceID model.TraceID, timeout time.Duration) *model.Trace {
+	trace, err := waitForTrace(s.SpanReader, traceID, timeout)
 	require.NoError(t, err)
+	return trace
+}
+
+func waitForTrace(reader spanstore.Reader, traceID model.TraceID, timeout time.Duration) (*model.Trace, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := 10 * time.Millisecond
+	for {
+		trace, err := reader.GetTrace(context.Background(), traceID)
+		if err == nil && len(trace.Spans) > 0 {
+			return trace, nil
+		}
+		if err == nil {
+			err = spanstore.ErrTraceNotFound
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for trace %s: %w", traceID, err)
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, time.Second)
+	}
+}
 
-	service, ok := config["service"].(map[string]interface{})
-	require.True(t, ok)
-	service["extensions"] = append(service["extensions"].([]interface{}), "storage_cleaner")
+// waitForPortsFree polls the given local ports until all of them
+// can be listened on again or the timeout elapses.
+func waitForPortsFree(timeout time.Duration, ports ...int) error {
+	deadline := time.Now().Add(timeout)
+	for _, port := range ports {
+		addr := fmt.Sprintf("localhost:%d", port)
+		for {
+			l, err := net.Listen("tcp", addr)
+			if err == nil {
+				l.Close()
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for %s to be released: %w", addr, err)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return nil
+}
 
-	extensions, ok := config["extensions"].(map[string]interface{})
-	require.True(t, ok)
-	query, ok := extensions["jaeger_query"].(map[string]interface{})
-	require.True(t, ok)
-	trace_storage := query["trace_storage"].(string)
-	extensions["storage_cleaner"] = map[string]string{"trace_storage": trace_storage}
+// serviceConfig is the subset of the service section of the collector config edited by the harness.
+type serviceConfig struct {
+	Extensions []string `mapstructure:"extensions"`
+}
+
+// queryExtensionConfig is the subset of the config of a jaeger_query extension read by the harness.
+type queryExtensionConfig struct {
+	TraceStorage        string `mapstructure:"trace_storage"`
+	TraceStorageArchive string `mapstructure:"trace_storage_archive"`
+}
+
+// otlpReceiverConfig is the subset of the config of the otlp receiver edited by the harness.
+// The settings of each protocol are kept as is, only their endpoint is replaced.
+type otlpReceiverConfig struct {
+	Protocols map[string]map[string]interface{} `mapstructure:"protocols"`
+}
 
-	newData, err := yaml.Marshal(config)
+// decodeConfig decodes the value of key in config, e.g. "receivers::otlp", into the typed
+// struct target. The settings target does not declare are ignored, and left untouched in config.
+func decodeConfig(config map[string]interface{}, key string, target any) error {
+	sub, err := confmap.NewFromStringMap(config).Sub(key)
+	if err != nil {
+		return err
+	}
+	return sub.Unmarshal(target, confmap.WithIgnoreUnused())
+}
+
+// configMap returns the map at the given path of keys in config, e.g. "receivers", "otlp",
+// adding empty ones for the keys that are missing or null.
+func configMap(config map[string]interface{}, path ...string) (map[string]interface{}, error) {
+	m := config
+	for i, key := range path {
+		switch value := m[key].(type) {
+		case map[string]interface{}:
+			m = value
+		case nil:
+			child := map[string]interface{}{}
+			m[key] = child
+			m = child
+		default:
+			return nil, fmt.Errorf("invalid %s in config: expected a map, got %T", strings.Join(path[:i+1], "."), value)
+		}
+	}
+	return m, nil
+}
+
+// findQueryExtension returns the name and config of the jaeger_query extension with the given
+// name, or of the only jaeger_query extension (e.g. "jaeger_query/tenantA") when name is empty.
+func findQueryExtension(extensions map[string]interface{}, name string) (string, queryExtensionConfig, error) {
+	var query queryExtensionConfig
+	if name == "" {
+		var names []string
+		for key := range extensions {
+			if key == "jaeger_query" || strings.HasPrefix(key, "jaeger_query/") {
+				names = append(names, key)
+			}
+		}
+		switch len(names) {
+		case 0:
+			return "", query, errors.New("no jaeger_query extension found in config")
+		case 1:
+			name = names[0]
+		default:
+			sort.Strings(names)
+			return "", query, fmt.Errorf("ambiguous jaeger_query extensions %v, set QueryExtension to pick one", names)
+		}
+	}
+	if _, ok := extensions[name]; !ok {
+		return "", query, fmt.Errorf("extension %s not found in config", name)
+	}
+	if err := decodeConfig(extensions, name, &query); err != nil {
+		return "", query, fmt.Errorf("invalid extension %s in config: %w", name, err)
+	}
+	return name, query, nil
+}
+
+// storageCleanerEndpoint returns the base URL storage_cleaner is served at with the validated
+// config, on localhost when it listens on all interfaces.
+func storageCleanerEndpoint(cfg *storagecleaner.Config) string {
+	host, port, _ := net.SplitHostPort(cfg.Endpoint)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if cfg.TLS.Enabled {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + cfg.PathPrefix
+}
+
+// findQueryTraceStorage returns the trace storage of the jaeger_query extension selected by findQueryExtension.
+func findQueryTraceStorage(extensions map[string]interface{}, name string) (string, error) {
+	name, query, err := findQueryExtension(extensions, name)
+	if err != nil {
+		return "", err
+	}
+	if query.TraceStorage == "" {
+		return "", fmt.Errorf("extension %s has no trace_storage", name)
+	}
+	return expandEnv(query.TraceStorage), nil
+}
+
+// findQueryArchiveStorage returns the archive storage of the jaeger_query extension selected by findQueryExtension.
+func findQueryArchiveStorage(extensions map[string]interface{}, name string) (string, error) {
+	name, query, err := findQueryExtension(extensions, name)
+	if err != nil {
+		return "", err
+	}
+	if query.TraceStorageArchive == "" {
+		return "", fmt.Errorf("extension %s has no trace_storage_archive, set SkipArchiveTest to skip archive tests", name)
+	}
+	return expandEnv(query.TraceStorageArchive), nil
+}
+
+// envPlaceholder matches the ${env:NAME} and ${NAME} references to environment variables.
+var envPlaceholder = regexp.MustCompile(`\$\{(?:env:)?([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv resolves the references to environment variables that the collector
+// expands at runtime, so that a value extracted from the config, such as the name
+// of a storage, matches the one the collector uses. Unset variables expand to "".
+func expandEnv(value string) string {
+	return envPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		return os.Getenv(envPlaceholder.FindStringSubmatch(placeholder)[1])
+	})
+}
+
+// addArchivePipeline adds a traces pipeline that receives OTLP on the given
+// port and exports the spans into the archive storage.
+func addArchivePipeline(config map[string]interface{}, archiveStorage string, port int) error {
+	receivers, err := configMap(config, "receivers")
+	if err != nil {
+		return err
+	}
+	receivers["otlp/archive"] = map[string]interface{}{
+		"protocols": map[string]interface{}{
+			"grpc": map[string]interface{}{
+				"endpoint": fmt.Sprintf("localhost:%d", port),
+			},
+		},
+	}
+	exporters, err := configMap(config, "exporters")
+	if err != nil {
+		return err
+	}
+	exporters["jaeger_storage_exporter/archive"] = map[string]interface{}{
+		"trace_storage": archiveStorage,
+	}
+	pipelines, err := configMap(config, "service", "pipelines")
+	if err != nil {
+		return err
+	}
+	pipelines["traces/archive"] = map[string]interface{}{
+		"receivers": []interface{}{"otlp/archive"},
+		"exporters": []interface{}{"jaeger_storage_exporter/archive"},
+	}
+	return nil
+}
+
+// isJSONConfig reports whether the config file is in JSON rather than YAML format.
+func isJSONConfig(configFile string) bool {
+	return strings.EqualFold(filepath.Ext(configFile), ".json")
+}
+
+func unmarshalConfig(configFile string, data []byte) (map[string]interface{}, error) {
+	var config map[string]interface{}
+	if isJSONConfig(configFile) {
+		err := json.Unmarshal(data, &config)
+		return config, err
+	}
+	err := yaml.Unmarshal(data, &config)
+	return config, err
+}
+
+func marshalConfig(configFile string, config map[string]interface{}) ([]byte, error) {
+	if isJSONConfig(configFile) {
+		return json.MarshalIndent(config, "", "  ")
+	}
+	return yaml.Marshal(config)
+}
+
+// createStorageCleanerConfig generates the collector config with the storage_cleaner
+// extension enabled, in the same format (YAML or JSON) as ConfigFile.
+func (s *E2EStorageIntegration) createStorageCleanerConfig(t *testing.T) string {
+	data, err := os.ReadFile(s.ConfigFile)
 	require.NoError(t, err)
-	tempFile := filepath.Join(t.TempDir(), "storageCleaner_config.yaml")
+	config, err := unmarshalConfig(s.ConfigFile, data)
+	require.NoError(t, err, "cannot parse %s", s.ConfigFile)
+	require.NoError(t, s.editConfig(config), "cannot generate the collector config from %s", s.ConfigFile)
+
+	newData, err := marshalConfig(s.ConfigFile, config)
+	require.NoError(t, err)
+	ext := ".yaml"
+	if isJSONConfig(s.ConfigFile) {
+		ext = ".json"
+	}
+	dir := t.TempDir()
+	if s.KeepConfig {
+		dir = keptConfigDir(t)
+		require.NoError(t, os.MkdirAll(dir, 0o700))
+	}
+	tempFile := filepath.Join(dir, "storageCleaner_config"+ext)
 	err = os.WriteFile(tempFile, newData, 0o600)
 	require.NoError(t, err)
+	if s.KeepConfig {
+		t.Logf("Collector config kept at %s", tempFile)
+	}
 
 	return tempFile
 }
+
+// keptConfigDir returns the directory the collector config of the test is kept in with KeepConfig.
+// It is the same for each run of the test, so that the config of the last run is found there.
+func keptConfigDir(t *testing.T) string {
+	return filepath.Join(os.TempDir(), "jaeger-e2e-config", strings.ReplaceAll(t.Name(), "/", "_"))
+}
+
+// editConfig enables the storage_cleaner extension and the ExtraExtensions in config, and
+// points the OTLP receivers and the query gRPC endpoint to the ports picked for the test.
+// The sections it edits are decoded into typed structs first, so that a config of an
+// unexpected shape is reported with a descriptive error. All other settings are preserved.
+func (s *E2EStorageIntegration) editConfig(config map[string]interface{}) error {
+	if config == nil {
+		return errors.New("config is empty")
+	}
+	var svc serviceConfig
+	if err := decodeConfig(config, "service", &svc); err != nil {
+		return fmt.Errorf("invalid service in config: %w", err)
+	}
+	for _, name := range append([]string{"storage_cleaner"}, s.ExtraExtensions...) {
+		if !slices.Contains(svc.Extensions, name) {
+			svc.Extensions = append(svc.Extensions, name)
+		}
+	}
+	service, err := configMap(config, "service")
+	if err != nil {
+		return err
+	}
+	service["extensions"] = svc.Extensions
+
+	extensions, err := configMap(config, "extensions")
+	if err != nil {
+		return err
+	}
+	for _, name := range s.ExtraExtensions {
+		if _, ok := extensions[name]; !ok {
+			extensions[name] = map[string]interface{}{}
+		}
+	}
+	traceStorage, err := findQueryTraceStorage(extensions, s.QueryExtension)
+	if err != nil {
+		return err
+	}
+	if s.QueryGRPCPort != 0 {
+		queryName, _, err := findQueryExtension(extensions, s.QueryExtension)
+		if err != nil {
+			return err
+		}
+		queryGRPC, err := configMap(config, "extensions", queryName, "grpc")
+		if err != nil {
+			return err
+		}
+		queryGRPC["endpoint"] = fmt.Sprintf("localhost:%d", s.QueryGRPCPort)
+	}
+	// keep any settings of an existing storage_cleaner section, e.g. a custom port
+	cleaner, err := configMap(config, "extensions", "storage_cleaner")
+	if err != nil {
+		return err
+	}
+	if _, ok := cleaner["trace_storage"]; !ok {
+		cleaner["trace_storage"] = traceStorage
+	}
+	var cleanerConfig storagecleaner.Config
+	if err := decodeConfig(config, "extensions::storage_cleaner", &cleanerConfig); err != nil {
+		return fmt.Errorf("invalid extensions.storage_cleaner in config: %w", err)
+	}
+	if err := cleanerConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid extensions.storage_cleaner in config: %w", err)
+	}
+	s.storageCleanerEndpoint = storageCleanerEndpoint(&cleanerConfig)
+	s.storageCleanerAuthToken = cleanerConfig.AuthToken
+
+	var otlp otlpReceiverConfig
+	if err := decodeConfig(config, "receivers::otlp", &otlp); err != nil {
+		return fmt.Errorf("invalid receivers.otlp in config: %w", err)
+	}
+	if otlp.Protocols == nil {
+		return errors.New("receiver otlp has no protocols in config")
+	}
+	setEndpoint := func(protocol string, port int) {
+		settings := otlp.Protocols[protocol]
+		if settings == nil {
+			settings = map[string]interface{}{}
+			otlp.Protocols[protocol] = settings
+		}
+		settings["endpoint"] = fmt.Sprintf("localhost:%d", port)
+	}
+	setEndpoint("grpc", s.otlpPort)
+	if s.UseOTLPHTTP {
+		setEndpoint("http", s.otlpHTTPPort)
+	}
+	receiver, err := configMap(config, "receivers", "otlp")
+	if err != nil {
+		return err
+	}
+	receiver["protocols"] = otlp.Protocols
+
+	if s.batchTimeout, err = batchTimeout(config); err != nil {
+		return err
+	}
+
+	if !s.SkipArchiveTest {
+		archiveStorage, err := findQueryArchiveStorage(extensions, s.QueryExtension)
+		if err != nil {
+			return err
+		}
+		if err := addArchivePipeline(config, archiveStorage, s.archiveOTLPPort); err != nil {
+			return err
+		}
+	}
+	return nil
+}
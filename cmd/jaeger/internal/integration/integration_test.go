@@ -0,0 +1,1805 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/extension/extensiontest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/integration/storagecleaner"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/integration"
+	"github.com/jaegertracing/jaeger/plugin/storage/memory"
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2"
+	"github.com/jaegertracing/jaeger/storage"
+	factoryMocks "github.com/jaegertracing/jaeger/storage/mocks"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+func readConfig(t *testing.T, configFile string) map[string]interface{} {
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	var config map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &config))
+	return config
+}
+
+func TestCreateStorageCleanerConfig(t *testing.T) {
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		otlpPort:   12345,
+	}
+	configFile := s.createStorageCleanerConfig(t)
+	config := readConfig(t, configFile)
+
+	service := config["service"].(map[string]interface{})
+	assert.Contains(t, service["extensions"], "storage_cleaner")
+
+	extensions := config["extensions"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"trace_storage": "badger_main"}, extensions["storage_cleaner"])
+
+	receivers := config["receivers"].(map[string]interface{})
+	otlp := receivers["otlp"].(map[string]interface{})
+	protocols := otlp["protocols"].(map[string]interface{})
+	grpc := protocols["grpc"].(map[string]interface{})
+	assert.Equal(t, "localhost:12345", grpc["endpoint"])
+}
+
+func TestCreateStorageCleanerConfigQueryGRPCPort(t *testing.T) {
+	s := &E2EStorageIntegration{
+		ConfigFile:    "../../badger_config.yaml",
+		otlpPort:      12345,
+		QueryGRPCPort: 23456,
+	}
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+
+	extensions := config["extensions"].(map[string]interface{})
+	query := extensions["jaeger_query"].(map[string]interface{})
+	assert.Equal(t, "badger_main", query["trace_storage"])
+	assert.Equal(t, map[string]interface{}{"endpoint": "localhost:23456"}, query["grpc"])
+}
+
+func TestCreateStorageCleanerConfigKeepConfig(t *testing.T) {
+	s := &E2EStorageIntegration{
+		ConfigFile: "../../badger_config.yaml",
+		KeepConfig: true,
+	}
+	s.SkipArchiveTest = true
+	var configFile string
+	t.Run("generate", func(t *testing.T) {
+		configFile = s.createStorageCleanerConfig(t)
+		assert.Equal(t, filepath.Join(keptConfigDir(t), "storageCleaner_config.yaml"), configFile)
+	})
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(filepath.Dir(configFile)))
+	})
+	// the config is still there once the test that generated it has ended
+	config := readConfig(t, configFile)
+	assert.Contains(t, config["service"].(map[string]interface{})["extensions"], "storage_cleaner")
+}
+
+func TestCreateStorageCleanerConfigOTLPHTTP(t *testing.T) {
+	s := &E2EStorageIntegration{
+		ConfigFile:   "../../badger_config.yaml",
+		UseOTLPHTTP:  true,
+		otlpPort:     12345,
+		otlpHTTPPort: 23456,
+	}
+	s.SkipArchiveTest = true
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+
+	receivers := config["receivers"].(map[string]interface{})
+	protocols := receivers["otlp"].(map[string]interface{})["protocols"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"endpoint": "localhost:12345"}, protocols["grpc"])
+	assert.Equal(t, map[string]interface{}{"endpoint": "localhost:23456"}, protocols["http"])
+}
+
+func TestCreateStorageCleanerConfigFormats(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		content    string
+		unmarshal  func([]byte, any) error
+	}{
+		{
+			name:       "yaml",
+			configFile: "config.yaml",
+			content: `
+service:
+  extensions: [jaeger_storage, jaeger_query]
+extensions:
+  jaeger_query:
+    trace_storage: main
+receivers:
+  otlp:
+    protocols:
+      grpc:
+`,
+			unmarshal: yaml.Unmarshal,
+		},
+		{
+			name:       "json",
+			configFile: "config.json",
+			content: `{
+  "service": {"extensions": ["jaeger_storage", "jaeger_query"]},
+  "extensions": {"jaeger_query": {"trace_storage": "main"}},
+  "receivers": {"otlp": {"protocols": {"grpc": null}}}
+}`,
+			unmarshal: json.Unmarshal,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baseConfig := filepath.Join(t.TempDir(), test.configFile)
+			require.NoError(t, os.WriteFile(baseConfig, []byte(test.content), 0o600))
+			s := &E2EStorageIntegration{
+				ConfigFile: baseConfig,
+				otlpPort:   12345,
+			}
+			s.SkipArchiveTest = true
+			configFile := s.createStorageCleanerConfig(t)
+			assert.Equal(t, filepath.Ext(test.configFile), filepath.Ext(configFile))
+
+			data, err := os.ReadFile(configFile)
+			require.NoError(t, err)
+			var config map[string]interface{}
+			require.NoError(t, test.unmarshal(data, &config))
+
+			service := config["service"].(map[string]interface{})
+			assert.Contains(t, service["extensions"], "storage_cleaner")
+			extensions := config["extensions"].(map[string]interface{})
+			assert.Equal(t, map[string]interface{}{"trace_storage": "main"}, extensions["storage_cleaner"])
+			receivers := config["receivers"].(map[string]interface{})
+			grpc := receivers["otlp"].(map[string]interface{})["protocols"].(map[string]interface{})["grpc"]
+			assert.Equal(t, map[string]interface{}{"endpoint": "localhost:12345"}, grpc)
+		})
+	}
+}
+
+func TestCreateStorageCleanerConfigArchive(t *testing.T) {
+	s := &E2EStorageIntegration{
+		ConfigFile:      "../../badger_config.yaml",
+		otlpPort:        12345,
+		archiveOTLPPort: 12346,
+	}
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+
+	receivers := config["receivers"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"protocols": map[string]interface{}{
+			"grpc": map[string]interface{}{"endpoint": "localhost:12346"},
+		},
+	}, receivers["otlp/archive"])
+	exporters := config["exporters"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"trace_storage": "badger_archive"}, exporters["jaeger_storage_exporter/archive"])
+	pipelines := config["service"].(map[string]interface{})["pipelines"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"receivers": []interface{}{"otlp/archive"},
+		"exporters": []interface{}{"jaeger_storage_exporter/archive"},
+	}, pipelines["traces/archive"])
+
+	s.SkipArchiveTest = true
+	config = readConfig(t, s.createStorageCleanerConfig(t))
+	assert.NotContains(t, config["receivers"], "otlp/archive")
+}
+
+func TestEditConfigMalformed(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		expectedErr string
+	}{
+		{
+			name:        "empty",
+			config:      ``,
+			expectedErr: "config is empty",
+		},
+		{
+			name:        "service is a list",
+			config:      `service: [jaeger_query]`,
+			expectedErr: "invalid service in config",
+		},
+		{
+			name: "service extensions is a map",
+			config: `
+service:
+  extensions: {jaeger_query: {}}`,
+			expectedErr: "invalid service in config",
+		},
+		{
+			name: "extensions is a list",
+			config: `
+service:
+  extensions: [jaeger_query]
+extensions: [jaeger_query]`,
+			expectedErr: "invalid extensions in config: expected a map, got []interface {}",
+		},
+		{
+			name: "trace_storage is a map",
+			config: `
+extensions:
+  jaeger_query:
+    trace_storage: {name: main}`,
+			expectedErr: "invalid extension jaeger_query in config",
+		},
+		{
+			name: "jaeger_query is a string",
+			config: `
+extensions:
+  jaeger_query: main`,
+			expectedErr: "invalid extension jaeger_query in config",
+		},
+		{
+			name: "storage_cleaner is a string",
+			config: `
+extensions:
+  jaeger_query:
+    trace_storage: main
+  storage_cleaner: enabled`,
+			expectedErr: "invalid extensions.storage_cleaner in config: expected a map, got string",
+		},
+		{
+			name: "missing otlp receiver",
+			config: `
+extensions:
+  jaeger_query:
+    trace_storage: main`,
+			expectedErr: "receiver otlp has no protocols in config",
+		},
+		{
+			name: "otlp protocols is a list",
+			config: `
+extensions:
+  jaeger_query:
+    trace_storage: main
+receivers:
+  otlp:
+    protocols: [grpc]`,
+			expectedErr: "invalid receivers.otlp in config",
+		},
+		{
+			name: "pipelines is a list",
+			config: `
+service:
+  pipelines: [traces]
+extensions:
+  jaeger_query:
+    trace_storage: main
+    trace_storage_archive: archive
+receivers:
+  otlp:
+    protocols:
+      grpc:`,
+			expectedErr: "invalid service.pipelines in config: expected a map, got []interface {}",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config map[string]interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(test.config), &config))
+			s := &E2EStorageIntegration{}
+			s.SkipArchiveTest = !strings.Contains(test.config, "trace_storage_archive")
+			require.NotPanics(t, func() {
+				require.ErrorContains(t, s.editConfig(config), test.expectedErr)
+			})
+		})
+	}
+}
+
+func TestEditConfigPreservesUnknownFields(t *testing.T) {
+	var config map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+service:
+  extensions: [jaeger_query]
+  telemetry:
+    logs:
+      level: debug
+extensions:
+  jaeger_query:
+    trace_storage: main
+    ui_config: ./cmd/jaeger/config-ui.json
+processors:
+  batch:
+receivers:
+  otlp:
+    protocols:
+      grpc:
+        max_recv_msg_size_mib: 16
+`), &config))
+	s := &E2EStorageIntegration{otlpPort: 12345}
+	s.SkipArchiveTest = true
+	require.NoError(t, s.editConfig(config))
+
+	assert.Equal(t, map[string]interface{}{
+		"extensions": []string{"jaeger_query", "storage_cleaner"},
+		"telemetry":  map[string]interface{}{"logs": map[string]interface{}{"level": "debug"}},
+	}, config["service"])
+	assert.Equal(t, map[string]interface{}{
+		"trace_storage": "main",
+		"ui_config":     "./cmd/jaeger/config-ui.json",
+	}, config["extensions"].(map[string]interface{})["jaeger_query"])
+	assert.Contains(t, config["processors"], "batch")
+	assert.Equal(t, defaultBatchTimeout, s.batchTimeout)
+	grpc := config["receivers"].(map[string]interface{})["otlp"].(map[string]interface{})["protocols"].(map[string]map[string]interface{})["grpc"]
+	assert.Equal(t, map[string]interface{}{"endpoint": "localhost:12345", "max_recv_msg_size_mib": 16}, grpc)
+}
+
+func TestBatchTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		timeout     time.Duration
+		expectedErr string
+	}{
+		{name: "no processors", config: "receivers: {}"},
+		{name: "no batch processor", config: "processors: {memory_limiter: {}}"},
+		{name: "default timeout", config: "processors: {batch: }", timeout: defaultBatchTimeout},
+		{
+			name:    "longest timeout",
+			config:  "processors: {batch: {timeout: 1s}, batch/slow: {timeout: 5s}, memory_limiter: {}}",
+			timeout: 5 * time.Second,
+		},
+		{name: "invalid timeout", config: "processors: {batch: {timeout: soon}}", expectedErr: "invalid processors.batch in config"},
+		{name: "invalid processors", config: "processors: [batch]", expectedErr: "invalid processors in config"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config map[string]interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(test.config), &config))
+			timeout, err := batchTimeout(config)
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.timeout, timeout)
+		})
+	}
+}
+
+// batchingCollector holds the spans written to it until flushed, like a collector with a batch processor.
+type batchingCollector struct {
+	mu      sync.Mutex
+	pending []*model.Span
+	store   *memory.Store
+}
+
+func (c *batchingCollector) WriteSpan(_ context.Context, span *model.Span) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, span)
+	return nil
+}
+
+func (c *batchingCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.pending {
+		if err := c.store.WriteSpan(r.Context(), span); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	c.pending = nil
+}
+
+func TestFlushCollector(t *testing.T) {
+	collector := &batchingCollector{store: memory.NewStore()}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	s := &E2EStorageIntegration{FlushURL: server.URL, configFile: "config.yaml", batchTimeout: time.Hour}
+	s.SpanWriter = collector
+	s.SpanReader = collector.store
+
+	traceID := model.NewTraceID(0, 1)
+	require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), &model.Span{
+		TraceID: traceID,
+		SpanID:  model.NewSpanID(1),
+		Process: model.NewProcess("service", nil),
+	}))
+	_, err := s.SpanReader.GetTrace(context.Background(), traceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	start := time.Now()
+	s.FlushCollector(t)
+	// the flush endpoint makes waiting for the batch timeout unnecessary
+	assert.Less(t, time.Since(start), time.Minute)
+	trace, err := s.SpanReader.GetTrace(context.Background(), traceID)
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+}
+
+func TestFlushCollectorFallback(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	tests := []struct {
+		name     string
+		s        *E2EStorageIntegration
+		expected time.Duration
+	}{
+		{
+			name:     "flush endpoint not found",
+			s:        &E2EStorageIntegration{FlushURL: server.URL, configFile: "config.yaml", batchTimeout: 50 * time.Millisecond},
+			expected: 50 * time.Millisecond,
+		},
+		{
+			name:     "no flush endpoint",
+			s:        &E2EStorageIntegration{configFile: "config.yaml", batchTimeout: 50 * time.Millisecond},
+			expected: 50 * time.Millisecond,
+		},
+		{
+			name:     "unknown config",
+			s:        &E2EStorageIntegration{},
+			expected: defaultBatchTimeout,
+		},
+		{
+			name: "no batch processor",
+			s:    &E2EStorageIntegration{configFile: "config.yaml"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			require.NoError(t, test.s.flushCollector(context.Background()))
+			elapsed := time.Since(start)
+			assert.GreaterOrEqual(t, elapsed, test.expected)
+			assert.Less(t, elapsed, test.expected+flushGrace+time.Second)
+		})
+	}
+}
+
+func TestFlushCollectorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	s := &E2EStorageIntegration{FlushURL: server.URL, configFile: "config.yaml"}
+	err := s.flushCollector(context.Background())
+	require.ErrorContains(t, err, "responded 500 Internal Server Error")
+
+	server.Close()
+	err = s.flushCollector(context.Background())
+	require.ErrorContains(t, err, "cannot flush the collector")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s = &E2EStorageIntegration{configFile: "config.yaml", batchTimeout: time.Hour}
+	require.ErrorIs(t, s.flushCollector(ctx), context.Canceled)
+}
+
+func TestFindQueryArchiveStorage(t *testing.T) {
+	extensions := map[string]interface{}{
+		"jaeger_query": map[string]interface{}{"trace_storage": "main"},
+	}
+	_, err := findQueryArchiveStorage(extensions, "")
+	require.ErrorContains(t, err, "extension jaeger_query has no trace_storage_archive")
+
+	_, err = findQueryArchiveStorage(extensions, "jaeger_query/missing")
+	require.ErrorContains(t, err, "extension jaeger_query/missing not found")
+
+	extensions["jaeger_query"].(map[string]interface{})["trace_storage_archive"] = "archive"
+	archiveStorage, err := findQueryArchiveStorage(extensions, "")
+	require.NoError(t, err)
+	assert.Equal(t, "archive", archiveStorage)
+}
+
+func TestGetFreePort(t *testing.T) {
+	port := getFreePort(t)
+	assert.Positive(t, port)
+}
+
+func TestCollectorLogs(t *testing.T) {
+	s := &E2EStorageIntegration{}
+	assert.Empty(t, s.CollectorLogs())
+
+	s.collectorLogs = &syncBuffer{}
+	_, err := s.collectorLogs.Write([]byte("Query server started"))
+	require.NoError(t, err)
+	assert.Contains(t, s.CollectorLogs(), "Query server started")
+}
+
+func TestAssertCollectorLog(t *testing.T) {
+	s := &E2EStorageIntegration{collectorLogs: &syncBuffer{}}
+	_, err := s.collectorLogs.Write([]byte("info\tStarting extensions...\nwarn\tflag is deprecated\n"))
+	require.NoError(t, err)
+	assert.True(t, s.AssertCollectorLogContains(t, "Starting extensions"))
+	assert.True(t, s.AssertCollectorLogContains(t, "deprecated"))
+	assert.True(t, s.AssertCollectorLogNotContains(t, "error"))
+
+	line, found := findLogLine(s.CollectorLogs(), "deprecated")
+	assert.True(t, found)
+	assert.Equal(t, "warn\tflag is deprecated", line)
+	_, found = findLogLine(s.CollectorLogs(), "error")
+	assert.False(t, found)
+}
+
+func TestFindRaceReports(t *testing.T) {
+	logs := strings.Join([]string{
+		"info\tStarting extensions...",
+		"==================",
+		"WARNING: DATA RACE",
+		"Write at 0x00c000120000 by goroutine 7:",
+		"  main.main.func1()",
+		"==================",
+		"info\tEverything is ready.",
+		"==================",
+		"WARNING: DATA RACE",
+		"Read at 0x00c000120008 by goroutine 9:",
+	}, "\n")
+	assert.Equal(t, []string{
+		"WARNING: DATA RACE\nWrite at 0x00c000120000 by goroutine 7:\n  main.main.func1()",
+		"WARNING: DATA RACE\nRead at 0x00c000120008 by goroutine 9:",
+	}, findRaceReports(logs))
+	assert.Empty(t, findRaceReports("info\tEverything is ready.\n"))
+
+	s := &E2EStorageIntegration{collectorLogs: &syncBuffer{}}
+	_, err := s.collectorLogs.Write([]byte("info\tEverything is ready.\n"))
+	require.NoError(t, err)
+	assert.True(t, s.assertNoDataRace(t))
+}
+
+func TestWaitForPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	readyPort := listener.Addr().(*net.TCPAddr).Port
+
+	require.NoError(t, waitForPorts(nil, time.Second, readyPort))
+
+	err = waitForPorts(nil, 200*time.Millisecond, readyPort, getFreePort(t))
+	require.ErrorContains(t, err, "timed out waiting for localhost:")
+
+	exited := make(chan struct{})
+	close(exited)
+	start := time.Now()
+	err = waitForPorts(exited, time.Minute, getFreePort(t))
+	require.ErrorIs(t, err, errProcessExited)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWaitForPortsFree(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	busyPort := listener.Addr().(*net.TCPAddr).Port
+
+	err = waitForPortsFree(200*time.Millisecond, getFreePort(t), busyPort)
+	require.ErrorContains(t, err, "to be released")
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		listener.Close()
+	}()
+	require.NoError(t, waitForPortsFree(5*time.Second, busyPort))
+}
+
+func TestStopProcess(t *testing.T) {
+	t.Run("exits on SIGTERM", func(t *testing.T) {
+		p, err := startProcess(exec.Command("sleep", "60"))
+		require.NoError(t, err)
+		start := time.Now()
+		require.NoError(t, p.stop(5*time.Second))
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.True(t, p.hasExited())
+	})
+	t.Run("killed after grace period", func(t *testing.T) {
+		p, err := startProcess(exec.Command("sh", "-c", `trap "" TERM; while true; do sleep 0.1; done`))
+		require.NoError(t, err)
+		// give the shell time to install the trap
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, p.stop(200*time.Millisecond))
+		assert.True(t, p.hasExited())
+	})
+	t.Run("already exited", func(t *testing.T) {
+		p, err := startProcess(exec.Command("true"))
+		require.NoError(t, err)
+		<-p.exited
+		require.NoError(t, p.stop(time.Second))
+		require.NoError(t, p.kill())
+	})
+}
+
+func TestLaunchCollectorExitsEarly(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("receivers: {otlp: {protocols: {grpc:}}}\nservice: {}\n"), 0o600))
+	// the stub rejects the config like the collector does when it fails to unmarshal it
+	stub := filepath.Join(dir, "stub-jaeger")
+	script := "#!/bin/sh\necho \"Error: failed to get config: cannot unmarshal the configuration\" >&2\nexit 3\n"
+	require.NoError(t, os.WriteFile(stub, []byte(script), 0o700))
+
+	s := &E2EStorageIntegration{
+		BinaryPath:     stub,
+		WorkingDir:     dir,
+		StartupTimeout: time.Minute,
+		otlpPort:       getFreePort(t),
+		QueryGRPCPort:  getFreePort(t),
+		configFile:     configFile,
+		collectorLogs:  &syncBuffer{},
+	}
+	start := time.Now()
+	err := s.launchCollector()
+	require.ErrorContains(t, err, "collector exited with code 3")
+	require.ErrorContains(t, err, "cannot unmarshal the configuration")
+	assert.Less(t, time.Since(start), 10*time.Second)
+	require.NoError(t, s.collector.stop(time.Second))
+}
+
+func TestCreateStorageCleanerConfigPreservesCleaner(t *testing.T) {
+	baseConfig := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(baseConfig, []byte(`
+service:
+  extensions: [jaeger_storage, jaeger_query, storage_cleaner]
+extensions:
+  jaeger_query:
+    trace_storage: main
+  storage_cleaner:
+    port: "9999"
+    auth_token: secret
+receivers:
+  otlp:
+    protocols:
+      grpc:
+`), 0o600))
+
+	s := &E2EStorageIntegration{ConfigFile: baseConfig}
+	s.SkipArchiveTest = true
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+
+	service := config["service"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"jaeger_storage", "jaeger_query", "storage_cleaner"}, service["extensions"])
+	extensions := config["extensions"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"trace_storage": "main",
+		"port":          "9999",
+		"auth_token":    "secret",
+	}, extensions["storage_cleaner"])
+	assert.Equal(t, "http://localhost:9999", s.storageCleanerEndpoint)
+	assert.Equal(t, "secret", s.storageCleaner().AuthToken)
+}
+
+func TestStorageCleanerEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		cleaner  string
+		expected string
+	}{
+		{name: "default", cleaner: "{}", expected: "http://localhost:9231"},
+		{name: "port", cleaner: `{port: "9999"}`, expected: "http://localhost:9999"},
+		{name: "all interfaces", cleaner: `{endpoint: ":9998"}`, expected: "http://localhost:9998"},
+		{name: "host", cleaner: `{endpoint: "127.0.0.1:9998"}`, expected: "http://127.0.0.1:9998"},
+		{name: "path prefix", cleaner: `{path_prefix: /cleaner/}`, expected: "http://localhost:9231/cleaner"},
+		{name: "tls", cleaner: `{tls: {enabled: true, cert: cert.pem, key: key.pem}}`, expected: "https://localhost:9231"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config map[string]interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(`
+extensions:
+  jaeger_query:
+    trace_storage: main
+  storage_cleaner: `+test.cleaner+`
+receivers:
+  otlp:
+    protocols:
+      grpc:
+`), &config))
+			s := &E2EStorageIntegration{}
+			s.SkipArchiveTest = true
+			require.NoError(t, s.editConfig(config))
+			assert.Equal(t, test.expected, s.storageCleanerEndpoint)
+		})
+	}
+}
+
+func TestCreateStorageCleanerConfigEnvStorage(t *testing.T) {
+	t.Setenv("E2E_TRACE_STORAGE", "main")
+	t.Setenv("E2E_ARCHIVE_STORAGE", "archive")
+	baseConfig := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(baseConfig, []byte(`
+service:
+  extensions: [jaeger_storage, jaeger_query]
+  pipelines:
+    traces:
+      receivers: [otlp]
+      exporters: [jaeger_storage_exporter]
+extensions:
+  jaeger_query:
+    trace_storage: ${env:E2E_TRACE_STORAGE}
+    trace_storage_archive: ${E2E_ARCHIVE_STORAGE}
+receivers:
+  otlp:
+    protocols:
+      grpc:
+`), 0o600))
+
+	s := &E2EStorageIntegration{ConfigFile: baseConfig}
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+
+	extensions := config["extensions"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"trace_storage": "main"}, extensions["storage_cleaner"])
+	exporters := config["exporters"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"trace_storage": "archive"}, exporters["jaeger_storage_exporter/archive"])
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("E2E_HOST", "elasticsearch")
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "main", expected: "main"},
+		{value: "${env:E2E_HOST}", expected: "elasticsearch"},
+		{value: "${E2E_HOST}", expected: "elasticsearch"},
+		{value: "http://${env:E2E_HOST}:9200", expected: "http://elasticsearch:9200"},
+		{value: "${env:E2E_UNSET_VARIABLE}", expected: ""},
+		{value: "$E2E_HOST", expected: "$E2E_HOST"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			assert.Equal(t, test.expected, expandEnv(test.value))
+		})
+	}
+}
+
+func TestCreateStorageCleanerConfigExtraExtensions(t *testing.T) {
+	baseConfig := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(baseConfig, []byte(`
+service:
+  extensions: [jaeger_storage, jaeger_query, zpages]
+extensions:
+  jaeger_query:
+    trace_storage: main
+  zpages:
+    endpoint: localhost:55680
+receivers:
+  otlp:
+    protocols:
+      grpc:
+`), 0o600))
+
+	s := &E2EStorageIntegration{
+		ConfigFile:      baseConfig,
+		ExtraExtensions: []string{"zpages", "memory_ballast/custom", "memory_ballast/custom"},
+	}
+	s.SkipArchiveTest = true
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+
+	service := config["service"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		"jaeger_storage", "jaeger_query", "zpages", "storage_cleaner", "memory_ballast/custom",
+	}, service["extensions"])
+	extensions := config["extensions"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"endpoint": "localhost:55680"}, extensions["zpages"])
+	assert.Equal(t, map[string]interface{}{}, extensions["memory_ballast/custom"])
+}
+
+func TestCreateStorageCleanerConfigMultipleQueryExtensions(t *testing.T) {
+	baseConfig := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(baseConfig, []byte(`
+service:
+  extensions: [jaeger_storage, jaeger_query/tenantA, jaeger_query/tenantB]
+extensions:
+  jaeger_query/tenantA:
+    trace_storage: storageA
+  jaeger_query/tenantB:
+    trace_storage: storageB
+receivers:
+  otlp:
+    protocols:
+      grpc:
+`), 0o600))
+
+	s := &E2EStorageIntegration{
+		ConfigFile:     baseConfig,
+		QueryExtension: "jaeger_query/tenantB",
+	}
+	s.SkipArchiveTest = true
+	config := readConfig(t, s.createStorageCleanerConfig(t))
+	extensions := config["extensions"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"trace_storage": "storageB"}, extensions["storage_cleaner"])
+}
+
+func TestFindQueryTraceStorage(t *testing.T) {
+	extensions := map[string]interface{}{
+		"jaeger_query/tenantA": map[string]interface{}{"trace_storage": "storageA"},
+		"jaeger_query/tenantB": map[string]interface{}{"trace_storage": "storageB"},
+		"jaeger_query/broken":  map[string]interface{}{},
+		"jaeger_storage":       map[string]interface{}{},
+	}
+	tests := []struct {
+		name        string
+		extensions  map[string]interface{}
+		query       string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:       "single default extension",
+			extensions: map[string]interface{}{"jaeger_query": map[string]interface{}{"trace_storage": "main"}},
+			expected:   "main",
+		},
+		{
+			name:       "single named extension",
+			extensions: map[string]interface{}{"jaeger_query/tenantA": extensions["jaeger_query/tenantA"]},
+			expected:   "storageA",
+		},
+		{
+			name:       "explicit extension",
+			extensions: extensions,
+			query:      "jaeger_query/tenantA",
+			expected:   "storageA",
+		},
+		{
+			name:        "ambiguous",
+			extensions:  extensions,
+			expectedErr: "ambiguous jaeger_query extensions [jaeger_query/broken jaeger_query/tenantA jaeger_query/tenantB]",
+		},
+		{
+			name:        "none",
+			extensions:  map[string]interface{}{},
+			expectedErr: "no jaeger_query extension found",
+		},
+		{
+			name:        "unknown extension",
+			extensions:  extensions,
+			query:       "jaeger_query/tenantC",
+			expectedErr: "extension jaeger_query/tenantC not found",
+		},
+		{
+			name:        "missing trace storage",
+			extensions:  extensions,
+			query:       "jaeger_query/broken",
+			expectedErr: "extension jaeger_query/broken has no trace_storage",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			traceStorage, err := findQueryTraceStorage(test.extensions, test.query)
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, traceStorage)
+		})
+	}
+}
+
+func TestCollectorCommand(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "args.txt")
+	stub := filepath.Join(dir, "stub-jaeger")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$(pwd) $@\" > %s\n", output)
+	require.NoError(t, os.WriteFile(stub, []byte(script), 0o700))
+
+	t.Run("defaults", func(t *testing.T) {
+		s := &E2EStorageIntegration{}
+		cmd, err := s.collectorCommand()
+		require.NoError(t, err)
+		root, err := filepath.Abs(defaultWorkingDir)
+		require.NoError(t, err)
+		assert.Equal(t, root, cmd.Dir)
+		assert.Equal(t, filepath.Join(root, "cmd", "jaeger", "jaeger"), cmd.Path)
+	})
+	t.Run("relative binary path", func(t *testing.T) {
+		s := &E2EStorageIntegration{BinaryPath: "stub-jaeger", WorkingDir: dir}
+		cmd, err := s.collectorCommand()
+		require.NoError(t, err)
+		assert.Equal(t, stub, cmd.Path)
+	})
+	t.Run("race build path", func(t *testing.T) {
+		s := &E2EStorageIntegration{BinaryPath: "jaeger", RaceBuildPath: "stub-jaeger", WorkingDir: dir}
+		cmd, err := s.collectorCommand()
+		require.NoError(t, err)
+		assert.Equal(t, stub, cmd.Path)
+	})
+	t.Run("runs stub binary", func(t *testing.T) {
+		s := &E2EStorageIntegration{BinaryPath: stub, WorkingDir: dir, configFile: "config.yaml", collectorLogs: &syncBuffer{}}
+		cmd, err := s.collectorCommand()
+		require.NoError(t, err)
+		require.NoError(t, cmd.Run())
+		args, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, dir+" --config config.yaml\n", string(args))
+	})
+	t.Run("feature gates", func(t *testing.T) {
+		s := &E2EStorageIntegration{
+			BinaryPath:    stub,
+			WorkingDir:    dir,
+			FeatureGates:  []string{"foo.bar", "-baz"},
+			configFile:    "config.yaml",
+			collectorLogs: &syncBuffer{},
+		}
+		cmd, err := s.collectorCommand()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"jaeger", "--config", "config.yaml", "--feature-gates=foo.bar,-baz"}, cmd.Args)
+		require.NoError(t, cmd.Run())
+		args, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, dir+" --config config.yaml --feature-gates=foo.bar,-baz\n", string(args))
+	})
+}
+
+func TestLaunchCollectorInvalidConfig(t *testing.T) {
+	s := &E2EStorageIntegration{StartupTimeout: time.Minute, collectorLogs: &syncBuffer{}}
+	cmd, err := s.collectorCommand()
+	require.NoError(t, err)
+	if _, err := os.Stat(cmd.Path); err != nil {
+		t.Skipf("collector binary not built: %v", err)
+	}
+	s.configFile = filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(s.configFile, []byte(`
+receivers:
+  otlp:
+    protocols:
+      grpc:
+exporters:
+  debug:
+service:
+  pipelines:
+    traces:
+      receivers: [otlp, missing]
+      exporters: [debug]
+`), 0o600))
+	s.otlpPort = getFreePort(t)
+	s.QueryGRPCPort = getFreePort(t)
+
+	start := time.Now()
+	err = s.launchCollector()
+	require.ErrorContains(t, err, "collector exited with code 1")
+	require.ErrorContains(t, err, `references receiver "missing" which is not configured`)
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestCreateHTTPSpanWriter(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	writer, err := createHTTPSpanWriter(zap.NewNop(), port)
+	require.NoError(t, err)
+	defer writer.Close()
+	writer.latencies = &latencyRecorder{}
+	span := &model.Span{
+		TraceID:       model.NewTraceID(1, 2),
+		SpanID:        model.NewSpanID(3),
+		OperationName: "operation",
+		StartTime:     time.Now(),
+		Process:       model.NewProcess("service", nil),
+	}
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+	r := <-requests
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "/v1/traces", r.URL.Path)
+	assert.Equal(t, 1, writer.latencies.stats().Count)
+}
+
+func TestKeepalive(t *testing.T) {
+	ka := &configgrpc.KeepaliveClientConfig{
+		Time:                10 * time.Second,
+		Timeout:             time.Second,
+		PermitWithoutStream: true,
+	}
+
+	cfg := otlpExporterConfig(otlpexporter.NewFactory(), 4317, ka)
+	require.NoError(t, component.ValidateConfig(cfg))
+	assert.Equal(t, ka, cfg.Keepalive)
+	assert.Nil(t, otlpExporterConfig(otlpexporter.NewFactory(), 4317, nil).Keepalive)
+
+	assert.Equal(t, keepalive.ClientParameters{
+		Time:                10 * time.Second,
+		Timeout:             time.Second,
+		PermitWithoutStream: true,
+	}, keepaliveParams(ka))
+	assert.Len(t, readerDialOptions(ka), len(readerDialOptions(nil))+1)
+
+	// the server accepts the pings of the aggressive keepalive
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             time.Second,
+		PermitWithoutStream: true,
+	}))
+	api_v2.RegisterQueryServiceServer(server, &boundedQueryServer{store: memory.NewStore()})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	reader, err := createSpanReader(listener.Addr().(*net.TCPAddr).Port, ka)
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = reader.GetTrace(context.Background(), model.NewTraceID(1, 1))
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+}
+
+func TestWriteLatencyStats(t *testing.T) {
+	s := &E2EStorageIntegration{}
+	assert.Equal(t, LatencyStats{}, s.WriteLatencyStats())
+
+	s.writeLatencies = &latencyRecorder{}
+	// 1ms to 100ms, recorded out of order
+	for i := 100; i >= 1; i-- {
+		s.writeLatencies.record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, LatencyStats{
+		Count: 100,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}, s.WriteLatencyStats())
+
+	s.writeLatencies = &latencyRecorder{}
+	s.writeLatencies.record(7 * time.Millisecond)
+	assert.Equal(t, LatencyStats{
+		Count: 1,
+		P50:   7 * time.Millisecond,
+		P95:   7 * time.Millisecond,
+		P99:   7 * time.Millisecond,
+	}, s.WriteLatencyStats())
+}
+
+// fakeSchemaProbe reports the schema as missing for the first notReady calls.
+type fakeSchemaProbe struct {
+	notReady int
+	calls    int
+}
+
+func (p *fakeSchemaProbe) probe(context.Context) error {
+	p.calls++
+	if p.calls <= p.notReady {
+		return errors.New("index not found")
+	}
+	return nil
+}
+
+func TestEnsureSchema(t *testing.T) {
+	probe := &fakeSchemaProbe{notReady: 2}
+	s := &E2EStorageIntegration{SchemaProbe: probe.probe, StartupTimeout: 5 * time.Second}
+	s.EnsureSchema(t)
+	assert.Equal(t, 3, probe.calls)
+
+	// no-op for backends without a schema probe
+	(&E2EStorageIntegration{}).EnsureSchema(t)
+}
+
+func TestWaitForSchemaTimeout(t *testing.T) {
+	probe := &fakeSchemaProbe{notReady: math.MaxInt}
+	err := waitForSchema(probe.probe, 200*time.Millisecond)
+	require.ErrorContains(t, err, "timed out waiting for schema: index not found")
+	assert.Greater(t, probe.calls, 1)
+}
+
+func TestHTTPSchemaProbe(t *testing.T) {
+	var ready atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_template/jaeger-span" || ready.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	probe := HTTPSchemaProbe(server.URL+"/_template/jaeger-span", server.URL+"/_template/jaeger-service")
+	require.ErrorContains(t, probe(context.Background()), "/_template/jaeger-service responded with 404 Not Found")
+	ready.Store(true)
+	require.NoError(t, probe(context.Background()))
+
+	require.Error(t, HTTPSchemaProbe("://invalid")(context.Background()))
+	server.Close()
+	require.Error(t, probe(context.Background()))
+}
+
+// delayedReader hides traces until visibleAt,
+// like a backend with a refresh interval.
+type delayedReader struct {
+	spanstore.Reader
+	visibleAt time.Time
+	calls     int
+}
+
+func (r *delayedReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	r.calls++
+	if time.Now().Before(r.visibleAt) {
+		return nil, spanstore.ErrTraceNotFound
+	}
+	return r.Reader.GetTrace(ctx, traceID)
+}
+
+func TestWaitForSpan(t *testing.T) {
+	store := memory.NewStore()
+	traceID := model.NewTraceID(1, 2)
+	require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+		TraceID: traceID,
+		SpanID:  model.NewSpanID(1),
+		Process: model.NewProcess("service", nil),
+	}))
+
+	t.Run("immediately visible", func(t *testing.T) {
+		s := &E2EStorageIntegration{}
+		s.SpanReader = store
+		trace := s.WaitForSpan(t, traceID, time.Second)
+		assert.Len(t, trace.Spans, 1)
+	})
+	t.Run("delayed visibility", func(t *testing.T) {
+		reader := &delayedReader{Reader: store, visibleAt: time.Now().Add(100 * time.Millisecond)}
+		s := &E2EStorageIntegration{}
+		s.SpanReader = reader
+		trace := s.WaitForSpan(t, traceID, 5*time.Second)
+		assert.Len(t, trace.Spans, 1)
+		assert.Greater(t, reader.calls, 1)
+	})
+	t.Run("times out", func(t *testing.T) {
+		reader := &delayedReader{Reader: store, visibleAt: time.Now().Add(time.Hour)}
+		_, err := waitForTrace(reader, traceID, 100*time.Millisecond)
+		require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	})
+}
+
+// fakeBatchWriter writes the batches into a memory store.
+type fakeBatchWriter struct {
+	store *memory.Store
+	err   error
+
+	mu      sync.Mutex
+	batches []int
+	closed  bool
+}
+
+func (w *fakeBatchWriter) writeSpans(ctx context.Context, spans []*model.Span) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.batches = append(w.batches, len(spans))
+	for _, span := range spans {
+		if err := w.store.WriteSpan(ctx, span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *fakeBatchWriter) batchSizes() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]int(nil), w.batches...)
+}
+
+func (w *fakeBatchWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestBatchingSpanWriter(t *testing.T) {
+	const traces, spansPerTrace = 100, 100
+	fake := &fakeBatchWriter{store: memory.NewStore()}
+	s := &E2EStorageIntegration{}
+	s.SpanWriter = newBatchingSpanWriter(fake, 1000, 0)
+	s.SpanReader = fake.store
+
+	for i := 0; i < traces; i++ {
+		for j := 0; j < spansPerTrace; j++ {
+			require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), &model.Span{
+				TraceID: model.NewTraceID(0, uint64(i+1)),
+				SpanID:  model.NewSpanID(uint64(j + 1)),
+				Process: model.NewProcess("service", nil),
+			}))
+		}
+	}
+	// 10k spans are sent in 10 requests
+	assert.Equal(t, []int{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000}, fake.batchSizes())
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), &model.Span{
+			TraceID: model.NewTraceID(1, 1),
+			SpanID:  model.NewSpanID(uint64(i)),
+			Process: model.NewProcess("service", nil),
+		}))
+	}
+	_, err := fake.store.GetTrace(context.Background(), model.NewTraceID(1, 1))
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound, "spans must be buffered until flushed")
+	s.FlushWriter(t)
+	assert.Len(t, fake.batchSizes(), 11)
+
+	for i := 0; i < traces; i++ {
+		trace, err := s.SpanReader.GetTrace(context.Background(), model.NewTraceID(0, uint64(i+1)))
+		require.NoError(t, err)
+		assert.Len(t, trace.Spans, spansPerTrace)
+	}
+	trace, err := s.SpanReader.GetTrace(context.Background(), model.NewTraceID(1, 1))
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 5)
+
+	require.NoError(t, s.SpanWriter.(io.Closer).Close())
+	assert.True(t, fake.closed)
+}
+
+func TestBatchingSpanWriterFlushInterval(t *testing.T) {
+	fake := &fakeBatchWriter{store: memory.NewStore()}
+	writer := newBatchingSpanWriter(fake, 1000, 10*time.Millisecond)
+	defer writer.Close()
+
+	require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+		TraceID: model.NewTraceID(1, 1),
+		SpanID:  model.NewSpanID(1),
+		Process: model.NewProcess("service", nil),
+	}))
+	assert.Eventually(t, func() bool {
+		return len(fake.batchSizes()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBatchingSpanWriterError(t *testing.T) {
+	fake := &fakeBatchWriter{store: memory.NewStore(), err: errors.New("collector is down")}
+	writer := newBatchingSpanWriter(fake, 2, 0)
+	span := &model.Span{
+		TraceID: model.NewTraceID(1, 1),
+		SpanID:  model.NewSpanID(1),
+		Process: model.NewProcess("service", nil),
+	}
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+	err := writer.WriteSpan(context.Background(), span)
+	require.ErrorContains(t, err, "failed to write a batch of 2 spans: collector is down")
+
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+	require.ErrorContains(t, writer.Close(), "failed to write a batch of 1 spans")
+}
+
+// boundedQueryServer serves the traces of a memory store and, like backends sharded
+// by time, only finds the traces starting within the bounds of GetTrace.
+type boundedQueryServer struct {
+	api_v2.UnimplementedQueryServiceServer
+	store *memory.Store
+	// maxSpanAge, when set, is the lookback of lookups without start time, like the
+	// max_span_age of Elasticsearch.
+	maxSpanAge time.Duration
+}
+
+func (s *boundedQueryServer) GetTrace(r *api_v2.GetTraceRequest, stream api_v2.QueryService_GetTraceServer) error {
+	trace, err := s.store.GetTrace(stream.Context(), r.TraceID)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "trace not found: %v", err)
+	}
+	if r.StartTime == nil && s.maxSpanAge > 0 {
+		start := time.Now().Add(-s.maxSpanAge)
+		r.StartTime = &start
+	}
+	spans := make([]model.Span, 0, len(trace.Spans))
+	for _, span := range trace.Spans {
+		if r.StartTime != nil && span.StartTime.Before(*r.StartTime) {
+			continue
+		}
+		if r.EndTime != nil && span.StartTime.After(*r.EndTime) {
+			continue
+		}
+		spans = append(spans, *span)
+	}
+	if len(spans) == 0 {
+		return status.Errorf(codes.NotFound, "trace not found: %v", spanstore.ErrTraceNotFound)
+	}
+	return stream.Send(&api_v2.SpansResponseChunk{Spans: spans})
+}
+
+func TestGetTraceInRange(t *testing.T) {
+	store := memory.NewStore()
+	yesterday := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	today := yesterday.Add(24 * time.Hour)
+	for i, startTime := range []time.Time{yesterday, today} {
+		require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+			TraceID:   model.NewTraceID(1, uint64(i+1)),
+			SpanID:    model.NewSpanID(1),
+			Process:   model.NewProcess("service", nil),
+			StartTime: startTime,
+		}))
+	}
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	api_v2.RegisterQueryServiceServer(server, &boundedQueryServer{store: store})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	reader, err := createSpanReader(listener.Addr().(*net.TCPAddr).Port, nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	s := &E2EStorageIntegration{}
+	s.SpanReader = reader
+
+	// the bounds only include today
+	start, end := today.Add(-time.Hour), today.Add(time.Hour)
+	trace, err := s.GetTraceInRange(context.Background(), model.NewTraceID(1, 2), start, end)
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, today, trace.Spans[0].StartTime.UTC())
+	_, err = s.GetTraceInRange(context.Background(), model.NewTraceID(1, 1), start, end)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	// unbounded lookups find both traces
+	_, err = s.GetTraceInRange(context.Background(), model.NewTraceID(1, 1), time.Time{}, end)
+	require.NoError(t, err)
+	_, err = s.SpanReader.GetTrace(context.Background(), model.NewTraceID(1, 1))
+	require.NoError(t, err)
+}
+
+func TestGetTraceInRangeFallback(t *testing.T) {
+	store := memory.NewStore()
+	traceID := model.NewTraceID(1, 1)
+	require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+		TraceID:   traceID,
+		SpanID:    model.NewSpanID(1),
+		Process:   model.NewProcess("service", nil),
+		StartTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}))
+	s := &E2EStorageIntegration{}
+	s.SpanReader = store
+
+	// the memory store has no bounded lookup, the bounds are ignored
+	trace, err := s.GetTraceInRange(context.Background(), traceID, time.Now(), time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+}
+
+func TestWriteFixture(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		traceID    model.TraceID
+		services   []string
+		operations []string
+	}{
+		{
+			name:       "OTLP",
+			path:       "testdata/otlp_trace.json",
+			traceID:    model.NewTraceID(0x5b8efff798038103, 0xd269b633813fc60c),
+			services:   []string{"fixture-frontend"},
+			operations: []string{"GET /dispatch", "SQL SELECT"},
+		},
+		{
+			name:       "Jaeger",
+			path:       "testdata/jaeger_trace.json",
+			traceID:    model.NewTraceID(0, 0x13),
+			services:   []string{"fixture-service"},
+			operations: []string{"fixture-operation"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := memory.NewStore()
+			s := &E2EStorageIntegration{}
+			s.SpanWriter = store
+			s.SpanReader = store
+
+			before := time.Now()
+			spans := s.WriteFixture(t, test.path)
+			require.Len(t, spans, len(test.operations))
+
+			trace, err := s.SpanReader.GetTrace(context.Background(), test.traceID)
+			require.NoError(t, err)
+			var operations []string
+			var end time.Time
+			for _, span := range trace.Spans {
+				operations = append(operations, span.OperationName)
+				if spanEnd := span.StartTime.Add(span.Duration); spanEnd.After(end) {
+					end = spanEnd
+				}
+				for _, log := range span.Logs {
+					// the logs are shifted along with their span
+					assert.False(t, log.Timestamp.Before(span.StartTime))
+					assert.False(t, log.Timestamp.After(span.StartTime.Add(span.Duration)))
+				}
+			}
+			assert.ElementsMatch(t, test.operations, operations)
+			// the last span ends when the fixture is written
+			assert.WithinRange(t, end, before.Truncate(time.Microsecond), time.Now())
+
+			services, err := s.SpanReader.GetServices(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.services, services)
+		})
+	}
+}
+
+func TestLoadFixtureErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+	tests := []struct {
+		name        string
+		path        string
+		expectedErr string
+	}{
+		{name: "missing", path: filepath.Join(dir, "missing.json"), expectedErr: "cannot read fixture"},
+		{name: "not JSON", path: write("yaml.json", "spans: []"), expectedErr: "cannot parse fixture"},
+		{name: "malformed OTLP", path: write("otlp.json", `{"resourceSpans": 1}`), expectedErr: "cannot parse fixture"},
+		{name: "malformed Jaeger", path: write("jaeger.json", `{"spans": [{"startTime": "yesterday"}]}`), expectedErr: "cannot parse fixture"},
+		{name: "empty", path: write("empty.json", `{"spans": []}`), expectedErr: "has no spans"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadFixture(test.path, time.Now())
+			require.ErrorContains(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestDefaultLookback(t *testing.T) {
+	store := memory.NewStore()
+	traceID := model.NewTraceID(1, 1)
+	reference := time.Now()
+	fiveDaysAgo := reference.AddDate(0, 0, -5)
+	require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+		TraceID:   traceID,
+		SpanID:    model.NewSpanID(1),
+		Process:   model.NewProcess("service", nil),
+		StartTime: fiveDaysAgo,
+	}))
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	api_v2.RegisterQueryServiceServer(server, &boundedQueryServer{store: store, maxSpanAge: 72 * time.Hour})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	reader, err := createSpanReader(listener.Addr().(*net.TCPAddr).Port, nil)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	// the span is older than the default window of the backend
+	_, err = reader.GetTrace(context.Background(), traceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	reader.lookback = 7 * 24 * time.Hour
+	reader.timeReference = reference
+	trace, err := reader.GetTrace(context.Background(), traceID)
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.True(t, fiveDaysAgo.Equal(trace.Spans[0].StartTime))
+}
+
+// flakyReader fails the first GetServices calls with the given error.
+type flakyReader struct {
+	*memory.Store
+	failures int
+	err      error
+	calls    int
+}
+
+func (r *flakyReader) GetServices(ctx context.Context) ([]string, error) {
+	r.calls++
+	if r.calls <= r.failures {
+		return nil, r.err
+	}
+	return r.Store.GetServices(ctx)
+}
+
+func TestRetryingSpanReader(t *testing.T) {
+	policy := ReadRetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		expectedErr error
+		calls       int
+	}{
+		{
+			name:     "fails once then succeeds",
+			failures: 1,
+			err:      unavailable,
+			calls:    2,
+		},
+		{
+			name:        "runs out of attempts",
+			failures:    3,
+			err:         unavailable,
+			expectedErr: unavailable,
+			calls:       3,
+		},
+		{
+			name:        "not retryable",
+			failures:    1,
+			err:         status.Error(codes.InvalidArgument, "bad query"),
+			expectedErr: status.Error(codes.InvalidArgument, "bad query"),
+			calls:       1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := memory.NewStore()
+			require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+				TraceID: model.NewTraceID(1, 1),
+				SpanID:  model.NewSpanID(1),
+				Process: model.NewProcess("service", nil),
+			}))
+			flaky := &flakyReader{Store: store, failures: test.failures, err: test.err}
+			reader := newRetryingSpanReader(flaky, policy)
+
+			services, err := reader.GetServices(context.Background())
+			if test.expectedErr != nil {
+				require.Equal(t, test.expectedErr.Error(), err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"service"}, services)
+			}
+			assert.Equal(t, test.calls, flaky.calls)
+		})
+	}
+}
+
+func TestRetryingSpanReaderDefaults(t *testing.T) {
+	reader := newRetryingSpanReader(memory.NewStore(), ReadRetryPolicy{})
+	assert.Equal(t, ReadRetryPolicy{
+		MaxAttempts:    defaultReadAttempts,
+		Backoff:        defaultReadBackoff,
+		RetryableCodes: []codes.Code{codes.Unavailable},
+	}, reader.policy)
+	// the memory store has no bounded lookup, nor anything to close
+	_, err := reader.GetTraceInRange(context.Background(), model.NewTraceID(1, 1), time.Now(), time.Time{})
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	require.NoError(t, reader.Close())
+}
+
+func TestRetryingSpanReaderCancelled(t *testing.T) {
+	flaky := &flakyReader{Store: memory.NewStore(), failures: 10, err: status.Error(codes.Unavailable, "")}
+	reader := newRetryingSpanReader(flaky, ReadRetryPolicy{MaxAttempts: 10, Backoff: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := reader.GetServices(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestSkipCollectorStart(t *testing.T) {
+	// an OTLP/HTTP receiver and a query service stand in for a pre-started collector
+	received := make(chan struct{}, 1)
+	otlp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		received <- struct{}{}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer otlp.Close()
+	store := memory.NewStore()
+	traceID := model.NewTraceID(1, 1)
+	require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+		TraceID:   traceID,
+		SpanID:    model.NewSpanID(1),
+		Process:   model.NewProcess("service", nil),
+		StartTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}))
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	api_v2.RegisterQueryServiceServer(server, &boundedQueryServer{store: store})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	s := &E2EStorageIntegration{
+		// the collector binary is never looked up
+		BinaryPath:         "does-not-exist",
+		SkipCollectorStart: true,
+		UseOTLPHTTP:        true,
+		ExistingOTLPPort:   otlp.Listener.Addr().(*net.TCPAddr).Port,
+		ExistingQueryPort:  listener.Addr().(*net.TCPAddr).Port,
+		StorageIntegration: integration.StorageIntegration{
+			SkipArchiveTest: true,
+		},
+	}
+	s.e2eInitialize(t)
+	defer s.e2eCleanUp(t)
+
+	require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), &model.Span{
+		TraceID:   model.NewTraceID(2, 2),
+		SpanID:    model.NewSpanID(2),
+		Process:   model.NewProcess("service", nil),
+		StartTime: time.Now(),
+	}))
+	<-received
+	trace, err := s.SpanReader.GetTrace(context.Background(), traceID)
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+	assert.Empty(t, s.CollectorLogs())
+}
+
+func TestWritePortsFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        *E2EStorageIntegration
+		expected string
+	}{
+		{
+			name:     "without archive",
+			s:        &E2EStorageIntegration{otlpPort: 4317, QueryGRPCPort: 16685},
+			expected: `{"otlp":4317,"query_grpc":16685}`,
+		},
+		{
+			name:     "with archive",
+			s:        &E2EStorageIntegration{otlpPort: 4317, QueryGRPCPort: 16685, archiveOTLPPort: 4318},
+			expected: `{"otlp":4317,"query_grpc":16685,"archive_otlp":4318}`,
+		},
+		{
+			name:     "with otlp http",
+			s:        &E2EStorageIntegration{otlpPort: 4317, otlpHTTPPort: 4318, QueryGRPCPort: 16685},
+			expected: `{"otlp":4317,"otlp_http":4318,"query_grpc":16685}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.s.PortsFile = filepath.Join(t.TempDir(), "ports.json")
+			require.NoError(t, test.s.writePortsFile())
+			data, err := os.ReadFile(test.s.PortsFile)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(data))
+
+			var ports collectorPorts
+			require.NoError(t, json.Unmarshal(data, &ports))
+			assert.Equal(t, test.s.otlpPort, ports.OTLP)
+			assert.Equal(t, test.s.QueryGRPCPort, ports.QueryGRPC)
+		})
+	}
+	s := &E2EStorageIntegration{PortsFile: filepath.Join(t.TempDir(), "missing", "ports.json")}
+	require.ErrorContains(t, s.writePortsFile(), "cannot write ports file")
+}
+
+func TestPurgeAndVerifyEmpty(t *testing.T) {
+	f := memory.NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	writer, err := f.CreateSpanWriter()
+	require.NoError(t, err)
+	reader, err := f.CreateSpanReader()
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+			TraceID:   model.NewTraceID(1, uint64(i+1)),
+			SpanID:    model.NewSpanID(1),
+			Process:   model.NewProcess(fmt.Sprintf("service-%d", i), nil),
+			StartTime: time.Now().AddDate(0, 0, -2),
+		}))
+	}
+	// like eventually-consistent backends, the deletion is applied after the response
+	cleaner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, storagecleaner.URL, r.URL.Path)
+		time.AfterFunc(50*time.Millisecond, func() {
+			assert.NoError(t, f.Purge(context.Background()))
+		})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer cleaner.Close()
+
+	s := &E2EStorageIntegration{storageCleanerEndpoint: cleaner.URL}
+	s.SpanReader = reader
+	require.Error(t, findRemainingTraces(reader, time.Now().AddDate(0, 0, -7), time.Now()))
+	s.PurgeAndVerifyEmpty(t)
+	services, err := reader.GetServices(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+// fakeStorageExt serves a single factory as the jaegerstorage extension.
+type fakeStorageExt struct {
+	component.StartFunc
+	component.ShutdownFunc
+	name    string
+	factory storage.Factory
+}
+
+func (e *fakeStorageExt) Factory(name string) (storage.Factory, bool) {
+	return e.factory, name == e.name
+}
+
+// purgeOnlyFactory only supports the full purge.
+type purgeOnlyFactory struct {
+	factoryMocks.Factory
+}
+
+func (*purgeOnlyFactory) Purge(context.Context) error {
+	return nil
+}
+
+func TestSupportsCapability(t *testing.T) {
+	port := getFreePort(t)
+	config := &storagecleaner.Config{TraceStorage: "storage", Port: strconv.Itoa(port)}
+	require.NoError(t, config.Validate())
+	cleaner, err := storagecleaner.NewFactory().CreateExtension(context.Background(), extensiontest.NewNopCreateSettings(), config)
+	require.NoError(t, err)
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &fakeStorageExt{
+		name:    "storage",
+		factory: &purgeOnlyFactory{},
+	})
+	require.NoError(t, cleaner.Start(context.Background(), host))
+	defer func() {
+		require.NoError(t, cleaner.Shutdown(context.Background()))
+	}()
+	require.NoError(t, waitForPorts(nil, 5*time.Second, port))
+
+	s := &E2EStorageIntegration{storageCleanerEndpoint: fmt.Sprintf("http://localhost:%d", port)}
+	assert.True(t, s.SupportsCapability(t, storagecleaner.CapabilityPurge))
+	assert.False(t, s.SupportsCapability(t, storagecleaner.CapabilityRangePurge))
+	assert.False(t, s.SupportsCapability(t, storagecleaner.CapabilityTracePurge))
+}
+
+func TestWaitForEmptyTimeout(t *testing.T) {
+	store := memory.NewStore()
+	require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+		TraceID:   model.NewTraceID(1, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   model.NewProcess("service", nil),
+		StartTime: time.Now(),
+	}))
+	err := waitForEmpty(store, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 50*time.Millisecond)
+	require.ErrorContains(t, err, "timed out waiting for the storage to be empty: service service still has traces")
+}
+
+func TestCountTraces(t *testing.T) {
+	store := memory.NewStore()
+	const traces, spansPerTrace = 3, 4
+	for i := 0; i < traces; i++ {
+		for j := 0; j < spansPerTrace; j++ {
+			// the spans of a trace belong to two services, the trace is only counted once
+			require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+				TraceID:   model.NewTraceID(1, uint64(i+1)),
+				SpanID:    model.NewSpanID(uint64(j + 1)),
+				Process:   model.NewProcess(fmt.Sprintf("service-%d", j%2), nil),
+				StartTime: time.Now().Add(-time.Hour),
+			}))
+		}
+	}
+	// too old to be found
+	require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+		TraceID:   model.NewTraceID(2, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   model.NewProcess("service-0", nil),
+		StartTime: time.Now().AddDate(0, 0, -30),
+	}))
+	s := &E2EStorageIntegration{}
+	s.SpanReader = store
+	assert.EqualValues(t, traces, s.CountTraces(t))
+	assert.EqualValues(t, traces*spansPerTrace, s.CountSpans(t))
+
+	s.TraceCounter = func(context.Context) (int64, int64, error) {
+		return 4, 13, nil
+	}
+	assert.EqualValues(t, 4, s.CountTraces(t))
+	assert.EqualValues(t, 13, s.CountSpans(t))
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Command purge removes all data from the storages of a collector configuration
+// in-process, without starting a collector, e.g. in CI teardown steps:
+//
+//	go run ./cmd/jaeger/internal/integration/purge --config config.yaml
+package main
+
+import (
+	"log"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/integration/storagecleaner"
+)
+
+func main() {
+	if err := storagecleaner.Command().Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
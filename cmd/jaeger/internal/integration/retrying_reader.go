@@ -0,0 +1,149 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+const (
+	defaultReadAttempts = 5
+	defaultReadBackoff  = 100 * time.Millisecond
+)
+
+var (
+	_ spanstore.Reader       = (*retryingSpanReader)(nil)
+	_ dependencystore.Reader = (*retryingSpanReader)(nil)
+	_ io.Closer              = (*retryingSpanReader)(nil)
+)
+
+// ReadRetryPolicy defines how the SpanReader retries the reads failing with a transient
+// gRPC error, e.g. while the backend warms up or the collector restarts.
+type ReadRetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per read, defaults to defaultReadAttempts.
+	// Setting it to 1 disables retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled after each attempt,
+	// defaults to defaultReadBackoff.
+	Backoff time.Duration
+	// RetryableCodes are the gRPC status codes of the errors worth retrying,
+	// defaults to codes.Unavailable.
+	RetryableCodes []codes.Code
+}
+
+func (p ReadRetryPolicy) withDefaults() ReadRetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultReadAttempts
+	}
+	if p.Backoff == 0 {
+		p.Backoff = defaultReadBackoff
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = []codes.Code{codes.Unavailable}
+	}
+	return p
+}
+
+// traceReader is the subset of spanReader wrapped by retryingSpanReader.
+type traceReader interface {
+	spanstore.Reader
+	dependencystore.Reader
+}
+
+// retryingSpanReader retries the reads of the wrapped reader according to a ReadRetryPolicy,
+// so that the tests of StorageIntegration are not aware of brief reconnections.
+type retryingSpanReader struct {
+	reader traceReader
+	policy ReadRetryPolicy
+}
+
+func newRetryingSpanReader(reader traceReader, policy ReadRetryPolicy) *retryingSpanReader {
+	return &retryingSpanReader{reader: reader, policy: policy.withDefaults()}
+}
+
+// retryRead calls read until it succeeds, fails with an error whose code is not
+// retryable, runs out of attempts or ctx is done.
+func retryRead[T any](ctx context.Context, policy ReadRetryPolicy, read func() (T, error)) (T, error) {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		result, err := read()
+		if err == nil || attempt >= policy.MaxAttempts || !slices.Contains(policy.RetryableCodes, status.Code(err)) {
+			return result, err
+		}
+		select {
+		case <-ctx.Done():
+			return result, errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (r *retryingSpanReader) Close() error {
+	if closer, ok := r.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (r *retryingSpanReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return retryRead(ctx, r.policy, func() (*model.Trace, error) {
+		return r.reader.GetTrace(ctx, traceID)
+	})
+}
+
+// GetTraceInRange retries spanReader.GetTraceInRange, it falls back to GetTrace
+// when the wrapped reader does not support bounded lookups.
+func (r *retryingSpanReader) GetTraceInRange(ctx context.Context, traceID model.TraceID, start, end time.Time) (*model.Trace, error) {
+	reader, ok := r.reader.(interface {
+		GetTraceInRange(ctx context.Context, traceID model.TraceID, start, end time.Time) (*model.Trace, error)
+	})
+	if !ok {
+		return r.GetTrace(ctx, traceID)
+	}
+	return retryRead(ctx, r.policy, func() (*model.Trace, error) {
+		return reader.GetTraceInRange(ctx, traceID, start, end)
+	})
+}
+
+func (r *retryingSpanReader) GetServices(ctx context.Context) ([]string, error) {
+	return retryRead(ctx, r.policy, func() ([]string, error) {
+		return r.reader.GetServices(ctx)
+	})
+}
+
+func (r *retryingSpanReader) GetOperations(ctx context.Context, query spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return retryRead(ctx, r.policy, func() ([]spanstore.Operation, error) {
+		return r.reader.GetOperations(ctx, query)
+	})
+}
+
+func (r *retryingSpanReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return retryRead(ctx, r.policy, func() ([]*model.Trace, error) {
+		return r.reader.FindTraces(ctx, query)
+	})
+}
+
+func (r *retryingSpanReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return retryRead(ctx, r.policy, func() ([]model.TraceID, error) {
+		return r.reader.FindTraceIDs(ctx, query)
+	})
+}
+
+func (r *retryingSpanReader) GetDependencies(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	return retryRead(ctx, r.policy, func() ([]model.DependencyLink, error) {
+		return r.reader.GetDependencies(ctx, endTs, lookback)
+	})
+}
@@ -12,32 +12,39 @@ import (
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/collector/config/configgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/status"
 
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/ports"
 	"github.com/jaegertracing/jaeger/proto-gen/api_v2"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
 var (
-	_ spanstore.Reader = (*spanReader)(nil)
-	_ io.Closer        = (*spanReader)(nil)
+	_ spanstore.Reader       = (*spanReader)(nil)
+	_ dependencystore.Reader = (*spanReader)(nil)
+	_ io.Closer              = (*spanReader)(nil)
 )
 
 // SpanReader retrieve span data from Jaeger-v2 query with api_v2.QueryServiceClient.
 type spanReader struct {
 	clientConn *grpc.ClientConn
 	client     api_v2.QueryServiceClient
+	// lookback, when set, bounds the lookups and searches without explicit time range
+	// to the lookback preceding timeReference, instead of the default window of the backend.
+	lookback      time.Duration
+	timeReference time.Time
 }
 
-func createSpanReader(port int) (*spanReader, error) {
-	opts := []grpc.DialOption{
-		grpc.WithBlock(),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	}
+// createSpanReader connects to the query service gRPC endpoint,
+// with the gRPC defaults for keepalive when it is nil.
+func createSpanReader(port int, keepalive *configgrpc.KeepaliveClientConfig) (*spanReader, error) {
+	opts := readerDialOptions(keepalive)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -53,6 +60,27 @@ func createSpanReader(port int) (*spanReader, error) {
 	}, nil
 }
 
+func readerDialOptions(ka *configgrpc.KeepaliveClientConfig) []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if ka != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(keepaliveParams(ka)))
+	}
+	return opts
+}
+
+// keepaliveParams converts the keepalive settings of the collector's gRPC clients
+// into their grpc-go counterpart, as configgrpc does for the OTLP exporter.
+func keepaliveParams(ka *configgrpc.KeepaliveClientConfig) keepalive.ClientParameters {
+	return keepalive.ClientParameters{
+		Time:                ka.Time,
+		Timeout:             ka.Timeout,
+		PermitWithoutStream: ka.PermitWithoutStream,
+	}
+}
+
 func (r *spanReader) Close() error {
 	return r.clientConn.Close()
 }
@@ -67,9 +95,43 @@ func unwrapNotFoundErr(err error) error {
 }
 
 func (r *spanReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
-	stream, err := r.client.GetTrace(ctx, &api_v2.GetTraceRequest{
+	req := &api_v2.GetTraceRequest{
 		TraceID: traceID,
-	})
+	}
+	if r.lookback > 0 {
+		start := r.lookbackStart()
+		req.StartTime = &start
+	}
+	return r.getTrace(ctx, req)
+}
+
+// lookbackStart returns the beginning of the default search window.
+func (r *spanReader) lookbackStart() time.Time {
+	reference := r.timeReference
+	if reference.IsZero() {
+		reference = time.Now()
+	}
+	return reference.Add(-r.lookback)
+}
+
+// GetTraceInRange is like GetTrace but also sends the time range the trace is expected in,
+// so that backends sharded by time, e.g. with daily indices, only search the matching shards.
+// A zero start or end leaves that side of the range unbounded.
+func (r *spanReader) GetTraceInRange(ctx context.Context, traceID model.TraceID, start, end time.Time) (*model.Trace, error) {
+	req := &api_v2.GetTraceRequest{
+		TraceID: traceID,
+	}
+	if !start.IsZero() {
+		req.StartTime = &start
+	}
+	if !end.IsZero() {
+		req.EndTime = &end
+	}
+	return r.getTrace(ctx, req)
+}
+
+func (r *spanReader) getTrace(ctx context.Context, req *api_v2.GetTraceRequest) (*model.Trace, error) {
+	stream, err := r.client.GetTrace(ctx, req)
 	if err != nil {
 		return nil, unwrapNotFoundErr(err)
 	}
@@ -122,12 +184,16 @@ func (r *spanReader) FindTraces(ctx context.Context, query *spanstore.TraceQuery
 	if query.NumTraces > math.MaxInt32 {
 		return traces, fmt.Errorf("NumTraces must not greater than %d", math.MaxInt32)
 	}
+	startTimeMin := query.StartTimeMin
+	if startTimeMin.IsZero() && r.lookback > 0 {
+		startTimeMin = r.lookbackStart()
+	}
 	stream, err := r.client.FindTraces(ctx, &api_v2.FindTracesRequest{
 		Query: &api_v2.TraceQueryParameters{
 			ServiceName:   query.ServiceName,
 			OperationName: query.OperationName,
 			Tags:          query.Tags,
-			StartTimeMin:  query.StartTimeMin,
+			StartTimeMin:  startTimeMin,
 			StartTimeMax:  query.StartTimeMax,
 			DurationMin:   query.DurationMin,
 			DurationMax:   query.DurationMax,
@@ -163,3 +229,14 @@ func (r *spanReader) FindTraces(ctx context.Context, query *spanstore.TraceQuery
 func (r *spanReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
 	panic("not implemented")
 }
+
+func (r *spanReader) GetDependencies(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	res, err := r.client.GetDependencies(ctx, &api_v2.GetDependenciesRequest{
+		StartTime: endTs.Add(-lookback),
+		EndTime:   endTs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Dependencies, nil
+}
@@ -5,15 +5,23 @@ package integration
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"slices"
+	"sync"
+	"time"
 
 	jaeger2otlp "github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/jaeger"
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/exporter/exportertest"
 	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
 	"go.uber.org/zap"
 
 	"github.com/jaegertracing/jaeger/model"
@@ -23,15 +31,25 @@ import (
 var (
 	_ spanstore.Writer = (*spanWriter)(nil)
 	_ io.Closer        = (*spanWriter)(nil)
+	_ spanstore.Writer = (*batchingSpanWriter)(nil)
+	_ io.Closer        = (*batchingSpanWriter)(nil)
 )
 
 // SpanWriter utilizes the OTLP exporter to send span data to the Jaeger-v2 receiver
 type spanWriter struct {
 	exporter exporter.Traces
+	// latencies, when set, records the duration of each request sending spans.
+	latencies *latencyRecorder
 }
 
-func createSpanWriter(logger *zap.Logger, port int) (*spanWriter, error) {
+// createSpanWriter creates a SpanWriter sending spans to the OTLP gRPC receiver,
+// with the gRPC defaults for keepalive when it is nil.
+func createSpanWriter(logger *zap.Logger, port int, keepalive *configgrpc.KeepaliveClientConfig) (*spanWriter, error) {
 	factory := otlpexporter.NewFactory()
+	return startSpanWriter(logger, factory, otlpExporterConfig(factory, port, keepalive))
+}
+
+func otlpExporterConfig(factory exporter.Factory, port int, keepalive *configgrpc.KeepaliveClientConfig) *otlpexporter.Config {
 	cfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
 	cfg.Endpoint = fmt.Sprintf("localhost:%d", port)
 	cfg.RetryConfig.Enabled = false
@@ -39,7 +57,21 @@ func createSpanWriter(logger *zap.Logger, port int) (*spanWriter, error) {
 	cfg.TLSSetting = configtls.ClientConfig{
 		Insecure: true,
 	}
+	cfg.Keepalive = keepalive
+	return cfg
+}
+
+// createHTTPSpanWriter creates a SpanWriter sending spans to the OTLP/HTTP receiver.
+func createHTTPSpanWriter(logger *zap.Logger, port int) (*spanWriter, error) {
+	factory := otlphttpexporter.NewFactory()
+	cfg := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
+	cfg.Endpoint = fmt.Sprintf("http://localhost:%d", port)
+	cfg.RetryConfig.Enabled = false
+	cfg.QueueConfig.Enabled = false
+	return startSpanWriter(logger, factory, cfg)
+}
 
+func startSpanWriter(logger *zap.Logger, factory exporter.Factory, cfg component.Config) (*spanWriter, error) {
 	set := exportertest.NewNopCreateSettings()
 	set.Logger = logger
 
@@ -61,15 +93,174 @@ func (w *spanWriter) Close() error {
 }
 
 func (w *spanWriter) WriteSpan(ctx context.Context, span *model.Span) error {
-	td, err := jaeger2otlp.ProtoToTraces([]*model.Batch{
-		{
+	return w.writeSpans(ctx, []*model.Span{span})
+}
+
+// writeSpans sends the spans to the collector in a single request.
+func (w *spanWriter) writeSpans(ctx context.Context, spans []*model.Span) error {
+	batches := make([]*model.Batch, 0, len(spans))
+	for _, span := range spans {
+		batches = append(batches, &model.Batch{
 			Spans:   []*model.Span{span},
 			Process: span.Process,
-		},
-	})
+		})
+	}
+	td, err := jaeger2otlp.ProtoToTraces(batches)
 	if err != nil {
 		return err
 	}
 
-	return w.exporter.ConsumeTraces(ctx, td)
+	start := time.Now()
+	err = w.exporter.ConsumeTraces(ctx, td)
+	if w.latencies != nil && err == nil {
+		w.latencies.record(time.Since(start))
+	}
+	return err
+}
+
+// spanBatchWriter sends several spans in a single request.
+type spanBatchWriter interface {
+	io.Closer
+	writeSpans(ctx context.Context, spans []*model.Span) error
+}
+
+// batchingSpanWriter buffers spans and sends them batchSize at a time, which is much
+// faster than one request per span for tests writing tens of thousands of spans.
+// The buffer is also sent every flushInterval when it is positive. Spans are only
+// guaranteed to be sent once Flush has returned.
+type batchingSpanWriter struct {
+	writer    spanBatchWriter
+	batchSize int
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu      sync.Mutex
+	pending []*model.Span
+	// err is the error of a periodic flush, reported by the next call.
+	err error
+}
+
+func newBatchingSpanWriter(writer spanBatchWriter, batchSize int, flushInterval time.Duration) *batchingSpanWriter {
+	w := &batchingSpanWriter{
+		writer:    writer,
+		batchSize: batchSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if flushInterval > 0 {
+		go w.flushPeriodically(flushInterval)
+	} else {
+		close(w.done)
+	}
+	return w
+}
+
+func (w *batchingSpanWriter) flushPeriodically(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if err := w.flushLocked(context.Background()); err != nil {
+				w.err = errors.Join(w.err, err)
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// WriteSpan adds the span to the buffer and sends the buffer once it holds batchSize spans.
+func (w *batchingSpanWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.takeErr(); err != nil {
+		return err
+	}
+	w.pending = append(w.pending, span)
+	if len(w.pending) < w.batchSize {
+		return nil
+	}
+	return w.flushLocked(ctx)
+}
+
+// Flush sends the buffered spans.
+func (w *batchingSpanWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Join(w.takeErr(), w.flushLocked(ctx))
+}
+
+func (w *batchingSpanWriter) takeErr() error {
+	err := w.err
+	w.err = nil
+	return err
+}
+
+func (w *batchingSpanWriter) flushLocked(ctx context.Context) error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	spans := w.pending
+	w.pending = nil
+	if err := w.writer.writeSpans(ctx, spans); err != nil {
+		return fmt.Errorf("failed to write a batch of %d spans: %w", len(spans), err)
+	}
+	return nil
+}
+
+// Close flushes the buffered spans and closes the underlying writer.
+func (w *batchingSpanWriter) Close() error {
+	close(w.stop)
+	<-w.done
+	return errors.Join(w.Flush(context.Background()), w.writer.Close())
+}
+
+// LatencyStats summarizes the latencies of the requests sending spans to the collector.
+type LatencyStats struct {
+	// Count is the number of successful requests the percentiles are computed from.
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// latencyRecorder collects latencies, it is safe for concurrent use.
+type latencyRecorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func (r *latencyRecorder) record(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies = append(r.latencies, latency)
+}
+
+// stats returns the percentiles of the latencies recorded so far,
+// all zero when there are none.
+func (r *latencyRecorder) stats() LatencyStats {
+	r.mu.Lock()
+	sorted := slices.Clone(r.latencies)
+	r.mu.Unlock()
+	slices.Sort(sorted)
+	return LatencyStats{
+		Count: len(sorted),
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		P99:   percentile(sorted, 99),
+	}
+}
+
+// percentile returns the p-th percentile of the sorted latencies with the nearest-rank method,
+// i.e. the smallest latency greater than or equal to p percent of them.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
 }
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// auditBufferSize is the number of audit records waiting to be written to the file.
+// Records are dropped when the file cannot keep up, so that purges are never blocked.
+const auditBufferSize = 256
+
+// auditRecord is a line of the audit file, recording the outcome of a purge request.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	CallerIP  string    `json:"caller_ip"`
+	Storages  []string  `json:"storages"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog appends the audit records as JSON lines to a file, in the background.
+type auditLog struct {
+	file    *os.File
+	logger  *zap.Logger
+	records chan auditRecord
+	// done is closed once all records have been written.
+	done chan struct{}
+}
+
+func openAuditLog(path string, logger *zap.Logger) (*auditLog, error) {
+	// #nosec G302 G304 -- the audit file is meant to be read by other tools
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log: %w", err)
+	}
+	a := &auditLog{
+		file:    file,
+		logger:  logger,
+		records: make(chan auditRecord, auditBufferSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+	encoder := json.NewEncoder(a.file)
+	for record := range a.records {
+		if err := encoder.Encode(record); err != nil {
+			a.logger.Warn("Cannot write purge audit record", zap.String("path", a.file.Name()), zap.Error(err))
+		}
+	}
+}
+
+// record queues the record without waiting for it to be written.
+func (a *auditLog) record(record auditRecord) {
+	select {
+	case a.records <- record:
+	default:
+		a.logger.Warn("Dropped purge audit record, the audit log is lagging", zap.String("path", a.file.Name()))
+	}
+}
+
+// Close writes the queued records and closes the file. No record may be queued afterwards.
+func (a *auditLog) Close() error {
+	close(a.records)
+	<-a.done
+	return a.file.Close()
+}
+
+// callerIP returns the IP address of the client of the request.
+func callerIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// auditPurge appends a record of the purge to the audit file, if AuditLogPath is set.
+func (c *storageCleaner) auditPurge(requestID, remoteAddr string, storages []string, err error) {
+	if c.audit == nil {
+		return
+	}
+	record := auditRecord{
+		Time:      time.Now().UTC(),
+		RequestID: requestID,
+		CallerIP:  callerIP(remoteAddr),
+		Storages:  storages,
+		Outcome:   "success",
+	}
+	if err != nil {
+		record.Outcome = "failure"
+		record.Error = err.Error()
+	}
+	c.audit.record(record)
+}
+
+// closeAudit closes the audit file once no purge can record to it anymore.
+func (c *storageCleaner) closeAudit() error {
+	if c.audit == nil {
+		return nil
+	}
+	audit := c.audit
+	c.audit = nil
+	if err := audit.Close(); err != nil {
+		return fmt.Errorf("error closing audit log: %w", err)
+	}
+	return nil
+}
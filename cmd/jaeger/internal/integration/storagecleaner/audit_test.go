@@ -0,0 +1,84 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+)
+
+func readAuditRecords(t *testing.T, path string) []auditRecord {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestStorageCleanerAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// records of earlier runs are kept
+	require.NoError(t, os.WriteFile(path, []byte(`{"outcome":"success"}`+"\n"), 0o600))
+	factory := &PurgerFactory{}
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), AuditLogPath: path}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	before := time.Now().UTC()
+	w := serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code)
+	factory.err = assert.AnError
+	w = serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	// the pending records are written on shutdown
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	records := readAuditRecords(t, path)
+	require.Len(t, records, 3)
+	assert.Equal(t, w.Header().Get(RequestIDHeader), records[2].RequestID)
+	assert.NotEqual(t, records[1].RequestID, records[2].RequestID)
+	for _, record := range records[1:] {
+		assert.Equal(t, "192.0.2.1", record.CallerIP)
+		assert.Equal(t, []string{"storage"}, record.Storages)
+		assert.False(t, record.Time.Before(before))
+	}
+	assert.Equal(t, "success", records[1].Outcome)
+	assert.Empty(t, records[1].Error)
+	assert.Equal(t, "failure", records[2].Outcome)
+	assert.Contains(t, records[2].Error, assert.AnError.Error())
+}
+
+func TestStorageCleanerAuditLogError(t *testing.T) {
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         getFreePort(t),
+		AuditLogPath: filepath.Join(t.TempDir(), "missing", "audit.log"),
+	}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: &PurgerFactory{},
+	})
+	err := s.Start(context.Background(), host)
+	require.ErrorContains(t, err, "cannot open audit log")
+}
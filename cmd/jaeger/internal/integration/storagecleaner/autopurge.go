@@ -0,0 +1,83 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// startAutoPurge periodically purges the storages holding more than MaxTraces traces,
+// until the extension shuts down. Storages not implementing storage.Counter are skipped.
+func (c *storageCleaner) startAutoPurge() {
+	var counted []namedStorage
+	for _, s := range c.storages {
+		if _, ok := s.factory.(storage.Counter); !ok {
+			c.settings.Logger.Warn("Storage does not implement storage.Counter, it is not purged automatically",
+				zap.String("storage", s.name))
+			continue
+		}
+		counted = append(counted, s)
+	}
+	if len(counted) == 0 {
+		return
+	}
+	interval := c.config.CheckInterval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+	c.purges.Add(1)
+	go func() {
+		defer c.purges.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.shutdownCtx.Done():
+				return
+			case <-ticker.C:
+				for _, s := range counted {
+					c.autoPurge(c.shutdownCtx, s)
+				}
+			}
+		}
+	}()
+}
+
+// autoPurge purges the storage if it holds more than MaxTraces traces.
+func (c *storageCleaner) autoPurge(ctx context.Context, s namedStorage) {
+	count, err := s.factory.(storage.Counter).CountTraces(ctx)
+	if err != nil {
+		c.settings.Logger.Warn("Failed to count traces", zap.String("storage", s.name), zap.Error(err))
+		return
+	}
+	if count <= c.config.MaxTraces {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("storage", s.name),
+		zap.Int64("traces", count),
+		zap.Int64("max_traces", c.config.MaxTraces),
+	}
+	if err := c.acquirePurge(ctx); err != nil {
+		// checked again on the next tick
+		c.settings.Logger.Debug("Skipping automatic purge", append(fields, zap.Error(err))...)
+		return
+	}
+	defer c.releasePurge()
+	start := time.Now()
+	_, err = withRetry(ctx, c.config.Retry, func() (*purgeResult, error) {
+		return purgeStorage(ctx, s, purgeRequest{})
+	})
+	c.recordPurge(ctx, start, err)
+	if err != nil {
+		c.settings.Logger.Error("Automatic purge failed", append(fields, zap.Error(err))...)
+		return
+	}
+	c.settings.Logger.Info("Purged storage exceeding max_traces", fields...)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	factoryMocks "github.com/jaegertracing/jaeger/storage/mocks"
+)
+
+// CountingPurgerFactory reports count traces, which a purge resets.
+type CountingPurgerFactory struct {
+	factoryMocks.Factory
+	count    atomic.Int64
+	purges   atomic.Int32
+	countErr error
+}
+
+func (f *CountingPurgerFactory) CountTraces(context.Context) (int64, error) {
+	return f.count.Load(), f.countErr
+}
+
+func (f *CountingPurgerFactory) Purge(context.Context) error {
+	f.purges.Add(1)
+	f.count.Store(0)
+	return nil
+}
+
+func startAutoPurgeCleaner(t *testing.T, factory *CountingPurgerFactory) (*storageCleaner, *observer.ObservedLogs) {
+	zapCore, logs := observer.New(zap.InfoLevel)
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.Logger = zap.New(zapCore)
+	config := &Config{
+		TraceStorage:  "storage",
+		Port:          getFreePort(t),
+		MaxTraces:     5,
+		CheckInterval: time.Millisecond,
+	}
+	return startStorageCleanerWithConfig(t, config, settings, factory), logs
+}
+
+func TestAutoPurge(t *testing.T) {
+	factory := &CountingPurgerFactory{}
+	factory.count.Store(5)
+	s, logs := startAutoPurgeCleaner(t, factory)
+
+	// the threshold is not exceeded yet
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, factory.purges.Load())
+
+	factory.count.Store(6)
+	require.Eventually(t, func() bool {
+		return factory.purges.Load() == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Zero(t, factory.count.Load())
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("Purged storage exceeding max_traces").Len() == 1
+	}, 5*time.Second, time.Millisecond)
+	entry := logs.FilterMessage("Purged storage exceeding max_traces").All()[0]
+	assert.Equal(t, int64(6), entry.ContextMap()["traces"])
+
+	// purging on demand keeps working
+	w := serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(2), factory.purges.Load())
+}
+
+func TestAutoPurgeCountError(t *testing.T) {
+	factory := &CountingPurgerFactory{countErr: errors.New("count failed")}
+	factory.count.Store(10)
+	_, logs := startAutoPurgeCleaner(t, factory)
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("Failed to count traces").Len() > 0
+	}, 5*time.Second, time.Millisecond)
+	assert.Zero(t, factory.purges.Load())
+}
+
+func TestAutoPurgeWithoutCounter(t *testing.T) {
+	zapCore, logs := observer.New(zap.InfoLevel)
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.Logger = zap.New(zapCore)
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         getFreePort(t),
+		MaxTraces:    5,
+	}
+	factory := &PurgerFactory{}
+	startStorageCleanerWithConfig(t, config, settings, factory)
+
+	assert.Equal(t, 1, logs.FilterMessage("Storage does not implement storage.Counter, it is not purged automatically").Len())
+	assert.Zero(t, factory.calls.Load())
+}
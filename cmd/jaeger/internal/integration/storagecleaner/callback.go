@@ -0,0 +1,141 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// callbackTimeout bounds the request posting the outcome of an asynchronous purge.
+const callbackTimeout = 10 * time.Second
+
+// Outcomes of an asynchronous purge reported to the callback URL.
+const (
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// jobAccepted is returned by the purge endpoint when the purge runs in the background.
+type jobAccepted struct {
+	JobID string `json:"job_id"`
+}
+
+// jobOutcome is posted to the callback URL once an asynchronous purge completes.
+type jobOutcome struct {
+	JobID        string `json:"job_id"`
+	Status       string `json:"status"`
+	DeletedSpans *int64 `json:"deleted_spans,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// parseCallbackURL extracts the optional callback_url query parameter,
+// which must be an absolute http or https URL.
+func parseCallbackURL(r *http.Request) (string, error) {
+	callbackURL := r.URL.Query().Get("callback_url")
+	if callbackURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid callback_url %q, must be an absolute http or https URL", callbackURL)
+	}
+	return callbackURL, nil
+}
+
+// newRandomID returns a random hexadecimal id, e.g. of a job or a request.
+func newRandomID() string {
+	id := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// startAsyncPurge responds with 202 Accepted and a job id, then runs the purge in the
+// background and posts its outcome to callbackURL. In reject mode, a purge in progress
+// is still reported synchronously with 409 Conflict.
+func (c *storageCleaner) startAsyncPurge(w http.ResponseWriter, r *http.Request, req purgeRequest, key, callbackURL string) {
+	locked := false
+	if c.config.Concurrency == ConcurrencyReject {
+		if err := c.acquirePurge(r.Context()); err != nil {
+			writeError(w, http.StatusConflict, CodePurgeInProgress, err.Error())
+			return
+		}
+		locked = true
+	}
+	jobID := newRandomID()
+	c.purges.Add(1)
+	go func() {
+		defer c.purges.Done()
+		// the request is over, only Shutdown aborts the purge
+		ctx := c.shutdownCtx
+		outcome := jobOutcome{JobID: jobID, Status: jobSucceeded}
+		if !locked {
+			if err := c.acquirePurge(ctx); err != nil {
+				outcome.Status, outcome.Error = jobFailed, fmt.Sprintf("aborted while waiting for another purge: %v", err)
+				c.postCallback(callbackURL, req.requestID, outcome)
+				return
+			}
+		}
+		purgeStart := time.Now()
+		result, err := c.boundedPurge(ctx, req, c.releasePurge)
+		c.recordPurge(context.Background(), purgeStart, err)
+		c.logPurge(r, req, time.Since(purgeStart), err)
+		switch {
+		case err != nil:
+			outcome.Status, outcome.Error = jobFailed, err.Error()
+		case result != nil:
+			outcome.DeletedSpans = &result.DeletedSpans
+		}
+		if err == nil && key != "" {
+			c.purgesByKey.Put(key, idempotentPurge{fingerprint: req.fingerprint(), result: result})
+		}
+		c.postCallback(callbackURL, req.requestID, outcome)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(jobAccepted{JobID: jobID})
+}
+
+// postCallback posts the outcome of an asynchronous purge to callbackURL.
+// Failures are only logged since nobody is waiting for the purge anymore.
+func (c *storageCleaner) postCallback(callbackURL, requestID string, outcome jobOutcome) {
+	logger := c.settings.Logger.With(
+		zap.String("request_id", requestID),
+		zap.String("job_id", outcome.JobID),
+		zap.String("callback_url", callbackURL),
+	)
+	body, err := json.Marshal(outcome)
+	if err != nil {
+		logger.Error("Failed to encode purge outcome", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		logger.Error("Failed to create purge callback request", zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Warn("Failed to post purge outcome", zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		logger.Warn("Purge callback rejected the outcome", zap.Int("status", resp.StatusCode))
+	}
+}
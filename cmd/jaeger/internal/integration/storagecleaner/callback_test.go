@@ -0,0 +1,133 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// startCallbackServer records the outcomes posted by asynchronous purges.
+func startCallbackServer(t *testing.T) (*httptest.Server, <-chan jobOutcome) {
+	outcomes := make(chan jobOutcome, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var outcome jobOutcome
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&outcome))
+		outcomes <- outcome
+	}))
+	t.Cleanup(server.Close)
+	return server, outcomes
+}
+
+func waitForOutcome(t *testing.T, outcomes <-chan jobOutcome) jobOutcome {
+	select {
+	case outcome := <-outcomes:
+		return outcome
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "callback was not called")
+		return jobOutcome{}
+	}
+}
+
+func TestStorageCleanerPurgeCallback(t *testing.T) {
+	deleted := int64(7)
+	tests := []struct {
+		name     string
+		factory  storage.Factory
+		expected jobOutcome
+	}{
+		{
+			name:     "success",
+			factory:  &PurgerFactory{},
+			expected: jobOutcome{Status: jobSucceeded},
+		},
+		{
+			name:     "success with stats",
+			factory:  &StatsPurgerFactory{deleted: deleted},
+			expected: jobOutcome{Status: jobSucceeded, DeletedSpans: &deleted},
+		},
+		{
+			name:     "failure",
+			factory:  &PurgerFactory{err: errors.New("storage is on fire")},
+			expected: jobOutcome{Status: jobFailed, Error: "error purging storage storage: storage is on fire"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			callback, outcomes := startCallbackServer(t)
+			s := startStorageCleaner(t, test.factory)
+
+			w := serveRequest(s, http.MethodPost, URL+"?callback_url="+url.QueryEscape(callback.URL+"/done"))
+			require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+			var accepted jobAccepted
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+			assert.Len(t, accepted.JobID, 32)
+
+			outcome := waitForOutcome(t, outcomes)
+			test.expected.JobID = accepted.JobID
+			assert.Equal(t, test.expected, outcome)
+		})
+	}
+}
+
+func TestStorageCleanerPurgeCallbackInvalidURL(t *testing.T) {
+	s := startStorageCleaner(t, &PurgerFactory{})
+	for _, callbackURL := range []string{"ftp://localhost/done", "/done", "localhost:1234", "http://%zz"} {
+		t.Run(callbackURL, func(t *testing.T) {
+			w := serveRequest(s, http.MethodPost, URL+"?callback_url="+url.QueryEscape(callbackURL))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "invalid callback_url")
+		})
+	}
+}
+
+func TestStorageCleanerPurgeCallbackRejected(t *testing.T) {
+	callback, outcomes := startCallbackServer(t)
+	factory := &PurgerFactory{started: make(chan struct{}), release: make(chan struct{})}
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+		Concurrency:  ConcurrencyReject,
+	}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+	target := URL + "?callback_url=" + url.QueryEscape(callback.URL)
+
+	w := serveRequest(s, http.MethodPost, target)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	<-factory.started
+
+	// the purge in progress is reported synchronously
+	w = serveRequest(s, http.MethodPost, target)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	close(factory.release)
+	assert.Equal(t, jobSucceeded, waitForOutcome(t, outcomes).Status)
+}
+
+func TestStorageCleanerPurgeCallbackUnreachable(t *testing.T) {
+	callback := httptest.NewServer(http.NotFoundHandler())
+	callback.Close()
+	factory := &PurgerFactory{}
+	s := startStorageCleaner(t, factory)
+
+	w := serveRequest(s, http.MethodPost, URL+"?callback_url="+url.QueryEscape(callback.URL))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	// the purge completes even though its outcome cannot be delivered
+	assert.Eventually(t, func() bool {
+		return factory.completed.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
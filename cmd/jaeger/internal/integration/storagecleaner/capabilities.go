@@ -0,0 +1,65 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+)
+
+// Capability names a kind of purge, or another optional feature, that a storage
+// backend may support. The capabilities shared by all the purged storages are
+// reported by the status endpoint, so that tests can skip what they do not support.
+type Capability string
+
+const (
+	CapabilityPurge             Capability = "purge"
+	CapabilityRangePurge        Capability = "range_purge"
+	CapabilityServicePurge      Capability = "service_purge"
+	CapabilityServiceRangePurge Capability = "service_range_purge"
+	CapabilityTracePurge        Capability = "trace_purge"
+	CapabilityPatternPurge      Capability = "pattern_purge"
+	CapabilityAttributePurge    Capability = "attribute_purge"
+	CapabilityBatchPurge        Capability = "batch_purge"
+	CapabilityExpiredPurge      Capability = "expired_purge"
+	CapabilityTenantPurge       Capability = "tenant_purge"
+	CapabilityDependencyPurge   Capability = "dependency_purge"
+	CapabilityCount             Capability = "count"
+)
+
+// capabilityNames lists the capabilities reported by jaegerstorage, in the order of the constants.
+func capabilityNames(c jaegerstorage.Capabilities) []Capability {
+	var capabilities []Capability
+	add := func(name Capability, ok bool) {
+		if ok {
+			capabilities = append(capabilities, name)
+		}
+	}
+	add(CapabilityPurge, c.Purger)
+	add(CapabilityRangePurge, c.RangePurger)
+	add(CapabilityServicePurge, c.ServicePurger)
+	add(CapabilityServiceRangePurge, c.ServiceRangePurger)
+	add(CapabilityTracePurge, c.TracePurger)
+	add(CapabilityPatternPurge, c.PatternPurger)
+	add(CapabilityAttributePurge, c.AttributePurger)
+	add(CapabilityBatchPurge, c.BatchPurger)
+	add(CapabilityExpiredPurge, c.ExpiredPurger)
+	add(CapabilityTenantPurge, c.TenantPurger)
+	add(CapabilityDependencyPurge, c.DependencyPurger)
+	add(CapabilityCount, c.Counter)
+	return capabilities
+}
+
+// intersectCapabilities returns the capabilities found in both lists.
+func intersectCapabilities(a, b []Capability) []Capability {
+	var shared []Capability
+	for _, c := range a {
+		for _, other := range b {
+			if c == other {
+				shared = append(shared, c)
+				break
+			}
+		}
+	}
+	return shared
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/storage"
+	factoryMocks "github.com/jaegertracing/jaeger/storage/mocks"
+)
+
+func TestCapabilityNames(t *testing.T) {
+	names := func(f storage.Factory) []Capability {
+		return capabilityNames(jaegerstorage.FactoryCapabilities(f))
+	}
+	assert.Empty(t, names(&factoryMocks.Factory{}))
+	assert.Equal(t, []Capability{CapabilityPurge}, names(&PurgerFactory{}))
+	assert.Equal(t, []Capability{CapabilityPurge, CapabilityExpiredPurge}, names(&ExpiredPurgerFactory{}))
+}
+
+func TestIntersectCapabilities(t *testing.T) {
+	all := []Capability{CapabilityPurge, CapabilityRangePurge, CapabilityCount}
+	assert.Equal(t, []Capability{CapabilityPurge, CapabilityCount},
+		intersectCapabilities(all, []Capability{CapabilityCount, CapabilityPurge}))
+	assert.Empty(t, intersectCapabilities(all, nil))
+}
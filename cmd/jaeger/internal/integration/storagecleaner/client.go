@@ -0,0 +1,200 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/confmap"
+)
+
+// DefaultEndpoint is the base URL of the extension with the default configuration.
+const DefaultEndpoint = "http://localhost:" + Port
+
+// maxErrorBodySize limits how much of an error response is read into ResponseError.
+const maxErrorBodySize = 4096
+
+// Client sends requests to the storage_cleaner extension, e.g. to purge the storage
+// between integration test runs. The zero value targets DefaultEndpoint.
+type Client struct {
+	// Endpoint is the base URL of the extension, e.g. "https://localhost:9231".
+	Endpoint string
+	// AuthToken is sent as a bearer token when set, it must match the auth_token setting.
+	AuthToken string
+	// HTTPClient sends the requests, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// ResponseError is returned by the Client when the extension responds with
+// an unexpected status code.
+type ResponseError struct {
+	StatusCode int
+	// Code is the machine-readable code of the error, e.g. CodePurgeInProgress.
+	// It is empty when the response was not written by the extension, e.g. by a proxy.
+	Code string
+	// Message is the error reported by the extension.
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("storage_cleaner responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Purge removes all data from the storages configured for the extension.
+func (c *Client) Purge(ctx context.Context) error {
+	return c.purge(ctx, url.Values{})
+}
+
+// PurgeRange removes the spans with a start time within [start, end].
+// A zero start or end leaves that side of the range unbounded.
+func (c *Client) PurgeRange(ctx context.Context, start, end time.Time) error {
+	query := url.Values{}
+	if !start.IsZero() {
+		query.Set("start", start.Format(time.RFC3339Nano))
+	}
+	if !end.IsZero() {
+		query.Set("end", end.Format(time.RFC3339Nano))
+	}
+	return c.purge(ctx, query)
+}
+
+// Reset purges the storages configured for the extension and recreates their schema.
+func (c *Client) Reset(ctx context.Context) error {
+	return c.post(ctx, ResetURL, url.Values{})
+}
+
+func (c *Client) purge(ctx context.Context, query url.Values) error {
+	return c.post(ctx, URL, query)
+}
+
+func (c *Client) post(ctx context.Context, path string, query url.Values) error {
+	resp, err := c.do(ctx, http.MethodPost, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readResponseError(resp)
+	}
+	return nil
+}
+
+// Status reports whether the configured storages are available and can be purged.
+// When a storage is missing, both the status and a *ResponseError are returned,
+// so that StatusResponse.AvailableStorages can be inspected.
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, StatusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, readResponseError(resp)
+	}
+	var status StatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("cannot decode status response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &status, &ResponseError{StatusCode: resp.StatusCode, Code: status.Code, Message: status.Error}
+	}
+	return &status, nil
+}
+
+// Ping checks that the storages configured for the extension are reachable.
+// When one is not, both the response and a *ResponseError are returned, so that
+// the storages can be inspected.
+func (c *Client) Ping(ctx context.Context) (*PingResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, PingURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, readResponseError(resp)
+	}
+	var ping PingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ping); err != nil {
+		return nil, fmt.Errorf("cannot decode ping response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		respErr := &ResponseError{StatusCode: resp.StatusCode, Code: ping.Code}
+		for _, s := range ping.Storages {
+			if !s.Healthy {
+				respErr.Message = fmt.Sprintf("storage %s is unhealthy: %s", s.Name, s.Error)
+				break
+			}
+		}
+		return &ping, respErr
+	}
+	return &ping, nil
+}
+
+// Config returns the effective configuration of the extension, e.g. to check which
+// storages it purges. The auth token is redacted.
+func (c *Client) Config(ctx context.Context) (*Config, error) {
+	resp, err := c.do(ctx, http.MethodGet, ConfigURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readResponseError(resp)
+	}
+	var effective map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&effective); err != nil {
+		return nil, fmt.Errorf("cannot decode config response: %w", err)
+	}
+	var config Config
+	if err := confmap.NewFromStringMap(effective).Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("cannot decode config response: %w", err)
+	}
+	return &config, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	target := strings.TrimSuffix(endpoint, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send request to storage_cleaner: %w", err)
+	}
+	return resp, nil
+}
+
+// readResponseError reads the JSON error written by the extension, falling back
+// to the plain-text body for responses written by something else.
+func readResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	var errResp errorResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+		return &ResponseError{StatusCode: resp.StatusCode, Code: errResp.Code, Message: errResp.Error}
+	}
+	return &ResponseError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/model"
+	memoryCfg "github.com/jaegertracing/jaeger/pkg/memory/config"
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/memory"
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// startClientServer serves the handler of a started storage_cleaner with httptest.
+func startClientServer(t *testing.T, config *Config, factory storage.Factory) *httptest.Server {
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+	server := httptest.NewServer(s.server.Handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientPurge(t *testing.T) {
+	factory := &PurgerFactory{}
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, factory)
+
+	client := &Client{Endpoint: server.URL + "/"}
+	require.NoError(t, client.Purge(context.Background()))
+	assert.Equal(t, int32(1), factory.calls.Load())
+}
+
+func TestClientPathPrefix(t *testing.T) {
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), PathPrefix: "/cleaner/trace"}
+	server := startClientServer(t, config, &PurgerFactory{})
+
+	client := &Client{Endpoint: server.URL + "/cleaner/trace"}
+	require.NoError(t, client.Purge(context.Background()))
+	_, err := client.Status(context.Background())
+	require.NoError(t, err)
+}
+
+func TestClientPurgeError(t *testing.T) {
+	factory := &PurgerFactory{err: errors.New("storage is on fire")}
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, factory)
+
+	err := (&Client{Endpoint: server.URL}).Purge(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusInternalServerError, respErr.StatusCode)
+	assert.Equal(t, CodePurgeFailed, respErr.Code)
+	assert.Equal(t, "error purging storage storage: storage is on fire", respErr.Message)
+	require.EqualError(t, err, "storage_cleaner responded with 500 Internal Server Error: error purging storage storage: storage is on fire")
+}
+
+func TestClientReset(t *testing.T) {
+	factory := &SchemaPurgerFactory{}
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, factory)
+
+	require.NoError(t, (&Client{Endpoint: server.URL}).Reset(context.Background()))
+	assert.Equal(t, int32(1), factory.calls.Load())
+	assert.Equal(t, int32(1), factory.schemaCalls.Load())
+
+	factory.schemaErr = errors.New("schema error")
+	err := (&Client{Endpoint: server.URL}).Reset(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, CodeSchemaFailed, respErr.Code)
+}
+
+func TestClientAuthToken(t *testing.T) {
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), AuthToken: "secret"}
+	server := startClientServer(t, config, &PurgerFactory{})
+
+	err := (&Client{Endpoint: server.URL}).Purge(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusUnauthorized, respErr.StatusCode)
+	assert.Equal(t, CodeUnauthorized, respErr.Code)
+
+	require.NoError(t, (&Client{Endpoint: server.URL, AuthToken: "secret"}).Purge(context.Background()))
+}
+
+func TestClientPurgeRange(t *testing.T) {
+	oldSpan := &model.Span{
+		TraceID:   model.NewTraceID(1, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   &model.Process{ServiceName: "service"},
+		StartTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	newSpan := &model.Span{
+		TraceID:   model.NewTraceID(2, 2),
+		SpanID:    model.NewSpanID(2),
+		Process:   &model.Process{ServiceName: "service"},
+		StartTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	writer, err := factory.CreateSpanWriter()
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteSpan(context.Background(), oldSpan))
+	require.NoError(t, writer.WriteSpan(context.Background(), newSpan))
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, factory)
+
+	client := &Client{Endpoint: server.URL}
+	require.NoError(t, client.PurgeRange(context.Background(), time.Time{}, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+
+	reader, err := factory.CreateSpanReader()
+	require.NoError(t, err)
+	_, err = reader.GetTrace(context.Background(), oldSpan.TraceID)
+	require.Error(t, err)
+	_, err = reader.GetTrace(context.Background(), newSpan.TraceID)
+	require.NoError(t, err)
+}
+
+func TestClientPurgeRangeNotImplemented(t *testing.T) {
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, &PurgerFactory{})
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 500, time.UTC)
+	err := (&Client{Endpoint: server.URL}).PurgeRange(context.Background(), start, start.Add(time.Hour))
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusNotImplemented, respErr.StatusCode)
+	assert.Equal(t, CodeNotImplemented, respErr.Code)
+}
+
+func TestClientStatus(t *testing.T) {
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, &PurgerFactory{})
+
+	status, err := (&Client{Endpoint: server.URL}).Status(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &StatusResponse{Storage: "storage", Purger: true, Capabilities: []Capability{CapabilityPurge}}, status)
+}
+
+func TestClientStatusStorageNotFound(t *testing.T) {
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t)}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: &PurgerFactory{},
+	})
+	require.NoError(t, s.Start(context.Background(), host))
+	defer s.Shutdown(context.Background())
+	server := httptest.NewServer(s.server.Handler)
+	defer server.Close()
+
+	// simulate a typo in the configured storage name
+	s.config.TraceStorage = "storgae"
+	status, err := (&Client{Endpoint: server.URL}).Status(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusNotFound, respErr.StatusCode)
+	assert.Equal(t, CodeStorageNotFound, respErr.Code)
+	assert.Contains(t, respErr.Message, "cannot find storage 'storgae'")
+	require.NotNil(t, status)
+	assert.Equal(t, []string{"storage"}, status.AvailableStorages)
+}
+
+func TestClientStatusNotJSON(t *testing.T) {
+	// e.g. a proxy in front of the extension
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "request timed out", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := (&Client{Endpoint: server.URL}).Status(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, "request timed out", respErr.Message)
+	assert.Empty(t, respErr.Code)
+}
+
+func TestClientConfig(t *testing.T) {
+	config := &Config{TraceStorage: "storage", AuthToken: "secret", MinInterval: time.Second}
+	require.NoError(t, config.Validate())
+	server := startClientServer(t, config, &PurgerFactory{})
+
+	_, err := (&Client{Endpoint: server.URL}).Config(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusUnauthorized, respErr.StatusCode)
+	assert.Equal(t, CodeUnauthorized, respErr.Code)
+
+	effective, err := (&Client{Endpoint: server.URL, AuthToken: "secret"}).Config(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "storage", effective.TraceStorage)
+	assert.Equal(t, time.Second, effective.MinInterval)
+	assert.Zero(t, effective.HandlerTimeout)
+	assert.Equal(t, ConcurrencySerialize, effective.Concurrency)
+	assert.Equal(t, redacted, effective.AuthToken)
+}
+
+func TestClientConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client := &Client{Endpoint: server.URL}
+	require.ErrorContains(t, client.Purge(context.Background()), "cannot send request to storage_cleaner")
+	_, err := client.Status(context.Background())
+	require.ErrorContains(t, err, "cannot send request to storage_cleaner")
+	require.ErrorContains(t, (&Client{Endpoint: "://invalid"}).Purge(context.Background()), "cannot create request")
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/confmap/converter/expandconverter"
+	"go.opentelemetry.io/collector/confmap/provider/envprovider"
+	"go.opentelemetry.io/collector/confmap/provider/fileprovider"
+	"go.opentelemetry.io/collector/extension"
+	noopmetric "go.opentelemetry.io/otel/metric/noop"
+	nooptrace "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+)
+
+const (
+	configFlag  = "config"
+	storageFlag = "storage"
+)
+
+// Command returns the "purge" command, which removes all data from the storages
+// of a collector configuration in-process, without going through the HTTP endpoint.
+// It is meant for CI teardown steps.
+func Command() *cobra.Command {
+	var (
+		configFile string
+		names      []string
+	)
+	c := &cobra.Command{
+		Use:   "purge",
+		Short: "Purges the trace storages of a collector configuration",
+		Long: `Loads the jaeger_storage extension of a collector configuration and removes all data from the given storages.
+When --storage is not set, the storages configured for the storage_cleaner extension are purged.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runPurge(cmd.Context(), configFile, names, cmd.OutOrStdout())
+		},
+	}
+	c.Flags().StringVar(&configFile, configFlag, "", "Path to the collector configuration file")
+	c.Flags().StringSliceVar(&names, storageFlag, nil, "Names of the storages to purge")
+	_ = c.MarkFlagRequired(configFlag)
+	return c
+}
+
+// runPurge starts the jaeger_storage extension defined in configFile and purges the named storages.
+func runPurge(ctx context.Context, configFile string, names []string, out io.Writer) error {
+	storageCfg, cleanerCfg, err := loadConfig(ctx, configFile)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = cleanerCfg.storageNames()
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no storage to purge: set --%s or configure the %s extension", storageFlag, componentType)
+	}
+
+	logger := zap.NewNop()
+	ext, err := jaegerstorage.NewFactory().CreateExtension(ctx, extension.CreateSettings{
+		ID: jaegerstorage.ID,
+		TelemetrySettings: component.TelemetrySettings{
+			Logger:         logger,
+			TracerProvider: nooptrace.NewTracerProvider(),
+			MeterProvider:  noopmetric.NewMeterProvider(),
+			ReportStatus:   func(*component.StatusEvent) {},
+		},
+		BuildInfo: component.NewDefaultBuildInfo(),
+	}, storageCfg)
+	if err != nil {
+		return fmt.Errorf("cannot create %s extension: %w", jaegerstorage.ID, err)
+	}
+	host := &purgeHost{extensions: map[component.ID]component.Component{jaegerstorage.ID: ext}}
+	if err := ext.Start(ctx, host); err != nil {
+		return fmt.Errorf("cannot start %s extension: %w", jaegerstorage.ID, err)
+	}
+	err = purgeStorages(ctx, host, names, out)
+	return errors.Join(err, ext.Shutdown(ctx))
+}
+
+// purgeStorages purges the named storages of the jaeger_storage extension in host
+// in sequence, printing the result of each purge to out.
+func purgeStorages(ctx context.Context, host component.Host, names []string, out io.Writer) error {
+	for _, name := range names {
+		f, err := jaegerstorage.GetStorageFactory(name, host)
+		if err != nil {
+			return fmt.Errorf("cannot find storage factory '%s': %w", name, err)
+		}
+		result, err := purgeStorage(ctx, namedStorage{name: name, factory: f}, purgeRequest{})
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			fmt.Fprintf(out, "Purged storage %s: %d spans deleted\n", name, result.DeletedSpans)
+		} else {
+			fmt.Fprintf(out, "Purged storage %s\n", name)
+		}
+	}
+	return nil
+}
+
+// loadConfig reads the jaeger_storage and storage_cleaner extension configurations from
+// a collector configuration file. The storage_cleaner configuration is optional. The file
+// is resolved like the collector does, expanding the references to environment variables.
+func loadConfig(ctx context.Context, configFile string) (*jaegerstorage.Config, *Config, error) {
+	providerSettings := confmap.ProviderSettings{Logger: zap.NewNop()}
+	resolver, err := confmap.NewResolver(confmap.ResolverSettings{
+		URIs: []string{"file:" + configFile},
+		Providers: map[string]confmap.Provider{
+			"file": fileprovider.NewWithSettings(providerSettings),
+			"env":  envprovider.NewWithSettings(providerSettings),
+		},
+		Converters: []confmap.Converter{expandconverter.New(confmap.ConverterSettings{})},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// JSON is valid YAML, so both formats are supported.
+	conf, err := resolver.Resolve(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load config file: %w", err)
+	}
+	extensions, err := conf.Sub("extensions")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid extensions in config file: %w", err)
+	}
+
+	var storageCfg *jaegerstorage.Config
+	cleanerCfg := &Config{}
+	for key := range extensions.ToStringMap() {
+		var id component.ID
+		if err := id.UnmarshalText([]byte(key)); err != nil {
+			return nil, nil, fmt.Errorf("invalid extension id '%s': %w", key, err)
+		}
+		section, err := extensions.Sub(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s config: %w", key, err)
+		}
+		switch id.Type() {
+		case jaegerstorage.ID.Type():
+			storageCfg = &jaegerstorage.Config{}
+			if err := section.Unmarshal(storageCfg); err != nil {
+				return nil, nil, fmt.Errorf("cannot unmarshal %s config: %w", key, err)
+			}
+		case componentType:
+			if err := section.Unmarshal(cleanerCfg); err != nil {
+				return nil, nil, fmt.Errorf("cannot unmarshal %s config: %w", key, err)
+			}
+		}
+	}
+	if storageCfg == nil {
+		return nil, nil, fmt.Errorf("config file does not define the %s extension", jaegerstorage.ID)
+	}
+	if err := storageCfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s config: %w", jaegerstorage.ID, err)
+	}
+	return storageCfg, cleanerCfg, nil
+}
+
+// purgeHost is a minimal component.Host exposing the jaeger_storage extension.
+type purgeHost struct {
+	extensions map[component.ID]component.Component
+}
+
+func (*purgeHost) GetFactory(component.Kind, component.Type) component.Factory {
+	return nil
+}
+
+func (h *purgeHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func (*purgeHost) GetExporters() map[component.DataType]map[component.ID]component.Component {
+	return nil
+}
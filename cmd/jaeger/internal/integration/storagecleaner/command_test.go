@@ -0,0 +1,190 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/model"
+	memoryCfg "github.com/jaegertracing/jaeger/pkg/memory/config"
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/badger"
+	"github.com/jaegertracing/jaeger/plugin/storage/memory"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+const purgeTestConfig = `
+extensions:
+  jaeger_storage:
+    memory:
+      memstore:
+        max_traces: 100
+  storage_cleaner:
+    trace_storage: memstore
+`
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestPurgeCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:     "storage from storage_cleaner config",
+			config:   purgeTestConfig,
+			expected: "Purged storage memstore: 0 spans deleted\n",
+		},
+		{
+			name:     "storage from flag",
+			config:   purgeTestConfig,
+			args:     []string{"--storage", "memstore"},
+			expected: "Purged storage memstore: 0 spans deleted\n",
+		},
+		{
+			name:   "unknown storage",
+			config: purgeTestConfig,
+			args:   []string{"--storage", "unknown"},
+			err:    "cannot find storage factory 'unknown'",
+		},
+		{
+			name:   "no storage",
+			config: "extensions:\n  jaeger_storage:\n    memory:\n      memstore: {}\n",
+			err:    "no storage to purge",
+		},
+		{
+			name:   "no jaeger_storage extension",
+			config: "extensions:\n  storage_cleaner:\n    trace_storage: memstore\n",
+			err:    "config file does not define the jaeger_storage extension",
+		},
+		{
+			name:   "invalid config",
+			config: "extensions: [",
+			err:    "cannot load config file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmd := Command()
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs(append([]string{"--config", writeConfig(t, test.config)}, test.args...))
+			err := cmd.Execute()
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestPurgeCommandMissingConfigFile(t *testing.T) {
+	err := runPurge(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"), nil, &bytes.Buffer{})
+	require.ErrorContains(t, err, "cannot load config file")
+}
+
+func TestPurgeCommandDeletesSpans(t *testing.T) {
+	dir := t.TempDir()
+	badgerConfig := badger.NamespaceConfig{
+		KeyDirectory:          filepath.Join(dir, "keys"),
+		ValueDirectory:        filepath.Join(dir, "values"),
+		SpanStoreTTL:          time.Hour,
+		MaintenanceInterval:   time.Minute,
+		MetricsUpdateInterval: time.Minute,
+	}
+	openBadger := func() *badger.Factory {
+		f, err := badger.NewFactoryWithConfig(badgerConfig, metrics.NullFactory, zap.NewNop())
+		require.NoError(t, err)
+		return f
+	}
+	span := &model.Span{
+		TraceID:   model.NewTraceID(1, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   &model.Process{ServiceName: "service"},
+		StartTime: time.Now(),
+	}
+	f := openBadger()
+	writer, err := f.CreateSpanWriter()
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+	require.NoError(t, f.Close())
+
+	// the directory is referenced like in the configs loaded by the collector
+	t.Setenv("PURGE_TEST_DIR", dir)
+	var out bytes.Buffer
+	cmd := Command()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--config", writeConfig(t, `
+extensions:
+  jaeger_storage:
+    badger:
+      badger_main:
+        directory_key: ${env:PURGE_TEST_DIR}/keys
+        directory_value: ${PURGE_TEST_DIR}/values
+        span_store_ttl: 1h
+        maintenance_interval: 1m
+        metrics_update_interval: 1m
+  storage_cleaner:
+    trace_storage: badger_main
+`)})
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "Purged storage badger_main\n", out.String())
+
+	f = openBadger()
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+	reader, err := f.CreateSpanReader()
+	require.NoError(t, err)
+	_, err = reader.GetTrace(context.Background(), span.TraceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+}
+
+func TestPurgeStoragesMemory(t *testing.T) {
+	span := &model.Span{
+		TraceID:   model.NewTraceID(1, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   &model.Process{ServiceName: "service"},
+		StartTime: time.Now(),
+	}
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	writer, err := factory.CreateSpanWriter()
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteSpan(context.Background(), span))
+
+	host := storagetest.NewStorageHost()
+	host.WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "memstore",
+		factory: factory,
+	})
+	var out bytes.Buffer
+	require.NoError(t, purgeStorages(context.Background(), host, []string{"memstore"}, &out))
+	assert.Equal(t, "Purged storage memstore: 1 spans deleted\n", out.String())
+
+	reader, err := factory.CreateSpanReader()
+	require.NoError(t, err)
+	_, err = reader.GetTrace(context.Background(), span.TraceID)
+	require.Error(t, err)
+}
@@ -4,15 +4,301 @@
 package storagecleaner
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/asaskevich/govalidator"
+
+	"github.com/jaegertracing/jaeger/pkg/config/tlscfg"
 )
 
+const (
+	defaultReadHeaderTimeout = 3 * time.Second
+	defaultIdempotencyKeyTTL = 10 * time.Minute
+	defaultCheckInterval     = 10 * time.Second
+	defaultMaxBodyBytes      = 1 << 20
+	defaultFailureThreshold  = 3
+	// defaultStorageWaitTimeout leaves storage extensions that initialize their
+	// factories in the background time to complete before the cleaner gives up.
+	defaultStorageWaitTimeout = 10 * time.Second
+	defaultWaitTimeout        = 30 * time.Second
+	// writeTimeoutMargin leaves the server time to send the timeout response of HandlerTimeout.
+	writeTimeoutMargin = 5 * time.Second
+)
+
+// Values of the concurrency setting.
+const (
+	// ConcurrencySerialize queues purge requests so that only one purge runs at a time.
+	ConcurrencySerialize = "serialize"
+	// ConcurrencyReject rejects purge requests with 409 Conflict while another purge runs.
+	ConcurrencyReject = "reject"
+)
+
+// errMissingTraceStorage is returned when no storage to purge is configured, and the
+// jaegerstorage extension does not hold a single storage that could be purged instead.
+var errMissingTraceStorage = errors.New("either trace_storage or trace_storages must be set")
+
 type Config struct {
-	TraceStorage string `valid:"required" mapstructure:"trace_storage"`
-	Port         string `mapstructure:"port"`
+	TraceStorage string `mapstructure:"trace_storage"`
+	// TraceStorages lists additional storages purged in sequence along with TraceStorage.
+	TraceStorages []string `mapstructure:"trace_storages"`
+	Port          string   `mapstructure:"port"`
+	// DependencyStorage is the storage purged by requests with target=dependencies.
+	// Defaults to the trace storages when dependency links are stored along with spans.
+	DependencyStorage string `mapstructure:"dependency_storage"`
+	// PathPrefix is prepended to the paths of all endpoints, e.g. "/cleaner/trace"
+	// serves "/cleaner/trace/purge", so that several instances can share a proxy.
+	PathPrefix string `mapstructure:"path_prefix"`
+	// Endpoint is the host:port the server listens on, it takes precedence over Port.
+	// Defaults to localhost with the configured Port, use ":port" to listen on all interfaces.
+	Endpoint string `mapstructure:"endpoint"`
+	// AuthToken, when set, must be presented as a bearer token in the
+	// Authorization header of purge requests.
+	AuthToken string `mapstructure:"auth_token"`
+	// ReadHeaderTimeout is the amount of time allowed to read request headers.
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	// WriteTimeout is the maximum duration before timing out writes of the response.
+	// It must be greater than HandlerTimeout so that timeout responses can be sent.
+	// It defaults to HandlerTimeout plus 5 seconds, and is disabled without HandlerTimeout.
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// HandlerTimeout, when positive, is the maximum duration of a request, after which
+	// the client receives 503 Service Unavailable. Disabled by default, since purging
+	// a large backend can take long.
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout"`
+	// Retry controls retries of purges failing with a transient error.
+	Retry RetryConfig `mapstructure:"retry"`
+	// TLS enables HTTPS on the server, and mutual TLS when a client CA is set.
+	TLS tlscfg.Options `mapstructure:"tls"`
+	// IdempotencyKeyTTL is how long the result of a purge request with an
+	// Idempotency-Key header is returned for repeated requests with the same key.
+	IdempotencyKeyTTL time.Duration `mapstructure:"idempotency_key_ttl"`
+	// RequireConfirmation, when set, rejects purge requests without a confirm query
+	// parameter matching the purged storage names, to prevent accidental wipes.
+	RequireConfirmation bool `mapstructure:"require_confirmation"`
+	// MaxTraces, when positive, makes the extension purge a storage as soon as it
+	// holds more traces. Only storages implementing storage.Counter are checked.
+	MaxTraces int64 `mapstructure:"max_traces"`
+	// CheckInterval is how often the number of traces is compared to MaxTraces.
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// Schedule, when set, is a cron expression such as "0 3 * * *", or a shorthand
+	// such as "@daily", at the times of which the extension purges all storages.
+	Schedule string `mapstructure:"schedule"`
+	// Concurrency decides what happens to a purge request while another purge runs,
+	// since storages are not required to support concurrent purges. It is either
+	// ConcurrencySerialize, the default, or ConcurrencyReject.
+	Concurrency string `mapstructure:"concurrency"`
+	// FailureThreshold is the number of consecutive failed purges after which the
+	// extension reports a recoverable error to the collector, until a purge succeeds.
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// MaxBodyBytes limits the size of purge request bodies, larger ones are rejected
+	// with 413 Request Entity Too Large.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+	// StorageWaitTimeout is how long Start retries resolving the storage factories,
+	// since the storage extension may still be initializing them. It also bounds
+	// resolutions hanging in the storage extension.
+	StorageWaitTimeout time.Duration `mapstructure:"storage_wait_timeout"`
+	// MinInterval, when positive, is the cooldown between two purge or reset requests.
+	// Requests arriving sooner are rejected with 429 Too Many Requests, so that a
+	// shared backend is not hammered by rapid repeated purges. Disabled by default.
+	MinInterval time.Duration `mapstructure:"min_interval"`
+	// AuditLogPath, when set, is the file a JSON line is appended to for each purge
+	// request, with its time, caller IP, storages and outcome. Writes are best-effort
+	// and never delay the response.
+	AuditLogPath string `mapstructure:"audit_log_path"`
+	// Purge controls the purge capability of the extension.
+	Purge PurgeConfig `mapstructure:"purge"`
+	// MaxPurgeDuration, when positive, bounds the duration of a purge request: the purge is
+	// cancelled once it runs longer, and the client receives 504 Gateway Timeout right away
+	// even if the storage ignores the cancellation. It must be less than HandlerTimeout when set.
+	// Disabled by default.
+	MaxPurgeDuration time.Duration `mapstructure:"max_purge_duration"`
+	// WaitTimeout bounds how long a purge request with wait=true reads the storages
+	// until they no longer return data, before failing with 504 Gateway Timeout.
+	// It must be less than HandlerTimeout when set.
+	WaitTimeout time.Duration `mapstructure:"wait_timeout"`
+	// PurgeOnShutdown, when set, makes the extension purge all storages when it shuts down,
+	// within the deadline of the shutdown, so that ephemeral environments are left empty.
+	PurgeOnShutdown bool `mapstructure:"purge_on_shutdown"`
+	// PurgeOnce, when set, makes the extension purge all storages once at startup, then stop
+	// the collector, without serving any endpoint. It is meant for CI teardown steps.
+	PurgeOnce bool `mapstructure:"purge_once"`
+}
+
+// PurgeConfig controls the purge capability of the extension.
+type PurgeConfig struct {
+	// Enabled, true when unset, can be set to false to run the extension for its status
+	// and metrics only. Purge and reset requests are then rejected with 403 Forbidden.
+	Enabled *bool `mapstructure:"enabled"`
 }
 
+// enabled reports whether purges are enabled, which they are unless explicitly disabled.
+func (cfg PurgeConfig) enabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
+}
+
+// Validate checks the configuration and applies the default endpoint and timeouts when none are set.
+// It is invoked by the collector after the configuration is unmarshalled, and again when the extension
+// is created. Whether the storages exist and implement storage.Purger can only be checked in Start,
+// once the jaegerstorage extension is available from the host.
 func (cfg *Config) Validate() error {
-	_, err := govalidator.ValidateStruct(cfg)
+	// without any storage, the only one of the jaegerstorage extension is picked in Start
+	if slices.Contains(cfg.TraceStorages, "") {
+		return errMissingTraceStorage
+	}
+	if cfg.Port == "" {
+		cfg.Port = Port
+	}
+	if err := validatePort(cfg.Port); err != nil {
+		return err
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = net.JoinHostPort("localhost", cfg.Port)
+	}
+	_, port, err := net.SplitHostPort(cfg.Endpoint)
+	if err == nil {
+		err = validatePort(port)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+	}
+	if cfg.PathPrefix != "" {
+		if !strings.HasPrefix(cfg.PathPrefix, "/") {
+			return fmt.Errorf("invalid path_prefix %q: must start with /", cfg.PathPrefix)
+		}
+		cfg.PathPrefix = strings.TrimRight(cfg.PathPrefix, "/")
+	}
+	if cfg.ReadHeaderTimeout < 0 || cfg.WriteTimeout < 0 || cfg.HandlerTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if cfg.WriteTimeout == 0 && cfg.HandlerTimeout > 0 {
+		cfg.WriteTimeout = cfg.HandlerTimeout + writeTimeoutMargin
+	}
+	if cfg.HandlerTimeout > 0 && cfg.WriteTimeout <= cfg.HandlerTimeout {
+		return fmt.Errorf("write_timeout (%v) must be greater than handler_timeout (%v)", cfg.WriteTimeout, cfg.HandlerTimeout)
+	}
+	if err := cfg.Retry.validate(); err != nil {
+		return err
+	}
+	if cfg.TLS.Enabled && (cfg.TLS.CertPath == "" || cfg.TLS.KeyPath == "") {
+		return errors.New("tls requires both cert and key")
+	}
+	if cfg.IdempotencyKeyTTL < 0 {
+		return errors.New("idempotency_key_ttl must not be negative")
+	}
+	if cfg.IdempotencyKeyTTL == 0 {
+		cfg.IdempotencyKeyTTL = defaultIdempotencyKeyTTL
+	}
+	if cfg.MaxTraces < 0 || cfg.CheckInterval < 0 {
+		return errors.New("max_traces and check_interval must not be negative")
+	}
+	if cfg.MaxTraces > 0 && !cfg.Purge.enabled() {
+		return errors.New("max_traces requires purge to be enabled")
+	}
+	if cfg.MaxTraces > 0 && cfg.CheckInterval == 0 {
+		cfg.CheckInterval = defaultCheckInterval
+	}
+	if cfg.Schedule != "" {
+		if !cfg.Purge.enabled() {
+			return errors.New("schedule requires purge to be enabled")
+		}
+		if _, err := parseSchedule(cfg.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+	if cfg.PurgeOnShutdown && !cfg.Purge.enabled() {
+		return errors.New("purge_on_shutdown requires purge to be enabled")
+	}
+	if cfg.PurgeOnce {
+		if !cfg.Purge.enabled() {
+			return errors.New("purge_once requires purge to be enabled")
+		}
+		if cfg.Schedule != "" || cfg.MaxTraces > 0 {
+			return errors.New("purge_once cannot be combined with schedule or max_traces")
+		}
+	}
+	if cfg.FailureThreshold < 0 {
+		return errors.New("failure_threshold must not be negative")
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.MaxBodyBytes < 0 {
+		return errors.New("max_body_bytes must not be negative")
+	}
+	if cfg.MaxBodyBytes == 0 {
+		cfg.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if cfg.StorageWaitTimeout < 0 {
+		return errors.New("storage_wait_timeout must not be negative")
+	}
+	if cfg.StorageWaitTimeout == 0 {
+		cfg.StorageWaitTimeout = defaultStorageWaitTimeout
+	}
+	if cfg.MinInterval < 0 {
+		return errors.New("min_interval must not be negative")
+	}
+	if cfg.MaxPurgeDuration < 0 {
+		return errors.New("max_purge_duration must not be negative")
+	}
+	if cfg.MaxPurgeDuration > 0 && cfg.HandlerTimeout > 0 && cfg.MaxPurgeDuration >= cfg.HandlerTimeout {
+		return fmt.Errorf("max_purge_duration (%v) must be less than handler_timeout (%v)", cfg.MaxPurgeDuration, cfg.HandlerTimeout)
+	}
+	if cfg.WaitTimeout < 0 {
+		return errors.New("wait_timeout must not be negative")
+	}
+	if cfg.WaitTimeout == 0 {
+		cfg.WaitTimeout = defaultWaitTimeout
+		if cfg.HandlerTimeout > 0 {
+			cfg.WaitTimeout = min(defaultWaitTimeout, cfg.HandlerTimeout/2)
+		}
+	}
+	if cfg.HandlerTimeout > 0 && cfg.WaitTimeout >= cfg.HandlerTimeout {
+		return fmt.Errorf("wait_timeout (%v) must be less than handler_timeout (%v)", cfg.WaitTimeout, cfg.HandlerTimeout)
+	}
+	switch cfg.Concurrency {
+	case "":
+		cfg.Concurrency = ConcurrencySerialize
+	case ConcurrencySerialize, ConcurrencyReject:
+	default:
+		return fmt.Errorf("invalid concurrency %q, must be %q or %q", cfg.Concurrency, ConcurrencySerialize, ConcurrencyReject)
+	}
+	_, err = govalidator.ValidateStruct(cfg)
 	return err
 }
+
+func validatePort(port string) error {
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid port %q: must be a number between 1 and 65535", port)
+	}
+	return nil
+}
+
+// address returns the address the server listens on.
+func (cfg *Config) address() string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return ":" + cfg.Port
+}
+
+// storageNames returns the names of all storages to purge, starting with TraceStorage.
+func (cfg *Config) storageNames() []string {
+	var names []string
+	if cfg.TraceStorage != "" {
+		names = append(names, cfg.TraceStorage)
+	}
+	for _, name := range cfg.TraceStorages {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
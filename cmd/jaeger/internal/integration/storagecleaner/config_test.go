@@ -5,7 +5,9 @@ package storagecleaner
 
 import (
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,8 +18,398 @@ func TestStorageExtensionConfig(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestStorageExtensionConfigNoStorage(t *testing.T) {
+	// the storage is picked in Start
+	config := createDefaultConfig().(*Config)
+	require.NoError(t, config.Validate())
+	assert.Empty(t, config.storageNames())
+}
+
 func TestStorageExtensionConfigError(t *testing.T) {
 	config := createDefaultConfig().(*Config)
+	config.TraceStorages = []string{"a", ""}
 	err := config.Validate()
-	require.ErrorContains(t, err, "non zero value required")
+	require.ErrorIs(t, err, errMissingTraceStorage)
+}
+
+func TestStorageExtensionConfigStorageNames(t *testing.T) {
+	config := &Config{
+		TraceStorage:  "a",
+		TraceStorages: []string{"b", "a", "c"},
+	}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, []string{"a", "b", "c"}, config.storageNames())
+
+	config = &Config{TraceStorages: []string{"b"}}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, []string{"b"}, config.storageNames())
+}
+
+func TestStorageExtensionConfigPort(t *testing.T) {
+	tests := []struct {
+		name         string
+		port         string
+		expectedPort string
+		expectedErr  string
+	}{
+		{
+			name:         "empty",
+			port:         "",
+			expectedPort: Port,
+		},
+		{
+			name:         "valid",
+			port:         "8080",
+			expectedPort: "8080",
+		},
+		{
+			name:        "non-numeric",
+			port:        "http",
+			expectedErr: `invalid port "http"`,
+		},
+		{
+			name:        "zero",
+			port:        "0",
+			expectedErr: `invalid port "0"`,
+		},
+		{
+			name:        "negative",
+			port:        "-1",
+			expectedErr: `invalid port "-1"`,
+		},
+		{
+			name:        "overflow",
+			port:        "65536",
+			expectedErr: `invalid port "65536"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage: "storage",
+				Port:         test.port,
+			}
+			err := config.Validate()
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedPort, config.Port)
+		})
+	}
+}
+
+func TestStorageExtensionConfigTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expected    Config
+		expectedErr string
+	}{
+		{
+			name: "defaults",
+			expected: Config{
+				ReadHeaderTimeout: defaultReadHeaderTimeout,
+			},
+		},
+		{
+			name: "write timeout without handler timeout",
+			config: Config{
+				WriteTimeout: time.Minute,
+			},
+			expected: Config{
+				ReadHeaderTimeout: defaultReadHeaderTimeout,
+				WriteTimeout:      time.Minute,
+			},
+		},
+		{
+			name: "long handler timeout extends write timeout",
+			config: Config{
+				HandlerTimeout: 5 * time.Minute,
+			},
+			expected: Config{
+				ReadHeaderTimeout: defaultReadHeaderTimeout,
+				WriteTimeout:      5*time.Minute + 5*time.Second,
+				HandlerTimeout:    5 * time.Minute,
+			},
+		},
+		{
+			name: "custom",
+			config: Config{
+				ReadHeaderTimeout: time.Second,
+				WriteTimeout:      20 * time.Second,
+				HandlerTimeout:    10 * time.Second,
+			},
+			expected: Config{
+				ReadHeaderTimeout: time.Second,
+				WriteTimeout:      20 * time.Second,
+				HandlerTimeout:    10 * time.Second,
+			},
+		},
+		{
+			name: "negative",
+			config: Config{
+				ReadHeaderTimeout: -time.Second,
+			},
+			expectedErr: "timeouts must not be negative",
+		},
+		{
+			name: "write timeout not greater than handler timeout",
+			config: Config{
+				WriteTimeout:   10 * time.Second,
+				HandlerTimeout: 10 * time.Second,
+			},
+			expectedErr: "write_timeout (10s) must be greater than handler_timeout (10s)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.TraceStorage = "storage"
+			err := config.Validate()
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected.ReadHeaderTimeout, config.ReadHeaderTimeout)
+			assert.Equal(t, test.expected.WriteTimeout, config.WriteTimeout)
+			assert.Equal(t, test.expected.HandlerTimeout, config.HandlerTimeout)
+		})
+	}
+}
+
+func TestStorageExtensionConfigEndpoint(t *testing.T) {
+	tests := []struct {
+		name             string
+		port             string
+		endpoint         string
+		expectedEndpoint string
+		expectedErr      string
+	}{
+		{
+			name:             "default",
+			expectedEndpoint: "localhost:" + Port,
+		},
+		{
+			name:             "derived from port",
+			port:             "8080",
+			expectedEndpoint: "localhost:8080",
+		},
+		{
+			name:             "explicit endpoint takes precedence",
+			port:             "8080",
+			endpoint:         "127.0.0.1:9090",
+			expectedEndpoint: "127.0.0.1:9090",
+		},
+		{
+			name:             "all interfaces",
+			endpoint:         ":9090",
+			expectedEndpoint: ":9090",
+		},
+		{
+			name:        "missing port",
+			endpoint:    "localhost",
+			expectedErr: `invalid endpoint "localhost"`,
+		},
+		{
+			name:        "invalid port",
+			endpoint:    "localhost:http",
+			expectedErr: `invalid endpoint "localhost:http": invalid port "http"`,
+		},
+		{
+			name:        "port out of range",
+			endpoint:    "localhost:70000",
+			expectedErr: `invalid endpoint "localhost:70000": invalid port "70000"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage: "storage",
+				Port:         test.port,
+				Endpoint:     test.endpoint,
+			}
+			err := config.Validate()
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedEndpoint, config.Endpoint)
+			assert.Equal(t, test.expectedEndpoint, config.address())
+		})
+	}
+}
+
+func TestStorageExtensionConfigIdempotencyKeyTTL(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, defaultIdempotencyKeyTTL, config.IdempotencyKeyTTL)
+
+	config = &Config{TraceStorage: "storage", IdempotencyKeyTTL: -time.Second}
+	require.ErrorContains(t, config.Validate(), "idempotency_key_ttl must not be negative")
+}
+
+func TestStorageExtensionConfigTLS(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	config.TLS.Enabled = true
+	config.TLS.CertPath = "cert.pem"
+	require.ErrorContains(t, config.Validate(), "tls requires both cert and key")
+
+	config.TLS.KeyPath = "key.pem"
+	require.NoError(t, config.Validate())
+}
+
+func TestStorageExtensionConfigMaxTraces(t *testing.T) {
+	config := &Config{TraceStorage: "storage", MaxTraces: 100}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, defaultCheckInterval, config.CheckInterval)
+
+	config = &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Zero(t, config.CheckInterval)
+
+	config = &Config{TraceStorage: "storage", MaxTraces: -1}
+	require.ErrorContains(t, config.Validate(), "must not be negative")
+}
+
+func TestStorageExtensionConfigConcurrency(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, ConcurrencySerialize, config.Concurrency)
+
+	config = &Config{TraceStorage: "storage", Concurrency: ConcurrencyReject}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, ConcurrencyReject, config.Concurrency)
+
+	config = &Config{TraceStorage: "storage", Concurrency: "parallel"}
+	require.ErrorContains(t, config.Validate(), `invalid concurrency "parallel"`)
+}
+
+func TestStorageExtensionConfigFailureThreshold(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, defaultFailureThreshold, config.FailureThreshold)
+
+	config = &Config{TraceStorage: "storage", FailureThreshold: -1}
+	require.ErrorContains(t, config.Validate(), "failure_threshold must not be negative")
+}
+
+func TestStorageExtensionConfigMaxBodyBytes(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, int64(defaultMaxBodyBytes), config.MaxBodyBytes)
+
+	config = &Config{TraceStorage: "storage", MaxBodyBytes: -1}
+	require.ErrorContains(t, config.Validate(), "max_body_bytes must not be negative")
+}
+
+func TestStorageExtensionConfigStorageWaitTimeout(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, defaultStorageWaitTimeout, config.StorageWaitTimeout)
+
+	config = &Config{TraceStorage: "storage", StorageWaitTimeout: -time.Second}
+	require.ErrorContains(t, config.Validate(), "storage_wait_timeout must not be negative")
+}
+
+func TestStorageExtensionConfigMinInterval(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Zero(t, config.MinInterval)
+
+	config = &Config{TraceStorage: "storage", MinInterval: -time.Second}
+	require.ErrorContains(t, config.Validate(), "min_interval must not be negative")
+}
+
+func TestStorageExtensionConfigPurgeEnabled(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.True(t, config.Purge.enabled())
+
+	enabled := false
+	config = &Config{TraceStorage: "storage", Purge: PurgeConfig{Enabled: &enabled}}
+	require.NoError(t, config.Validate())
+	assert.False(t, config.Purge.enabled())
+
+	config = &Config{TraceStorage: "storage", Purge: PurgeConfig{Enabled: &enabled}, MaxTraces: 10}
+	require.ErrorContains(t, config.Validate(), "max_traces requires purge to be enabled")
+
+	config = &Config{TraceStorage: "storage", Purge: PurgeConfig{Enabled: &enabled}, PurgeOnShutdown: true}
+	require.ErrorContains(t, config.Validate(), "purge_on_shutdown requires purge to be enabled")
+
+	config = &Config{TraceStorage: "storage", Purge: PurgeConfig{Enabled: &enabled}, PurgeOnce: true}
+	require.ErrorContains(t, config.Validate(), "purge_once requires purge to be enabled")
+}
+
+func TestStorageExtensionConfigMaxPurgeDuration(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Zero(t, config.MaxPurgeDuration)
+
+	config = &Config{TraceStorage: "storage", MaxPurgeDuration: 30 * time.Second}
+	require.NoError(t, config.Validate())
+
+	config = &Config{TraceStorage: "storage", MaxPurgeDuration: -time.Second}
+	require.ErrorContains(t, config.Validate(), "max_purge_duration must not be negative")
+
+	config = &Config{TraceStorage: "storage", MaxPurgeDuration: time.Hour}
+	require.NoError(t, config.Validate(), "without handler_timeout")
+
+	config = &Config{TraceStorage: "storage", MaxPurgeDuration: time.Minute, HandlerTimeout: time.Minute}
+	require.ErrorContains(t, config.Validate(), "max_purge_duration (1m0s) must be less than handler_timeout (1m0s)")
+}
+
+func TestStorageExtensionConfigWaitTimeout(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, defaultWaitTimeout, config.WaitTimeout)
+
+	config = &Config{TraceStorage: "storage", HandlerTimeout: 10 * time.Second}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, 5*time.Second, config.WaitTimeout)
+
+	config = &Config{TraceStorage: "storage", WaitTimeout: -time.Second}
+	require.ErrorContains(t, config.Validate(), "wait_timeout must not be negative")
+
+	config = &Config{TraceStorage: "storage", WaitTimeout: time.Minute, HandlerTimeout: time.Minute}
+	require.ErrorContains(t, config.Validate(), "wait_timeout (1m0s) must be less than handler_timeout (1m0s)")
+}
+
+func TestStorageExtensionConfigPurgeOnce(t *testing.T) {
+	config := &Config{TraceStorage: "storage", PurgeOnce: true}
+	require.NoError(t, config.Validate())
+
+	config = &Config{TraceStorage: "storage", PurgeOnce: true, Schedule: "@daily"}
+	require.ErrorContains(t, config.Validate(), "purge_once cannot be combined with schedule or max_traces")
+
+	config = &Config{TraceStorage: "storage", PurgeOnce: true, MaxTraces: 10}
+	require.ErrorContains(t, config.Validate(), "purge_once cannot be combined with schedule or max_traces")
+}
+
+func TestStorageExtensionConfigSchedule(t *testing.T) {
+	config := &Config{TraceStorage: "storage", Schedule: "0 3 * * *"}
+	require.NoError(t, config.Validate())
+
+	config = &Config{TraceStorage: "storage", Schedule: "0 25 * * *"}
+	require.ErrorContains(t, config.Validate(), `invalid schedule: invalid hour "25"`)
+
+	disabled := false
+	config = &Config{TraceStorage: "storage", Schedule: "@daily", Purge: PurgeConfig{Enabled: &disabled}}
+	require.ErrorContains(t, config.Validate(), "schedule requires purge to be enabled")
+}
+
+func TestStorageExtensionConfigPathPrefix(t *testing.T) {
+	config := &Config{TraceStorage: "storage"}
+	require.NoError(t, config.Validate())
+	assert.Empty(t, config.PathPrefix)
+
+	config = &Config{TraceStorage: "storage", PathPrefix: "/cleaner/trace/"}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, "/cleaner/trace", config.PathPrefix)
+
+	config = &Config{TraceStorage: "storage", PathPrefix: "cleaner"}
+	require.ErrorContains(t, config.Validate(), `invalid path_prefix "cleaner": must start with /`)
 }
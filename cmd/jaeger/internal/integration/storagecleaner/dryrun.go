@@ -0,0 +1,167 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
+	"github.com/jaegertracing/jaeger/storage"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// dryRunSearchDepth is the maximum number of traces per service searched by a dry run.
+const dryRunSearchDepth = 100_000
+
+// dryRunResult is returned by the purge endpoint in dry-run mode.
+type dryRunResult struct {
+	DryRun     bool   `json:"dry_run"`
+	WouldPurge string `json:"would_purge"`
+	// WouldPurgeSpans is the number of spans matching the request, it is omitted
+	// when the request selects data that is not searchable, e.g. a pattern.
+	WouldPurgeSpans *int64 `json:"would_purge_spans,omitempty"`
+}
+
+// dryRunHandler verifies that the storages targeted by the request can be purged,
+// and counts the spans it matches, without purging them.
+func (c *storageCleaner) dryRunHandler(w http.ResponseWriter, r *http.Request, req purgeRequest) {
+	storages := c.targetStorages(req)
+	names := make([]string, 0, len(storages))
+	var total int64
+	counted := true
+	for _, s := range storages {
+		if _, ok := storage.GetPurger(s.factory); !ok && !req.dependencies {
+			writeError(w, http.StatusInternalServerError, CodePurgerMissing, fmt.Sprintf("storage %s %v", s.name, errPurgerMissing))
+			return
+		}
+		names = append(names, s.name)
+		if !counted {
+			continue
+		}
+		spans, ok, err := countMatchingSpans(r.Context(), s, req)
+		if err != nil {
+			writePurgeError(w, err)
+			return
+		}
+		total += spans
+		counted = ok
+	}
+	result := dryRunResult{DryRun: true, WouldPurge: strings.Join(names, ",")}
+	if counted {
+		result.WouldPurgeSpans = &total
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// countMatchingSpans searches the storage for the spans a purge of req would remove,
+// through its span reader. It returns false when the request is not searchable.
+func countMatchingSpans(ctx context.Context, s namedStorage, req purgeRequest) (int64, bool, error) {
+	if req.dependencies || req.allTenants || req.pattern != "" || req.expiredOnly {
+		return 0, false, nil
+	}
+	if req.tenant != "" {
+		ctx = tenancy.WithTenant(ctx, req.tenant)
+	}
+	reader, err := s.factory.CreateSpanReader()
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot create span reader for storage %s: %w", s.name, err)
+	}
+	if req.traceID != nil || len(req.traceIDs) > 0 {
+		var spans int64
+		for _, traceID := range requestedTraceIDs(req) {
+			trace, err := reader.GetTrace(ctx, traceID)
+			if errors.Is(err, spanstore.ErrTraceNotFound) {
+				continue
+			}
+			if err != nil {
+				return 0, false, fmt.Errorf("error reading trace %s from storage %s: %w", traceID, s.name, err)
+			}
+			spans += int64(len(trace.Spans))
+		}
+		return spans, true, nil
+	}
+	services := req.services
+	if len(services) == 0 {
+		if services, err = reader.GetServices(ctx); err != nil {
+			return 0, false, fmt.Errorf("error listing services of storage %s: %w", s.name, err)
+		}
+	}
+	query := &spanstore.TraceQueryParameters{
+		StartTimeMin: req.start,
+		StartTimeMax: req.end,
+		NumTraces:    dryRunSearchDepth,
+	}
+	// a trace with spans of several services is found once per service
+	seen := make(map[model.TraceID]struct{})
+	var spans int64
+	for _, service := range services {
+		query.ServiceName = service
+		traces, err := reader.FindTraces(ctx, query)
+		if err != nil {
+			return 0, false, fmt.Errorf("error searching service %s in storage %s: %w", service, s.name, err)
+		}
+		for _, trace := range traces {
+			if len(trace.Spans) == 0 {
+				continue
+			}
+			if _, ok := seen[trace.Spans[0].TraceID]; ok {
+				continue
+			}
+			seen[trace.Spans[0].TraceID] = struct{}{}
+			for _, span := range trace.Spans {
+				if matchesPurge(span, req) {
+					spans++
+				}
+			}
+		}
+	}
+	return spans, true, nil
+}
+
+// requestedTraceIDs returns the valid trace IDs selected by the request, invalid ones are
+// skipped since a purge reports them without failing.
+func requestedTraceIDs(req purgeRequest) []model.TraceID {
+	if req.traceID != nil {
+		return []model.TraceID{*req.traceID}
+	}
+	traceIDs := make([]model.TraceID, 0, len(req.traceIDs))
+	for _, v := range req.traceIDs {
+		traceID, err := model.TraceIDFromString(v)
+		if err != nil || traceID == (model.TraceID{}) {
+			continue
+		}
+		traceIDs = append(traceIDs, traceID)
+	}
+	return traceIDs
+}
+
+// matchesPurge reports whether the span of a found trace is removed by the purge of req,
+// which only removes the spans of its services, time range and attribute.
+func matchesPurge(span *model.Span, req purgeRequest) bool {
+	if len(req.services) > 0 && (span.Process == nil || !slices.Contains(req.services, span.Process.ServiceName)) {
+		return false
+	}
+	if !req.start.IsZero() && span.StartTime.Before(req.start) {
+		return false
+	}
+	if !req.end.IsZero() && span.StartTime.After(req.end) {
+		return false
+	}
+	if req.attribute != nil {
+		return hasTag(span.Tags, *req.attribute) || (span.Process != nil && hasTag(span.Process.Tags, *req.attribute))
+	}
+	return true
+}
+
+// hasTag reports whether tags contain the key of the filter with its value, compared as a string.
+func hasTag(tags model.KeyValues, filter attributeFilter) bool {
+	tag, ok := tags.FindByKey(filter.key)
+	return ok && tag.AsString() == filter.value
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/model"
+	memoryCfg "github.com/jaegertracing/jaeger/pkg/memory/config"
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/memory"
+)
+
+func TestStorageCleanerDryRunScope(t *testing.T) {
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	writer, err := factory.CreateSpanWriter()
+	require.NoError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first, second := model.NewTraceID(1, 1), model.NewTraceID(1, 2)
+	for _, span := range []*model.Span{
+		{TraceID: first, SpanID: 1, StartTime: start, Process: model.NewProcess("foo", nil)},
+		{TraceID: first, SpanID: 2, StartTime: start, Process: model.NewProcess("bar", nil)},
+		{
+			TraceID: second, SpanID: 3, StartTime: start.Add(time.Hour), Process: model.NewProcess("foo", nil),
+			Tags: model.KeyValues{model.String("env", "test")},
+		},
+	} {
+		require.NoError(t, writer.WriteSpan(context.Background(), span))
+	}
+	s := startStorageCleaner(t, factory)
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		expected string
+	}{
+		{name: "all", target: URL, expected: `3`},
+		{name: "service", target: URL + "?service=foo", expected: `2`},
+		{name: "service without traces", target: URL + "?service=baz", expected: `0`},
+		{name: "time range", target: URL + "?start=2024-01-01T00:30:00Z", expected: `1`},
+		{
+			name:     "services and time range",
+			target:   URL,
+			body:     `{"services":["bar"],"start":"2024-01-01T00:00:00Z","end":"2024-01-01T00:30:00Z"}`,
+			expected: `1`,
+		},
+		{name: "trace", target: URL + "?traceID=" + first.String(), expected: `2`},
+		{name: "trace IDs", target: URL, body: `{"traceIDs":["` + second.String() + `","xyz","ff"]}`, expected: `1`},
+		{name: "filter", target: URL + "?filter=env=test", expected: `1`},
+		{name: "tenant", target: URL + "?tenant=other", expected: `0`},
+		{name: "dependencies", target: URL + "?target=dependencies"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			separator := "?"
+			if strings.Contains(test.target, "?") {
+				separator = "&"
+			}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, test.target+separator+"dry_run=true", strings.NewReader(test.body))
+			s.server.Handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var result map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+			if test.expected == "" {
+				assert.NotContains(t, result, "would_purge_spans")
+				return
+			}
+			assert.JSONEq(t, `{"dry_run":true,"would_purge":"storage","would_purge_spans":`+test.expected+`}`, w.Body.String())
+		})
+	}
+
+	count, err := factory.CountTraces(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// Codes of the error responses. They are stable, so that clients can key their
+// retry logic on them rather than on the error messages.
+const (
+	CodeUnauthorized         = "unauthorized"
+	CodePurgeDisabled        = "purge_disabled"
+	CodeInvalidRequest       = "invalid_request"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeConfirmationRequired = "confirmation_required"
+	CodePurgeInProgress      = "purge_in_progress"
+	CodeThrottled            = "throttled"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeAborted              = "aborted"
+	CodeNotImplemented       = "not_implemented"
+	CodePurgerMissing        = "purger_missing"
+	CodePurgeFailed          = "purge_failed"
+	CodeSchemaFailed         = "schema_failed"
+	CodeTraceNotFound        = "trace_not_found"
+	CodeStorageNotFound      = "storage_not_found"
+	CodeStorageUnavailable   = "storage_unavailable"
+	CodeTimeout              = "timeout"
+	CodePurgeTimeout         = "purge_timeout"
+	CodeStillNotEmpty        = "still_not_empty"
+	CodeInternalError        = "internal_error"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+)
+
+var (
+	errNotImplemented = errors.New("not implemented")
+	// errPurgerMissing is returned when a storage does not implement storage.Purger.
+	errPurgerMissing = errors.New("does not implement Purger interface")
+	// errNilFactory is returned when a broken host resolves a storage to a nil factory without an error.
+	errNilFactory = errors.New("storage factory is nil")
+	// errPurgeOnceDone is reported as a fatal error to stop the collector once purge_once is done.
+	errPurgeOnceDone = errors.New("storages purged once with purge_once, stopping the collector")
+	// errStorageWaitTimeout is returned when the storage extension hangs while resolving a factory.
+	errStorageWaitTimeout = errors.New("storage extension did not return the factory within storage_wait_timeout")
+	// errPurgeTimeout is returned when a purge runs longer than MaxPurgeDuration.
+	errPurgeTimeout = errors.New("purge exceeded max_purge_duration")
+	// errPurgeInProgress is returned in reject mode when another purge is running.
+	errPurgeInProgress = errors.New("another purge is in progress")
+)
+
+// errorResponse is the body of all error responses.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// timeoutResponse is the body written by http.TimeoutHandler, which only accepts a string.
+var timeoutResponse = mustMarshal(errorResponse{Error: "request timed out", Code: CodeTimeout})
+
+func mustMarshal(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// writeJSON writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	// messages may contain storage names or URLs, which must stay readable
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
+
+// writeError writes an error response with a machine-readable code.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, errorResponse{Error: message, Code: code})
+}
+
+// writePurgeError writes the error response of a failed purge.
+func writePurgeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotImplemented):
+		writeError(w, http.StatusNotImplemented, CodeNotImplemented, err.Error())
+	case errors.Is(err, spanstore.ErrTraceNotFound):
+		writeError(w, http.StatusNotFound, CodeTraceNotFound, err.Error())
+	case errors.Is(err, errSchemaFailed):
+		writeError(w, http.StatusInternalServerError, CodeSchemaFailed, err.Error())
+	case errors.Is(err, errPurgerMissing):
+		writeError(w, http.StatusInternalServerError, CodePurgerMissing, err.Error())
+	case errors.Is(err, errPurgeTimeout):
+		writeError(w, http.StatusGatewayTimeout, CodePurgeTimeout, err.Error())
+	case errors.Is(err, errStillNotEmpty):
+		writeError(w, http.StatusGatewayTimeout, CodeStillNotEmpty, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusInternalServerError, CodeAborted, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, CodePurgeFailed, err.Error())
+	}
+}
+
+// withJSONContentType makes responses default to JSON, including the ones
+// written by http.TimeoutHandler, which does not set a content type.
+func withJSONContentType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
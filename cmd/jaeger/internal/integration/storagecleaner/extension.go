@@ -5,17 +5,34 @@ package storagecleaner
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/confmap"
 	"go.opentelemetry.io/collector/extension"
+	"go.uber.org/zap"
 
 	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/cache"
 	"github.com/jaegertracing/jaeger/storage"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
 var (
@@ -24,58 +41,327 @@ var (
 )
 
 const (
-	Port = "9231"
-	URL  = "/purge"
+	Port       = "9231"
+	URL        = "/purge"
+	StatusURL  = "/status"
+	MetricsURL = "/metrics"
+	// ConfigURL is the path of the endpoint returning the effective configuration of the
+	// extension, i.e. after the collector expanded environment variables and Validate
+	// applied the defaults.
+	ConfigURL = "/config"
+
+	// IdempotencyKeyHeader is the request header identifying a purge request,
+	// so that a retried request does not purge again.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// RequestIDHeader is the header of purge and reset responses carrying the id correlating
+	// the request with its log lines and audit record. The id of the request is used when it
+	// has one, and a random one otherwise.
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength is the length above which the id of a request is replaced by a random one.
+	maxRequestIDLength = 128
+
+	// redacted replaces secrets in the response of the config endpoint.
+	redacted = "[REDACTED]"
+
+	// maxIdempotencyKeys is the maximum number of idempotency keys remembered at a time.
+	maxIdempotencyKeys = 1000
+)
+
+// StatusResponse is the body returned by the status endpoint. When several
+// storages are configured, Storage lists their comma-separated names and
+// Purger is true only if all of them implement storage.Purger.
+type StatusResponse struct {
+	Storage string `json:"storage"`
+	Purger  bool   `json:"purger"`
+	// Error and AvailableStorages help spotting a misspelled storage name.
+	Error             string   `json:"error,omitempty"`
+	Code              string   `json:"code,omitempty"`
+	AvailableStorages []string `json:"available_storages,omitempty"`
+	// TTLs are the retention periods of the storages implementing storage.TTLReporter, by name.
+	TTLs map[string]string `json:"ttls,omitempty"`
+	// Capabilities are the capabilities shared by all the storages.
+	Capabilities []Capability `json:"capabilities,omitempty"`
+}
+
+// Purge targets selected with the target query parameter.
+const (
+	targetTraces       = "traces"
+	targetDependencies = "dependencies"
 )
 
 type storageCleaner struct {
 	config   *Config
 	server   *http.Server
 	settings component.TelemetrySettings
+	host     component.Host
+	storages []namedStorage
+	// dependencyStorage is the storage purged with target=dependencies, nil when not configured.
+	dependencyStorage *namedStorage
+	metrics           *purgeMetrics
+	// purgesByKey remembers the results of recent purges by idempotency key.
+	purgesByKey cache.Cache
+
+	// shutdownCtx is cancelled on Shutdown to abort purges in flight.
+	shutdownCtx    context.Context
+	cancelShutdown context.CancelFunc
+	// purges tracks purges in flight, which may outlive their request
+	// when the handler times out, so that Shutdown can wait for them.
+	purges sync.WaitGroup
+	// purgeLock is a semaphore of size 1 ensuring that only one purge runs at a time.
+	purgeLock chan struct{}
+
+	failuresMu sync.Mutex
+	// consecutiveFailures counts the purges that failed since the last successful one.
+	consecutiveFailures int
+
+	// progress broadcasts the events of purges to the clients of the stream endpoint.
+	progress progressHub
+	// progressInterval is how often storages implementing storage.ProgressReporter are polled.
+	progressInterval time.Duration
+	// consistencyInterval is how often storages are read by purges with wait=true.
+	consistencyInterval time.Duration
+
+	throttleMu sync.Mutex
+	// lastPurge is when the last purge or reset request allowed by MinInterval arrived.
+	lastPurge time.Time
+
+	// audit records the purges in the file at AuditLogPath, nil when it is not set.
+	audit *auditLog
+
+	// clock drives the purges of the Schedule.
+	clock clock
+}
+
+// namedStorage is a storage factory resolved from the jaegerstorage extension.
+type namedStorage struct {
+	name    string
+	factory storage.Factory
+}
+
+// purgeRequest describes which data a purge should remove.
+type purgeRequest struct {
+	start    time.Time
+	end      time.Time
+	services []string
+	// storages restricts the purge to some of the configured storages.
+	storages []string
+	// dependencies selects the dependency links instead of the spans.
+	dependencies bool
+	// tenant restricts the purge to a single tenant of a multi-tenant storage.
+	tenant string
+	// allTenants purges every tenant of a multi-tenant storage one by one.
+	allTenants bool
+	// traceID restricts the purge to the spans of a single trace.
+	traceID *model.TraceID
+	// traceIDs lists traces purged one by one, as given in the request body, valid or not.
+	traceIDs []string
+	// pattern restricts the purge to the indices or keyspaces matching a glob pattern.
+	pattern string
+	// attribute restricts the purge to the spans with a tag, given as key=value.
+	attribute *attributeFilter
+	// batchSize, when greater than zero, makes the purge delete everything in batches of that many spans.
+	batchSize int
+	// wait makes the purge complete only once the storages no longer return any data.
+	wait bool
+	// expiredOnly restricts the purge to the data older than the TTL of the storages.
+	expiredOnly bool
+	// requestID correlates the log lines and the audit record of the purge, see RequestIDHeader.
+	requestID string
+}
+
+// attributeFilter selects the spans with a tag key of the given value.
+type attributeFilter struct {
+	key   string
+	value string
+}
+
+func (f attributeFilter) String() string {
+	return f.key + "=" + f.value
+}
+
+// purgeBody is the optional JSON body of a purge request. When present,
+// it replaces the service, start and end query parameters.
+type purgeBody struct {
+	Storages []string   `json:"storages"`
+	Services []string   `json:"services"`
+	Start    *time.Time `json:"start"`
+	End      *time.Time `json:"end"`
+	// TraceIDs lists traces to purge, whose outcomes are reported one by one.
+	TraceIDs []string `json:"traceIDs"`
+}
+
+// purgeMessage is returned by the purge endpoint when the storage does not report statistics.
+type purgeMessage struct {
+	Message string `json:"message"`
+}
+
+// purgeResult is returned by the purge endpoint when the storage reports statistics.
+type purgeResult struct {
+	DeletedSpans int64 `json:"deleted_spans"`
+	// Batches is the number of batches deleted by a purge with batch_size.
+	Batches int `json:"batches,omitempty"`
+	// Traces are the outcomes of the purges of the traces listed in the request body.
+	Traces []traceOutcome `json:"traces,omitempty"`
+}
+
+// Statuses of the traces listed in the body of a purge request.
+const (
+	tracePurged   = "purged"
+	traceNotFound = "not_found"
+	traceInvalid  = "invalid"
+	traceFailed   = "failed"
+)
+
+// traceOutcome reports the outcome of the purge of a trace listed in the body of a purge request.
+type traceOutcome struct {
+	TraceID string `json:"traceID"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// idempotentPurge is the result of a successful purge remembered by idempotency key.
+type idempotentPurge struct {
+	// fingerprint identifies the parameters of the purge, see purgeRequest.fingerprint.
+	fingerprint [sha256.Size]byte
+	result      *purgeResult
+}
+
+// fingerprint hashes the parameters selecting the purged data, so that an idempotency key
+// reused for a different purge is detected. The request id is left out.
+func (req purgeRequest) fingerprint() [sha256.Size]byte {
+	var traceID, attribute string
+	if req.traceID != nil {
+		traceID = req.traceID.String()
+	}
+	if req.attribute != nil {
+		attribute = req.attribute.String()
+	}
+	return sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%q|%q|%t|%q|%t|%q|%q|%q|%q|%d|%t|%t",
+		req.start.UTC().Format(time.RFC3339Nano), req.end.UTC().Format(time.RFC3339Nano),
+		req.services, req.storages, req.dependencies, req.tenant, req.allTenants, traceID,
+		req.traceIDs, req.pattern, attribute, req.batchSize, req.wait, req.expiredOnly)))
 }
 
 func newStorageCleaner(config *Config, telemetrySettings component.TelemetrySettings) *storageCleaner {
+	shutdownCtx, cancelShutdown := context.WithCancel(context.Background())
 	return &storageCleaner{
 		config:   config,
 		settings: telemetrySettings,
+		purgesByKey: cache.NewLRUWithOptions(maxIdempotencyKeys, &cache.Options{
+			TTL: config.IdempotencyKeyTTL,
+		}),
+		shutdownCtx:         shutdownCtx,
+		cancelShutdown:      cancelShutdown,
+		purgeLock:           make(chan struct{}, 1),
+		progressInterval:    defaultProgressInterval,
+		consistencyInterval: defaultConsistencyInterval,
+		clock:               realClock{},
 	}
 }
 
 func (c *storageCleaner) Start(ctx context.Context, host component.Host) error {
-	storageFactory, err := jaegerstorage.GetStorageFactory(c.config.TraceStorage, host)
-	if err != nil {
-		return fmt.Errorf("cannot find storage factory '%s': %w", c.config.TraceStorage, err)
-	}
-
-	purgeStorage := func() error {
-		purger, ok := storageFactory.(storage.Purger)
-		if !ok {
-			return fmt.Errorf("storage %s does not implement Purger interface", c.config.TraceStorage)
+	if len(c.config.storageNames()) == 0 {
+		name, err := c.singleStorage(host)
+		if err != nil {
+			return fmt.Errorf("cannot find storage factory: %w", err)
 		}
-		if err := purger.Purge(); err != nil {
-			return fmt.Errorf("error purging storage: %w", err)
+		c.config.TraceStorage = name
+	}
+	for _, name := range c.config.storageNames() {
+		storageFactory, err := c.waitForStorageFactory(ctx, name, host)
+		if err != nil {
+			err = fmt.Errorf("cannot find storage factory '%s': %w", name, err)
+			c.settings.ReportStatus(component.NewPermanentErrorEvent(err))
+			return err
 		}
-		return nil
+		c.storages = append(c.storages, namedStorage{name: name, factory: storageFactory})
 	}
-
-	purgeHandler := func(w http.ResponseWriter, r *http.Request) {
-		if err := purgeStorage(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	if name := c.config.DependencyStorage; name != "" {
+		storageFactory, err := c.waitForStorageFactory(ctx, name, host)
+		if err != nil {
+			err = fmt.Errorf("cannot find dependency storage factory '%s': %w", name, err)
+			c.settings.ReportStatus(component.NewPermanentErrorEvent(err))
+			return err
 		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Purge request processed successfully"))
+		c.dependencyStorage = &namedStorage{name: name, factory: storageFactory}
+	}
+	c.host = host
+	var err error
+	c.metrics, err = newPurgeMetrics(c.settings.MeterProvider)
+	if err != nil {
+		return fmt.Errorf("cannot create purge metrics: %w", err)
+	}
+	if c.config.PurgeOnce {
+		return c.purgeOnce(ctx)
 	}
 
 	r := mux.NewRouter()
-	r.HandleFunc(URL, purgeHandler).Methods(http.MethodPost)
+	prefix := c.config.PathPrefix
+	r.HandleFunc(prefix+URL, c.purgeHandler).Methods(http.MethodPost, http.MethodDelete)
+	r.HandleFunc(prefix+ResetURL, c.resetHandler).Methods(http.MethodPost)
+	r.HandleFunc(prefix+StatusURL, c.statusHandler).Methods(http.MethodGet)
+	r.HandleFunc(prefix+PingURL, c.pingHandler).Methods(http.MethodGet)
+	r.HandleFunc(prefix+ConfigURL, c.configHandler).Methods(http.MethodGet)
+	r.Handle(prefix+MetricsURL, promhttp.HandlerFor(c.metrics.registry, promhttp.HandlerOpts{})).Methods(http.MethodGet)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "not found")
+	})
+	root := mux.NewRouter()
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowedMethods(req, root, r), ", "))
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed")
+	})
+	var handler http.Handler = r
+	if c.config.HandlerTimeout > 0 {
+		handler = withJSONContentType(http.TimeoutHandler(r, c.config.HandlerTimeout, timeoutResponse))
+	}
+	// responses are compressed for clients sending Accept-Encoding: gzip or deflate
+	handler = handlers.CompressHandler(handler)
+	// the event stream can neither be buffered by the timeout handler nor by compression
+	root.HandleFunc(prefix+StreamURL, c.streamHandler).Methods(http.MethodGet)
+	root.NotFoundHandler = handler
+	root.MethodNotAllowedHandler = r.MethodNotAllowedHandler
 	c.server = &http.Server{
-		Addr:              ":" + c.config.Port,
-		Handler:           r,
-		ReadHeaderTimeout: 3 * time.Second,
+		Addr:              c.config.address(),
+		Handler:           root,
+		ReadHeaderTimeout: c.config.ReadHeaderTimeout,
+		WriteTimeout:      c.config.WriteTimeout,
+	}
+	if c.config.TLS.Enabled {
+		c.server.TLSConfig, err = c.config.TLS.Config(c.settings.Logger)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS config: %w", err)
+		}
+	}
+	var sched *schedule
+	if c.config.Schedule != "" {
+		if sched, err = parseSchedule(c.config.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+	if c.config.AuditLogPath != "" {
+		c.audit, err = openAuditLog(c.config.AuditLogPath, c.settings.Logger)
+		if err != nil {
+			return err
+		}
+	}
+	if c.config.MaxTraces > 0 {
+		c.startAutoPurge()
+	}
+	if sched != nil {
+		c.startSchedule(sched)
 	}
 	go func() {
-		if err := c.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if c.server.TLSConfig != nil {
+			// the certificates are provided by TLSConfig
+			err = c.server.ListenAndServeTLS("", "")
+		} else {
+			err = c.server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			err = fmt.Errorf("error starting cleaner server: %w", err)
 			c.settings.ReportStatus(component.NewFatalErrorEvent(err))
 		}
@@ -84,15 +370,955 @@ func (c *storageCleaner) Start(ctx context.Context, host component.Host) error {
 	return nil
 }
 
+// singleStorage returns the name of the only storage of the jaegerstorage extension,
+// purged when neither trace_storage nor trace_storages is set.
+func (c *storageCleaner) singleStorage(host component.Host) (string, error) {
+	names, err := jaegerstorage.ListStorageFactories(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errMissingTraceStorage, err)
+	}
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("%w, and no storage is configured", errMissingTraceStorage)
+	case 1:
+		c.settings.Logger.Info("trace_storage is not set, purging the only storage", zap.String("storage", names[0]))
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("%w to pick one of the storages %s", errMissingTraceStorage, strings.Join(names, ", "))
+	}
+}
+
+// allowedMethods returns the methods the routers serve for the path of the request,
+// for the Allow header of 405 Method Not Allowed responses.
+func allowedMethods(req *http.Request, routers ...*mux.Router) []string {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		candidate := req.Clone(req.Context())
+		candidate.Method = method
+		for _, router := range routers {
+			var match mux.RouteMatch
+			if router.Match(candidate, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// waitForStorageFactory resolves the storage factory, retrying with backoff for up to
+// StorageWaitTimeout. Although the cleaner depends on the jaegerstorage extension, a
+// storage extension may still be initializing its factories once its Start has returned.
+// A storage extension hanging while it is asked for the factory fails the wait all the same.
+func (c *storageCleaner) waitForStorageFactory(ctx context.Context, name string, host component.Host) (storage.Factory, error) {
+	deadline := time.Now().Add(c.config.StorageWaitTimeout)
+	backoff := defaultInitialBackoff
+	// the error of the last completed resolution, more telling than a timeout of the next one
+	var lastErr error
+	for {
+		resolveDeadline := deadline
+		if c.config.StorageWaitTimeout == 0 {
+			resolveDeadline = time.Time{}
+		}
+		storageFactory, err := getStorageFactory(ctx, name, host, resolveDeadline)
+		switch {
+		case errors.Is(err, errStorageWaitTimeout) && lastErr != nil:
+			return nil, lastErr
+		case errors.Is(err, errStorageWaitTimeout):
+			return nil, fmt.Errorf("%w (%v)", err, c.config.StorageWaitTimeout)
+		case err != nil && errors.Is(err, ctx.Err()):
+			return nil, err
+		}
+		if err == nil && storageFactory == nil {
+			err = errNilFactory
+		}
+		if err == nil || !time.Now().Before(deadline) {
+			return storageFactory, err
+		}
+		lastErr = err
+		c.settings.Logger.Debug("Waiting for storage factory", zap.String("storage", name), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		case <-time.After(min(backoff, time.Until(deadline))):
+		}
+		backoff = min(2*backoff, defaultMaxBackoff)
+	}
+}
+
+// getStorageFactory resolves the storage factory, giving up at the deadline, unless it is zero,
+// or once ctx is done. The resolution cannot be cancelled, a hung one is left running in the background.
+func getStorageFactory(ctx context.Context, name string, host component.Host, deadline time.Time) (storage.Factory, error) {
+	type resolution struct {
+		factory storage.Factory
+		err     error
+	}
+	done := make(chan resolution, 1)
+	go func() {
+		f, err := jaegerstorage.GetStorageFactory(name, host)
+		done <- resolution{factory: f, err: err}
+	}()
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case r := <-done:
+		return r.factory, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-expired:
+		return nil, errStorageWaitTimeout
+	}
+}
+
+// purge removes the data described by req from all configured storages in sequence.
+// The returned result is nil when none of the storages report statistics.
+func (c *storageCleaner) purge(ctx context.Context, req purgeRequest) (*purgeResult, error) {
+	storages := c.targetStorages(req)
+	names := make([]string, len(storages))
+	for i, s := range storages {
+		names[i] = s.name
+	}
+	c.progress.publish(purgeEvent{typ: eventStart, Storages: names})
+	var result *purgeResult
+	var err error
+	if len(req.traceIDs) > 0 {
+		result, err = c.purgeTraceIDs(ctx, req, storages)
+	} else {
+		result, err = c.purgeStorages(ctx, req, storages)
+	}
+	if err == nil && req.wait {
+		err = c.waitUntilEmpty(ctx, storages)
+	}
+	end := purgeEvent{typ: eventEnd}
+	if err != nil {
+		end.Error = err.Error()
+	} else if result != nil {
+		end.DeletedSpans = result.DeletedSpans
+	}
+	c.progress.publish(end)
+	return result, err
+}
+
+// boundedPurge runs the purge and calls release once it returns. With MaxPurgeDuration,
+// the purge is cancelled when it runs longer, and errPurgeTimeout is returned right away.
+// A storage ignoring the cancellation then keeps purging in the background, still holding
+// the purge lock and counting as in flight, so that no other purge overlaps it.
+func (c *storageCleaner) boundedPurge(ctx context.Context, req purgeRequest, release func()) (*purgeResult, error) {
+	if c.config.MaxPurgeDuration <= 0 {
+		defer release()
+		return c.purge(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.config.MaxPurgeDuration)
+	type outcome struct {
+		result *purgeResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	c.purges.Add(1)
+	go func() {
+		defer c.purges.Done()
+		defer cancel()
+		defer release()
+		result, err := c.purge(ctx, req)
+		done <- outcome{result: result, err: err}
+	}()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// aborted by the client or the shutdown, the purge observes it as well
+			o := <-done
+			return o.result, o.err
+		}
+		go func() {
+			o := <-done
+			c.settings.Logger.Warn("Purge exceeding max_purge_duration has returned",
+				zap.String("request_id", req.requestID), zap.Error(o.err))
+		}()
+		return nil, fmt.Errorf("%w (%v)", errPurgeTimeout, c.config.MaxPurgeDuration)
+	}
+}
+
+// purgeStorages purges the storages in sequence and sums up their statistics.
+func (c *storageCleaner) purgeStorages(ctx context.Context, req purgeRequest, storages []namedStorage) (*purgeResult, error) {
+	var result *purgeResult
+	var errs []error
+	// a trace is usually stored in a single storage, it is only reported as
+	// not found when none of the storages has it
+	notFound := 0
+	for _, s := range storages {
+		stopProgress := c.reportProgress(s)
+		storageResult, err := withRetry(ctx, c.config.Retry, func() (*purgeResult, error) {
+			return purgeStorage(ctx, s, req)
+		})
+		stopProgress()
+		if req.traceID != nil && errors.Is(err, spanstore.ErrTraceNotFound) {
+			notFound++
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if storageResult != nil {
+			if result == nil {
+				result = &purgeResult{}
+			}
+			result.DeletedSpans += storageResult.DeletedSpans
+			result.Batches += storageResult.Batches
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if notFound > 0 && notFound == len(storages) {
+		return nil, fmt.Errorf("trace %s: %w", req.traceID, spanstore.ErrTraceNotFound)
+	}
+	return result, nil
+}
+
+// purgeTraceIDs purges the traces listed in the request one by one, reporting the outcome
+// of each. A trace that is invalid, not found or fails to be purged does not stop the others,
+// only storages that cannot purge traces at all fail the request.
+func (c *storageCleaner) purgeTraceIDs(ctx context.Context, req purgeRequest, storages []namedStorage) (*purgeResult, error) {
+	result := &purgeResult{Traces: make([]traceOutcome, 0, len(req.traceIDs))}
+	for _, v := range req.traceIDs {
+		outcome := traceOutcome{TraceID: v, Status: tracePurged}
+		traceID, err := model.TraceIDFromString(v)
+		if err != nil || traceID == (model.TraceID{}) {
+			outcome.Status, outcome.Error = traceInvalid, "must be a non-zero hexadecimal trace ID"
+			result.Traces = append(result.Traces, outcome)
+			continue
+		}
+		traceReq := req
+		traceReq.traceIDs, traceReq.traceID = nil, &traceID
+		switch _, err := c.purgeStorages(ctx, traceReq, storages); {
+		case errors.Is(err, errNotImplemented):
+			return nil, err
+		case errors.Is(err, spanstore.ErrTraceNotFound):
+			outcome.Status = traceNotFound
+		case err != nil:
+			outcome.Status, outcome.Error = traceFailed, err.Error()
+		}
+		result.Traces = append(result.Traces, outcome)
+	}
+	return result, nil
+}
+
+// targetStorages returns the storages a purge request applies to.
+func (c *storageCleaner) targetStorages(req purgeRequest) []namedStorage {
+	if req.dependencies && c.dependencyStorage != nil {
+		return []namedStorage{*c.dependencyStorage}
+	}
+	if len(req.storages) == 0 {
+		return c.storages
+	}
+	var storages []namedStorage
+	for _, s := range c.storages {
+		if slices.Contains(req.storages, s.name) {
+			storages = append(storages, s)
+		}
+	}
+	return storages
+}
+
+// purgeStorage removes the data described by req from a single storage.
+func purgeStorage(ctx context.Context, s namedStorage, req purgeRequest) (*purgeResult, error) {
+	if s.factory == nil {
+		return nil, fmt.Errorf("cannot purge storage %s: %w", s.name, errNilFactory)
+	}
+	if req.dependencies {
+		dependencyPurger, ok := s.factory.(storage.DependencyPurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging dependencies: %w", s.name, errNotImplemented)
+		}
+		if err := dependencyPurger.PurgeDependencies(ctx); err != nil {
+			return nil, fmt.Errorf("error purging dependencies from storage %s: %w", s.name, err)
+		}
+		return nil, nil
+	}
+	if req.tenant != "" || req.allTenants {
+		return nil, purgeTenants(ctx, s, req)
+	}
+	if req.traceID != nil {
+		tracePurger, ok := s.factory.(storage.TracePurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging a trace: %w", s.name, errNotImplemented)
+		}
+		if err := tracePurger.PurgeTrace(ctx, *req.traceID); err != nil {
+			return nil, fmt.Errorf("error purging trace %s from storage %s: %w", req.traceID, s.name, err)
+		}
+		return nil, nil
+	}
+	if req.pattern != "" {
+		patternPurger, ok := s.factory.(storage.PatternPurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging a pattern: %w", s.name, errNotImplemented)
+		}
+		if err := patternPurger.PurgePattern(ctx, req.pattern); err != nil {
+			return nil, fmt.Errorf("error purging pattern %s from storage %s: %w", req.pattern, s.name, err)
+		}
+		return nil, nil
+	}
+	if req.attribute != nil {
+		attributePurger, ok := s.factory.(storage.AttributePurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging by attribute: %w", s.name, errNotImplemented)
+		}
+		if err := attributePurger.PurgeByAttribute(ctx, req.attribute.key, req.attribute.value); err != nil {
+			return nil, fmt.Errorf("error purging spans with %s from storage %s: %w", req.attribute, s.name, err)
+		}
+		return nil, nil
+	}
+	if req.expiredOnly {
+		expiredPurger, ok := s.factory.(storage.ExpiredPurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging expired data: %w", s.name, errNotImplemented)
+		}
+		if err := expiredPurger.PurgeExpired(ctx); err != nil {
+			return nil, fmt.Errorf("error purging expired data from storage %s: %w", s.name, err)
+		}
+		return nil, nil
+	}
+	if req.batchSize > 0 {
+		batchPurger, ok := s.factory.(storage.BatchPurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging in batches: %w", s.name, errNotImplemented)
+		}
+		batches, err := batchPurger.PurgeBatched(ctx, req.batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("error purging storage %s in batches: %w", s.name, err)
+		}
+		return &purgeResult{Batches: batches}, nil
+	}
+	purger, ok := storage.GetPurger(s.factory)
+	if !ok {
+		return nil, fmt.Errorf("storage %s %w", s.name, errPurgerMissing)
+	}
+	if len(req.services) > 0 && (!req.start.IsZero() || !req.end.IsZero()) {
+		serviceRangePurger, ok := s.factory.(storage.ServiceRangePurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging a service time range: %w", s.name, errNotImplemented)
+		}
+		for _, service := range req.services {
+			if err := serviceRangePurger.PurgeServiceRange(ctx, service, req.start, req.end); err != nil {
+				return nil, fmt.Errorf("error purging service %s time range from storage %s: %w", service, s.name, err)
+			}
+		}
+		return nil, nil
+	}
+	if len(req.services) > 0 {
+		servicePurger, ok := s.factory.(storage.ServicePurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging a service: %w", s.name, errNotImplemented)
+		}
+		for _, service := range req.services {
+			if err := servicePurger.PurgeService(ctx, service); err != nil {
+				return nil, fmt.Errorf("error purging service %s from storage %s: %w", service, s.name, err)
+			}
+		}
+		return nil, nil
+	}
+	if !req.start.IsZero() || !req.end.IsZero() {
+		rangePurger, ok := s.factory.(storage.RangePurger)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support purging a time range: %w", s.name, errNotImplemented)
+		}
+		if err := rangePurger.PurgeRange(ctx, req.start, req.end); err != nil {
+			return nil, fmt.Errorf("error purging storage %s time range: %w", s.name, err)
+		}
+		return nil, nil
+	}
+	if statsPurger, ok := s.factory.(storage.StatsPurger); ok {
+		deleted, err := statsPurger.PurgeWithStats(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error purging storage %s: %w", s.name, err)
+		}
+		return &purgeResult{DeletedSpans: deleted}, nil
+	}
+	if err := purger.Purge(ctx); err != nil {
+		return nil, fmt.Errorf("error purging storage %s: %w", s.name, err)
+	}
+	return nil, nil
+}
+
+// purgeTenants removes the data of the requested tenant, or of all tenants, from the storage.
+func purgeTenants(ctx context.Context, s namedStorage, req purgeRequest) error {
+	tenantPurger, ok := s.factory.(storage.TenantPurger)
+	if !ok {
+		return fmt.Errorf("storage %s does not support purging tenants: %w", s.name, errNotImplemented)
+	}
+	tenants := []string{req.tenant}
+	if req.allTenants {
+		var err error
+		tenants, err = tenantPurger.Tenants(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing tenants of storage %s: %w", s.name, err)
+		}
+	}
+	for _, tenant := range tenants {
+		if err := tenantPurger.PurgeTenant(ctx, tenant); err != nil {
+			return fmt.Errorf("error purging tenant %s from storage %s: %w", tenant, s.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *storageCleaner) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := setRequestID(w, r)
+	if !c.authorized(r) {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	if !c.purgeEnabled(w) {
+		return
+	}
+	if c.config.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, c.config.MaxBodyBytes)
+	}
+	req, err := c.parsePurgeRequest(r)
+	req.requestID = requestID
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+				fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	callbackURL, err := parseCallbackURL(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+		c.dryRunHandler(w, r, req)
+		return
+	}
+	if !c.confirmed(w, r) {
+		return
+	}
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key != "" {
+		if prior, ok := c.purgesByKey.Get(key).(idempotentPurge); ok {
+			if prior.fingerprint != req.fingerprint() {
+				writeError(w, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+					fmt.Sprintf("%s was already used for a purge with different parameters", IdempotencyKeyHeader))
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			writePurgeResult(w, prior.result)
+			return
+		}
+	}
+	if c.throttled(w) {
+		return
+	}
+	if callbackURL != "" {
+		c.startAsyncPurge(w, r, req, key, callbackURL)
+		return
+	}
+	c.purges.Add(1)
+	defer c.purges.Done()
+	// The purge is aborted when either the client goes away or the extension shuts down.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(c.shutdownCtx, cancel)
+	defer stop()
+
+	if err := c.acquirePurge(ctx); err != nil {
+		if errors.Is(err, errPurgeInProgress) {
+			writeError(w, http.StatusConflict, CodePurgeInProgress, err.Error())
+		} else {
+			writeError(w, http.StatusServiceUnavailable, CodeAborted, fmt.Sprintf("aborted while waiting for another purge: %v", err))
+		}
+		return
+	}
+	purgeStart := time.Now()
+	result, err := c.boundedPurge(ctx, req, c.releasePurge)
+	c.recordPurge(r.Context(), purgeStart, err)
+	c.logPurge(r, req, time.Since(purgeStart), err)
+	if err != nil {
+		writePurgeError(w, err)
+		return
+	}
+	// only successful purges are remembered, so that failed ones can be retried
+	if key != "" {
+		c.purgesByKey.Put(key, idempotentPurge{fingerprint: req.fingerprint(), result: result})
+	}
+	writePurgeResult(w, result)
+}
+
+// purgeEnabled responds with 403 Forbidden when purges are disabled by the configuration.
+func (c *storageCleaner) purgeEnabled(w http.ResponseWriter) bool {
+	if c.config.Purge.enabled() {
+		return true
+	}
+	writeError(w, http.StatusForbidden, CodePurgeDisabled, "purges are disabled by the configuration")
+	return false
+}
+
+// confirmed checks the confirm query parameter when RequireConfirmation is set,
+// and responds with an error when it does not match.
+func (c *storageCleaner) confirmed(w http.ResponseWriter, r *http.Request) bool {
+	if !c.config.RequireConfirmation {
+		return true
+	}
+	// several storages are confirmed with their comma-separated names, like in the status response
+	expected := strings.Join(c.config.storageNames(), ",")
+	if r.URL.Query().Get("confirm") != expected {
+		writeError(w, http.StatusBadRequest, CodeConfirmationRequired,
+			fmt.Sprintf("purge must be confirmed with the confirm=%s query parameter", expected))
+		return false
+	}
+	return true
+}
+
+// throttled rejects the request with 429 Too Many Requests and a Retry-After header
+// when it arrives within MinInterval of the last allowed purge, otherwise it starts
+// a new cooldown.
+func (c *storageCleaner) throttled(w http.ResponseWriter) bool {
+	if c.config.MinInterval <= 0 {
+		return false
+	}
+	c.throttleMu.Lock()
+	defer c.throttleMu.Unlock()
+	now := time.Now()
+	if wait := c.lastPurge.Add(c.config.MinInterval).Sub(now); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, CodeThrottled,
+			fmt.Sprintf("purges are limited to one every %v, retry in %v", c.config.MinInterval, wait.Round(time.Millisecond)))
+		return true
+	}
+	c.lastPurge = now
+	return false
+}
+
+// recordPurge updates the purge metrics, and reports the extension to the collector as
+// degraded once FailureThreshold purges in a row have failed, which usually means that
+// the backend is broken rather than transiently unavailable. The next successful purge
+// reports it as recovered. Purges aborted by the client or by Shutdown are not counted.
+func (c *storageCleaner) recordPurge(ctx context.Context, start time.Time, err error) {
+	c.metrics.record(ctx, start, err)
+	if c.config.FailureThreshold <= 0 || errors.Is(err, context.Canceled) {
+		return
+	}
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+	if err == nil {
+		if c.consecutiveFailures >= c.config.FailureThreshold {
+			c.settings.ReportStatus(component.NewStatusEvent(component.StatusOK))
+		}
+		c.consecutiveFailures = 0
+		return
+	}
+	c.consecutiveFailures++
+	if c.consecutiveFailures >= c.config.FailureThreshold {
+		c.settings.ReportStatus(component.NewRecoverableErrorEvent(
+			fmt.Errorf("%d consecutive purges failed, last error: %w", c.consecutiveFailures, err)))
+	}
+}
+
+// acquirePurge waits until no other purge is running, or fails right away
+// with errPurgeInProgress when the concurrency setting is ConcurrencyReject.
+// Every successful call must be followed by releasePurge.
+func (c *storageCleaner) acquirePurge(ctx context.Context) error {
+	if c.config.Concurrency == ConcurrencyReject {
+		select {
+		case c.purgeLock <- struct{}{}:
+			return nil
+		default:
+			return errPurgeInProgress
+		}
+	}
+	select {
+	case c.purgeLock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *storageCleaner) releasePurge() {
+	<-c.purgeLock
+}
+
+// parsePurgeRequest describes the purge from the JSON body of the request
+// or, when there is none, from its query parameters.
+func (c *storageCleaner) parsePurgeRequest(r *http.Request) (purgeRequest, error) {
+	var req purgeRequest
+	var body purgeBody
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	switch err := decoder.Decode(&body); {
+	case errors.Is(err, io.EOF):
+		start, end, err := parseTimeRange(r)
+		if err != nil {
+			return req, err
+		}
+		req.start, req.end = start, end
+		if service := r.URL.Query().Get("service"); service != "" {
+			if !start.IsZero() || !end.IsZero() {
+				return req, errors.New("service cannot be combined with start or end")
+			}
+			req.services = []string{service}
+		}
+	case err != nil:
+		return req, fmt.Errorf("malformed request body: %w", err)
+	default:
+		req.services = body.Services
+		if body.Start != nil {
+			req.start = *body.Start
+		}
+		if body.End != nil {
+			req.end = *body.End
+		}
+		if slices.Contains(req.services, "") {
+			return req, errors.New("services must not contain empty names")
+		}
+		names := c.config.storageNames()
+		for _, name := range body.Storages {
+			if !slices.Contains(names, name) {
+				return req, fmt.Errorf("storage %q is not configured for purging, must be one of %s", name, strings.Join(names, ","))
+			}
+		}
+		req.storages = body.Storages
+		req.traceIDs = body.TraceIDs
+	}
+	switch target := r.URL.Query().Get("target"); target {
+	case "", targetTraces:
+	case targetDependencies:
+		req.dependencies = true
+	default:
+		return req, fmt.Errorf("invalid target %q, must be %q or %q", target, targetTraces, targetDependencies)
+	}
+	req.tenant = r.URL.Query().Get("tenant")
+	if v := r.URL.Query().Get("all_tenants"); v != "" {
+		allTenants, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid all_tenants %q: %w", v, err)
+		}
+		req.allTenants = allTenants
+	}
+	if req.tenant != "" && req.allTenants {
+		return req, errors.New("tenant cannot be combined with all_tenants")
+	}
+	if v := r.URL.Query().Get("traceID"); v != "" {
+		traceID, err := model.TraceIDFromString(v)
+		if err != nil || traceID == (model.TraceID{}) {
+			return req, fmt.Errorf("invalid traceID %q, must be a non-zero hexadecimal trace ID", v)
+		}
+		req.traceID = &traceID
+	}
+	if pattern := r.URL.Query().Get("pattern"); pattern != "" {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return req, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		req.pattern = pattern
+	}
+	if v := r.URL.Query().Get("filter"); v != "" {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return req, fmt.Errorf("invalid filter %q, must be key=value", v)
+		}
+		req.attribute = &attributeFilter{key: key, value: value}
+	}
+	if v := r.URL.Query().Get("batch_size"); v != "" {
+		batchSize, err := strconv.Atoi(v)
+		if err != nil || batchSize <= 0 {
+			return req, fmt.Errorf("invalid batch_size %q, must be a positive integer", v)
+		}
+		req.batchSize = batchSize
+	}
+	if v := r.URL.Query().Get("expired_only"); v != "" {
+		expiredOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid expired_only %q: %w", v, err)
+		}
+		req.expiredOnly = expiredOnly
+	}
+	if v := r.URL.Query().Get("wait"); v != "" {
+		wait, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid wait %q: %w", v, err)
+		}
+		req.wait = wait
+	}
+	return req, checkPurgeScope(req)
+}
+
+// checkPurgeScope rejects requests selecting more than one scope of the data to purge.
+// batch_size and expired_only change how everything is purged, so they exclude the scopes too.
+func checkPurgeScope(req purgeRequest) error {
+	scopes := []struct {
+		name     string
+		selected bool
+	}{
+		{"target=dependencies", req.dependencies},
+		{"traceID", req.traceID != nil},
+		{"traceIDs", len(req.traceIDs) > 0},
+		{"service", len(req.services) > 0},
+		// a time range restricts the services when both are set
+		{"start or end", len(req.services) == 0 && (!req.start.IsZero() || !req.end.IsZero())},
+		{"tenant or all_tenants", req.tenant != "" || req.allTenants},
+		{"pattern", req.pattern != ""},
+		{"filter", req.attribute != nil},
+		{"batch_size", req.batchSize > 0},
+		{"expired_only", req.expiredOnly},
+	}
+	var names, selected []string
+	for _, scope := range scopes {
+		names = append(names, scope.name)
+		if scope.selected {
+			selected = append(selected, scope.name)
+		}
+	}
+	if len(selected) > 1 {
+		return fmt.Errorf("only one of %s can be set, got %s", strings.Join(names, ", "), strings.Join(selected, " and "))
+	}
+	// only a purge of everything leaves the storages empty
+	if req.wait && len(selected) == 1 && selected[0] != "batch_size" {
+		return fmt.Errorf("wait cannot be combined with %s", selected[0])
+	}
+	return nil
+}
+
+// logPurge leaves an audit trail of who purged which storages.
+func (c *storageCleaner) logPurge(r *http.Request, req purgeRequest, duration time.Duration, err error) {
+	storages := c.targetStorages(req)
+	names := make([]string, 0, len(storages))
+	for _, s := range storages {
+		names = append(names, s.name)
+	}
+	fields := []zap.Field{
+		zap.String("request_id", req.requestID),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.Strings("storages", names),
+		zap.Duration("duration", duration),
+	}
+	if req.dependencies {
+		fields = append(fields, zap.String("target", targetDependencies))
+	}
+	if len(req.services) > 0 {
+		fields = append(fields, zap.Strings("services", req.services))
+	}
+	if req.tenant != "" {
+		fields = append(fields, zap.String("tenant", req.tenant))
+	}
+	if req.allTenants {
+		fields = append(fields, zap.Bool("all_tenants", true))
+	}
+	if req.traceID != nil {
+		fields = append(fields, zap.Stringer("trace_id", req.traceID))
+	}
+	if len(req.traceIDs) > 0 {
+		fields = append(fields, zap.Strings("trace_ids", req.traceIDs))
+	}
+	if req.pattern != "" {
+		fields = append(fields, zap.String("pattern", req.pattern))
+	}
+	if req.attribute != nil {
+		fields = append(fields, zap.Stringer("filter", req.attribute))
+	}
+	if req.batchSize > 0 {
+		fields = append(fields, zap.Int("batch_size", req.batchSize))
+	}
+	if req.expiredOnly {
+		fields = append(fields, zap.Bool("expired_only", true))
+		if ttls := storageTTLs(storages); len(ttls) > 0 {
+			fields = append(fields, zap.Any("ttls", ttls))
+		}
+	}
+	if req.wait {
+		fields = append(fields, zap.Bool("wait", true))
+	}
+	if !req.start.IsZero() {
+		fields = append(fields, zap.Time("start", req.start))
+	}
+	if !req.end.IsZero() {
+		fields = append(fields, zap.Time("end", req.end))
+	}
+	c.auditPurge(req.requestID, r.RemoteAddr, names, err)
+	if err != nil {
+		c.settings.Logger.Error("Purge failed", append(fields, zap.String("outcome", "failure"), zap.Error(err))...)
+		return
+	}
+	c.settings.Logger.Info("Purge completed", append(fields, zap.String("outcome", "success"))...)
+}
+
+// setRequestID returns the id of the request from RequestIDHeader, or a random one when
+// it has none or a longer one than maxRequestIDLength, and echoes it in the response.
+func setRequestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = newRandomID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// storageTTLs returns the retention periods of the storages implementing storage.TTLReporter, by name.
+func storageTTLs(storages []namedStorage) map[string]string {
+	ttls := make(map[string]string)
+	for _, s := range storages {
+		if reporter, ok := s.factory.(storage.TTLReporter); ok {
+			ttls[s.name] = reporter.TTL().String()
+		}
+	}
+	return ttls
+}
+
+func writePurgeResult(w http.ResponseWriter, result *purgeResult) {
+	if result != nil {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	writeJSON(w, http.StatusOK, purgeMessage{Message: "Purge request processed successfully"})
+}
+
+// configHandler returns the effective configuration with the keys of the collector config,
+// so that one can check which storages a purge actually targets. The auth token is redacted.
+// It requires the same bearer token as purge requests, since it exposes the deployment.
+func (c *storageCleaner) configHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.authorized(r) {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	conf := confmap.New()
+	if err := conf.Marshal(c.config); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternalError, fmt.Sprintf("cannot marshal config: %v", err))
+		return
+	}
+	effective := conf.ToStringMap()
+	if c.config.AuthToken != "" {
+		effective["auth_token"] = redacted
+	}
+	writeJSON(w, http.StatusOK, effective)
+}
+
+func (c *storageCleaner) statusHandler(w http.ResponseWriter, _ *http.Request) {
+	// resolve the factories on every request so that the status reflects the current state of the host
+	status := http.StatusOK
+	names := c.config.storageNames()
+	resp := StatusResponse{Storage: strings.Join(names, ","), Purger: true}
+	for i, name := range names {
+		f, err := jaegerstorage.GetStorageFactory(name, c.host)
+		if err != nil {
+			status, resp.Code = http.StatusServiceUnavailable, CodeStorageUnavailable
+			var notFound *jaegerstorage.StorageNotFoundError
+			if errors.As(err, &notFound) {
+				status, resp.Code = http.StatusNotFound, CodeStorageNotFound
+				resp.AvailableStorages = notFound.Available
+			}
+			resp.Purger, resp.Capabilities = false, nil
+			resp.Error = err.Error()
+			break
+		}
+		capabilities := jaegerstorage.FactoryCapabilities(f)
+		if !capabilities.Purger {
+			resp.Purger = false
+		}
+		if reporter, ok := f.(storage.TTLReporter); ok {
+			if resp.TTLs == nil {
+				resp.TTLs = make(map[string]string)
+			}
+			resp.TTLs[name] = reporter.TTL().String()
+		}
+		if i == 0 {
+			resp.Capabilities = capabilityNames(capabilities)
+		} else {
+			resp.Capabilities = intersectCapabilities(resp.Capabilities, capabilityNames(capabilities))
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// shutdownPurge purges all storages once the purges in flight, cancelled by the shutdown, are done.
+func (c *storageCleaner) shutdownPurge(ctx context.Context) error {
+	// unlike acquirePurge, waits for the lock regardless of the concurrency setting
+	select {
+	case c.purgeLock <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("error purging on shutdown: %w", ctx.Err())
+	}
+	defer c.releasePurge()
+	start := time.Now()
+	_, err := c.purge(ctx, purgeRequest{})
+	c.recordPurge(ctx, start, err)
+	if err != nil {
+		return fmt.Errorf("error purging on shutdown: %w", err)
+	}
+	c.settings.Logger.Info("Purged storages on shutdown", zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+// Shutdown stops the server, aborts purges in flight and waits for them to
+// return, unless ctx is done first. With purge_on_shutdown, the storages are
+// purged before the server is stopped.
 func (c *storageCleaner) Shutdown(ctx context.Context) error {
+	c.cancelShutdown()
+	var purgeErr error
+	if c.config.PurgeOnShutdown && len(c.storages) > 0 {
+		purgeErr = c.shutdownPurge(ctx)
+	}
 	if c.server != nil {
 		if err := c.server.Shutdown(ctx); err != nil {
-			return fmt.Errorf("error shutting down cleaner server: %w", err)
+			return errors.Join(purgeErr, fmt.Errorf("error shutting down cleaner server: %w", err))
 		}
 	}
-	return nil
+	// purges of storages that do not observe cancellation run to completion
+	done := make(chan struct{})
+	go func() {
+		c.purges.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+		// purges in flight may still record to the audit log otherwise
+		err = c.closeAudit()
+	case <-ctx.Done():
+		err = fmt.Errorf("error waiting for purges in flight: %w", ctx.Err())
+	}
+	return errors.Join(purgeErr, err, c.config.TLS.Close())
 }
 
 func (c *storageCleaner) Dependencies() []component.ID {
 	return []component.ID{jaegerstorage.ID}
 }
+
+// authorized checks the bearer token of the request against the configured one.
+// All requests are authorized when no token is configured.
+func (c *storageCleaner) authorized(r *http.Request) bool {
+	if c.config.AuthToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.config.AuthToken)) == 1
+}
+
+// parseTimeRange extracts the optional RFC3339 "start" and "end" query parameters.
+func parseTimeRange(r *http.Request) (start, end time.Time, err error) {
+	query := r.URL.Query()
+	if v := query.Get("start"); v != "" {
+		if start, err = time.Parse(time.RFC3339, v); err != nil {
+			return start, end, fmt.Errorf("invalid start time: %w", err)
+		}
+	}
+	if v := query.Get("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			return start, end, fmt.Errorf("invalid end time: %w", err)
+		}
+	}
+	return start, end, nil
+}
@@ -4,9 +4,20 @@
 package storagecleaner
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -15,10 +26,22 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/config/tlscfg"
+	memoryCfg "github.com/jaegertracing/jaeger/pkg/memory/config"
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/memory"
 	"github.com/jaegertracing/jaeger/storage"
 	factoryMocks "github.com/jaegertracing/jaeger/storage/mocks"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
 var (
@@ -26,18 +49,120 @@ var (
 	_ storage.Factory         = (*PurgerFactory)(nil)
 )
 
+// PurgerFactory is the fake storage of the tests. It implements the legacy storage.Purger,
+// and its purges can be made to fail, to take time, or to wait for the test.
 type PurgerFactory struct {
 	factoryMocks.Factory
-	err error
+	err   error
+	delay time.Duration
+	// failures, when set, limits err to the first failures purges.
+	failures int32
+	// started, when set, receives a value as each purge starts. The purge then waits for
+	// release to be closed or, when release is nil, for its context to be done.
+	started chan struct{}
+	release chan struct{}
+
+	calls      atomic.Int32
+	completed  atomic.Int32
+	running    atomic.Int32
+	maxRunning atomic.Int32
 }
 
 func (f *PurgerFactory) Purge() error {
+	return f.purge(context.Background())
+}
+
+func (f *PurgerFactory) purge(ctx context.Context) error {
+	calls := f.calls.Add(1)
+	running := f.running.Add(1)
+	defer f.running.Add(-1)
+	for {
+		prev := f.maxRunning.Load()
+		if running <= prev || f.maxRunning.CompareAndSwap(prev, running) {
+			break
+		}
+	}
+	if f.started != nil {
+		f.started <- struct{}{}
+		if f.release == nil {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		<-f.release
+	}
+	time.Sleep(f.delay)
+	f.completed.Add(1)
+	if f.failures > 0 && calls > f.failures {
+		return nil
+	}
+	return f.err
+}
+
+// CreateSpanReader returns an empty reader, so that dry runs find nothing to purge.
+func (*PurgerFactory) CreateSpanReader() (spanstore.Reader, error) {
+	return memory.NewStore(), nil
+}
+
+// ContextPurgerFactory implements storage.Purger instead of its legacy version,
+// so that its purges can be cancelled.
+type ContextPurgerFactory struct {
+	PurgerFactory
+}
+
+func (f *ContextPurgerFactory) Purge(ctx context.Context) error {
+	return f.purge(ctx)
+}
+
+type StatsPurgerFactory struct {
+	PurgerFactory
+	deleted int64
+}
+
+func (f *StatsPurgerFactory) PurgeWithStats(ctx context.Context) (int64, error) {
+	if err := f.purge(ctx); err != nil {
+		return 0, err
+	}
+	return f.deleted, nil
+}
+
+type DependencyPurgerFactory struct {
+	PurgerFactory
+	dependencyCalls atomic.Int32
+}
+
+func (f *DependencyPurgerFactory) PurgeDependencies(context.Context) error {
+	f.dependencyCalls.Add(1)
 	return f.err
 }
 
+// TenantPurgerFactory records the tenants it purges.
+type TenantPurgerFactory struct {
+	PurgerFactory
+	tenants   []string
+	listErr   error
+	tenantErr error
+	mu        sync.Mutex
+	purged    []string
+}
+
+func (f *TenantPurgerFactory) PurgeTenant(_ context.Context, tenant string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.purged = append(f.purged, tenant)
+	return f.tenantErr
+}
+
+func (f *TenantPurgerFactory) Tenants(context.Context) ([]string, error) {
+	return f.tenants, f.listErr
+}
+
 type mockStorageExt struct {
-	name    string
-	factory storage.Factory
+	name      string
+	factory   storage.Factory
+	factories map[string]storage.Factory
+	// ready, when set, is called on every lookup, which finds no factory until it returns true,
+	// e.g. to simulate a storage extension initializing its factories in the background.
+	ready func() bool
 }
 
 func (m *mockStorageExt) Start(ctx context.Context, host component.Host) error {
@@ -48,11 +173,27 @@ func (m *mockStorageExt) Shutdown(ctx context.Context) error {
 	panic("not implemented")
 }
 
+func (m *mockStorageExt) StorageNames() []string {
+	var names []string
+	if m.name != "" {
+		names = append(names, m.name)
+	}
+	for name := range m.factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
 func (m *mockStorageExt) Factory(name string) (storage.Factory, bool) {
+	if m.ready != nil && !m.ready() {
+		return nil, false
+	}
 	if m.name == name {
 		return m.factory, true
 	}
-	return nil, false
+	f, ok := m.factories[name]
+	return f, ok
 }
 
 func TestStorageCleanerExtension(t *testing.T) {
@@ -84,7 +225,7 @@ func TestStorageCleanerExtension(t *testing.T) {
 				TraceStorage: "storage",
 				Port:         Port,
 			}
-			s := newStorageCleaner(config, component.TelemetrySettings{})
+			s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
 			require.NotEmpty(t, s.Dependencies())
 			host := storagetest.NewStorageHost()
 			host.WithExtension(jaegerstorage.ID, &mockStorageExt{
@@ -109,8 +250,9 @@ func TestStorageCleanerExtension(t *testing.T) {
 }
 
 func TestGetStorageFactoryError(t *testing.T) {
-	config := &Config{}
-	s := newStorageCleaner(config, component.TelemetrySettings{})
+	// an empty trace_storage would select the only storage of the extension
+	config := &Config{TraceStorage: "missing"}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
 	host := storagetest.NewStorageHost()
 	host.WithExtension(jaegerstorage.ID, &mockStorageExt{
 		name:    "storage",
@@ -118,7 +260,7 @@ func TestGetStorageFactoryError(t *testing.T) {
 	})
 	err := s.Start(context.Background(), host)
 	require.Error(t, err)
-	require.Contains(t, err.Error(), "cannot find storage factory")
+	require.Contains(t, err.Error(), "cannot find storage factory 'missing'")
 }
 
 func TestStorageExtensionStartError(t *testing.T) {
@@ -127,11 +269,11 @@ func TestStorageExtensionStartError(t *testing.T) {
 		Port:         "invalid-port",
 	}
 	var startStatus atomic.Pointer[component.StatusEvent]
-	s := newStorageCleaner(config, component.TelemetrySettings{
-		ReportStatus: func(status *component.StatusEvent) {
-			startStatus.Store(status)
-		},
-	})
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.ReportStatus = func(status *component.StatusEvent) {
+		startStatus.Store(status)
+	}
+	s := newStorageCleaner(config, settings)
 	host := storagetest.NewStorageHost().WithExtension(
 		jaegerstorage.ID,
 		&mockStorageExt{
@@ -144,3 +286,2602 @@ func TestStorageExtensionStartError(t *testing.T) {
 	}, 5*time.Second, 100*time.Millisecond)
 	require.Contains(t, startStatus.Load().Err().Error(), "error starting cleaner server")
 }
+
+func startStorageCleaner(t *testing.T, factory storage.Factory) *storageCleaner {
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+	}
+	return startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+}
+
+func startStorageCleanerWithConfig(
+	t *testing.T,
+	config *Config,
+	settings component.TelemetrySettings,
+	factory storage.Factory,
+) *storageCleaner {
+	s := newStorageCleaner(config, settings)
+	host := storagetest.NewStorageHost().WithExtension(
+		jaegerstorage.ID,
+		&mockStorageExt{
+			name:    "storage",
+			factory: factory,
+		})
+	require.NoError(t, s.Start(context.Background(), host))
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown(context.Background()))
+	})
+	return s
+}
+
+func getFreePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func serveRequest(s *storageCleaner, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestStorageCleanerPurgeMemory(t *testing.T) {
+	oldSpan := &model.Span{
+		TraceID:   model.NewTraceID(1, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   &model.Process{ServiceName: "old"},
+		StartTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	newSpan := &model.Span{
+		TraceID:   model.NewTraceID(2, 2),
+		SpanID:    model.NewSpanID(2),
+		Process:   &model.Process{ServiceName: "new"},
+		StartTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name   string
+		target string
+		purged []*model.Span
+		kept   []*model.Span
+	}{
+		{
+			name:   "full purge",
+			target: URL,
+			purged: []*model.Span{oldSpan, newSpan},
+		},
+		{
+			name:   "range purge",
+			target: URL + "?start=2023-12-01T00:00:00Z&end=2024-02-01T00:00:00Z",
+			purged: []*model.Span{oldSpan},
+			kept:   []*model.Span{newSpan},
+		},
+		{
+			name:   "range purge with only end",
+			target: URL + "?end=2024-02-01T00:00:00Z",
+			purged: []*model.Span{oldSpan},
+			kept:   []*model.Span{newSpan},
+		},
+		{
+			name:   "service purge",
+			target: URL + "?service=new",
+			purged: []*model.Span{newSpan},
+			kept:   []*model.Span{oldSpan},
+		},
+		{
+			name:   "absent service purge",
+			target: URL + "?service=unknown",
+			kept:   []*model.Span{oldSpan, newSpan},
+		},
+		{
+			name:   "trace purge",
+			target: URL + "?traceID=" + newSpan.TraceID.String(),
+			purged: []*model.Span{newSpan},
+			kept:   []*model.Span{oldSpan},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+			writer, err := factory.CreateSpanWriter()
+			require.NoError(t, err)
+			require.NoError(t, writer.WriteSpan(context.Background(), oldSpan))
+			require.NoError(t, writer.WriteSpan(context.Background(), newSpan))
+			s := startStorageCleaner(t, factory)
+
+			w := serveRequest(s, http.MethodPost, test.target)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			reader, err := factory.CreateSpanReader()
+			require.NoError(t, err)
+			for _, span := range test.purged {
+				_, err := reader.GetTrace(context.Background(), span.TraceID)
+				require.Error(t, err)
+			}
+			for _, span := range test.kept {
+				_, err := reader.GetTrace(context.Background(), span.TraceID)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStorageCleanerPurgeTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		target  string
+		status  int
+		code    string
+	}{
+		{
+			name:   "nonexistent trace",
+			target: URL + "?traceID=" + model.NewTraceID(3, 3).String(),
+			status: http.StatusNotFound,
+			code:   CodeTraceNotFound,
+		},
+		{
+			name:   "invalid trace id",
+			target: URL + "?traceID=xyz",
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:   "zero trace id",
+			target: URL + "?traceID=0",
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:   "combined with service",
+			target: URL + "?traceID=1&service=foo",
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:    "not supported",
+			factory: &PurgerFactory{},
+			target:  URL + "?traceID=1",
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := test.factory
+			if factory == nil {
+				memoryFactory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+				writer, err := memoryFactory.CreateSpanWriter()
+				require.NoError(t, err)
+				require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+					TraceID: model.NewTraceID(1, 1),
+					SpanID:  model.NewSpanID(1),
+					Process: &model.Process{ServiceName: "foo"},
+				}))
+				factory = memoryFactory
+			}
+			s := startStorageCleaner(t, factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code)
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.code, resp.Code)
+		})
+	}
+}
+
+func TestStorageCleanerPurgeTraceIDs(t *testing.T) {
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	writer, err := factory.CreateSpanWriter()
+	require.NoError(t, err)
+	purged, kept := model.NewTraceID(1, 1), model.NewTraceID(2, 2)
+	for _, traceID := range []model.TraceID{purged, kept} {
+		require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+			TraceID: traceID,
+			SpanID:  model.NewSpanID(1),
+			Process: &model.Process{ServiceName: "foo"},
+		}))
+	}
+	s := startStorageCleaner(t, factory)
+
+	missing := model.NewTraceID(3, 3).String()
+	body := `{"traceIDs":["` + purged.String() + `","xyz","0","` + missing + `"]}`
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, URL, strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result purgeResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []traceOutcome{
+		{TraceID: purged.String(), Status: tracePurged},
+		{TraceID: "xyz", Status: traceInvalid, Error: "must be a non-zero hexadecimal trace ID"},
+		{TraceID: "0", Status: traceInvalid, Error: "must be a non-zero hexadecimal trace ID"},
+		{TraceID: missing, Status: traceNotFound},
+	}, result.Traces)
+
+	reader, err := factory.CreateSpanReader()
+	require.NoError(t, err)
+	_, err = reader.GetTrace(context.Background(), purged)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	_, err = reader.GetTrace(context.Background(), kept)
+	require.NoError(t, err)
+}
+
+func TestStorageCleanerPurgeTraceIDsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		target  string
+		body    string
+		status  int
+		code    string
+	}{
+		{
+			name:   "combined with services",
+			target: URL,
+			body:   `{"traceIDs":["1"],"services":["foo"]}`,
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:   "combined with traceID",
+			target: URL + "?traceID=2",
+			body:   `{"traceIDs":["1"]}`,
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:    "not supported",
+			factory: &PurgerFactory{},
+			target:  URL,
+			body:    `{"traceIDs":["1"]}`,
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := test.factory
+			if factory == nil {
+				factory = memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+			}
+			s := startStorageCleaner(t, factory)
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body)))
+			assert.Equal(t, test.status, w.Code)
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.code, resp.Code)
+		})
+	}
+}
+
+// PatternPurgerFactory records the patterns it purges.
+type PatternPurgerFactory struct {
+	PurgerFactory
+	patterns []string
+	err      error
+}
+
+func (f *PatternPurgerFactory) PurgePattern(_ context.Context, pattern string) error {
+	f.patterns = append(f.patterns, pattern)
+	return f.err
+}
+
+func TestStorageCleanerPurgePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		factory  storage.Factory
+		target   string
+		status   int
+		code     string
+		patterns []string
+	}{
+		{
+			name:     "pattern",
+			factory:  &PatternPurgerFactory{},
+			target:   URL + "?pattern=" + url.QueryEscape("jaeger-span-2024-06-*"),
+			status:   http.StatusOK,
+			patterns: []string{"jaeger-span-2024-06-*"},
+		},
+		{
+			name:    "purge error",
+			factory: &PatternPurgerFactory{err: assert.AnError},
+			target:  URL + "?pattern=jaeger-*",
+			status:  http.StatusInternalServerError,
+			code:    CodePurgeFailed,
+		},
+		{
+			name:    "invalid pattern",
+			factory: &PatternPurgerFactory{},
+			target:  URL + "?pattern=" + url.QueryEscape("jaeger-[*"),
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "combined with service",
+			factory: &PatternPurgerFactory{},
+			target:  URL + "?pattern=jaeger-*&service=foo",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "not supported",
+			factory: &PurgerFactory{},
+			target:  URL + "?pattern=jaeger-*",
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code)
+			if test.code != "" {
+				var resp errorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, test.code, resp.Code)
+			}
+			if f, ok := test.factory.(*PatternPurgerFactory); ok {
+				if test.patterns != nil {
+					assert.Equal(t, test.patterns, f.patterns)
+				}
+				// the default purge is never used for pattern requests
+				assert.Zero(t, f.calls.Load())
+			}
+		})
+	}
+}
+
+// AttributePurgerFactory records the attributes it purges the spans of.
+type AttributePurgerFactory struct {
+	PurgerFactory
+	filters []string
+	err     error
+}
+
+func (f *AttributePurgerFactory) PurgeByAttribute(_ context.Context, key, value string) error {
+	f.filters = append(f.filters, key+"="+value)
+	return f.err
+}
+
+func TestStorageCleanerPurgeByAttribute(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		target  string
+		status  int
+		code    string
+		filters []string
+	}{
+		{
+			name:    "filter",
+			factory: &AttributePurgerFactory{},
+			target:  URL + "?filter=" + url.QueryEscape("test.run=abc123"),
+			status:  http.StatusOK,
+			filters: []string{"test.run=abc123"},
+		},
+		{
+			name:    "value with equal sign",
+			factory: &AttributePurgerFactory{},
+			target:  URL + "?filter=" + url.QueryEscape("query=a=b"),
+			status:  http.StatusOK,
+			filters: []string{"query=a=b"},
+		},
+		{
+			name:    "purge error",
+			factory: &AttributePurgerFactory{err: assert.AnError},
+			target:  URL + "?filter=test.run=abc123",
+			status:  http.StatusInternalServerError,
+			code:    CodePurgeFailed,
+		},
+		{
+			name:    "missing value",
+			factory: &AttributePurgerFactory{},
+			target:  URL + "?filter=test.run",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "missing key",
+			factory: &AttributePurgerFactory{},
+			target:  URL + "?filter=" + url.QueryEscape("=abc123"),
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "combined with service",
+			factory: &AttributePurgerFactory{},
+			target:  URL + "?filter=test.run=abc123&service=foo",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "not supported",
+			factory: &PurgerFactory{},
+			target:  URL + "?filter=test.run=abc123",
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code)
+			if test.code != "" {
+				var resp errorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, test.code, resp.Code)
+			}
+			if f, ok := test.factory.(*AttributePurgerFactory); ok {
+				if test.filters != nil {
+					assert.Equal(t, test.filters, f.filters)
+				}
+				// the default purge is never used for filter requests
+				assert.Zero(t, f.calls.Load())
+			}
+		})
+	}
+}
+
+// BatchPurgerFactory deletes its spans in batches, recording the size of each batch.
+type BatchPurgerFactory struct {
+	PurgerFactory
+	spans   int
+	batches []int
+	err     error
+}
+
+func (f *BatchPurgerFactory) PurgeBatched(_ context.Context, batchSize int) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	for f.spans > 0 {
+		batch := min(batchSize, f.spans)
+		f.batches = append(f.batches, batch)
+		f.spans -= batch
+	}
+	return len(f.batches), nil
+}
+
+func TestStorageCleanerPurgeBatched(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		target  string
+		status  int
+		code    string
+		batches []int
+	}{
+		{
+			name:    "batches",
+			factory: &BatchPurgerFactory{spans: 250},
+			target:  URL + "?batch_size=100",
+			status:  http.StatusOK,
+			batches: []int{100, 100, 50},
+		},
+		{
+			name:    "purge error",
+			factory: &BatchPurgerFactory{err: assert.AnError},
+			target:  URL + "?batch_size=100",
+			status:  http.StatusInternalServerError,
+			code:    CodePurgeFailed,
+		},
+		{
+			name:    "invalid batch size",
+			factory: &BatchPurgerFactory{},
+			target:  URL + "?batch_size=0",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "combined with pattern",
+			factory: &BatchPurgerFactory{},
+			target:  URL + "?batch_size=100&pattern=jaeger-*",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "not supported",
+			factory: &PurgerFactory{},
+			target:  URL + "?batch_size=100",
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code)
+			if test.code != "" {
+				var resp errorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, test.code, resp.Code)
+			}
+			if test.batches != nil {
+				var result purgeResult
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+				assert.Equal(t, len(test.batches), result.Batches)
+			}
+			if f, ok := test.factory.(*BatchPurgerFactory); ok {
+				assert.Equal(t, test.batches, f.batches)
+				// the default purge is never used for batched requests
+				assert.Zero(t, f.calls.Load())
+			}
+		})
+	}
+}
+
+// ExpiredPurgerFactory holds spans by name with their start time, and removes the ones older than its TTL.
+type ExpiredPurgerFactory struct {
+	PurgerFactory
+	ttl   time.Duration
+	spans map[string]time.Time
+	err   error
+}
+
+func (f *ExpiredPurgerFactory) TTL() time.Duration {
+	return f.ttl
+}
+
+func (f *ExpiredPurgerFactory) PurgeExpired(context.Context) error {
+	if f.err != nil {
+		return f.err
+	}
+	for name, start := range f.spans {
+		if time.Since(start) > f.ttl {
+			delete(f.spans, name)
+		}
+	}
+	return nil
+}
+
+func TestStorageCleanerPurgeExpired(t *testing.T) {
+	newFactory := func() *ExpiredPurgerFactory {
+		return &ExpiredPurgerFactory{
+			ttl: time.Hour,
+			spans: map[string]time.Time{
+				"expired": time.Now().Add(-2 * time.Hour),
+				"live":    time.Now().Add(-time.Minute),
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		target  string
+		status  int
+		code    string
+		spans   []string
+	}{
+		{
+			name:    "expired only",
+			factory: newFactory(),
+			target:  URL + "?expired_only=true",
+			status:  http.StatusOK,
+			spans:   []string{"live"},
+		},
+		{
+			name:    "everything",
+			factory: newFactory(),
+			target:  URL + "?expired_only=false",
+			status:  http.StatusOK,
+			spans:   []string{"expired", "live"},
+		},
+		{
+			name:    "purge error",
+			factory: &ExpiredPurgerFactory{err: assert.AnError},
+			target:  URL + "?expired_only=true",
+			status:  http.StatusInternalServerError,
+			code:    CodePurgeFailed,
+		},
+		{
+			name:    "invalid value",
+			factory: newFactory(),
+			target:  URL + "?expired_only=soon",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "combined with service",
+			factory: newFactory(),
+			target:  URL + "?expired_only=true&service=frontend",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "combined with wait",
+			factory: newFactory(),
+			target:  URL + "?expired_only=true&wait=true",
+			status:  http.StatusBadRequest,
+			code:    CodeInvalidRequest,
+		},
+		{
+			name:    "not supported",
+			factory: &PurgerFactory{},
+			target:  URL + "?expired_only=true",
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code)
+			if test.code != "" {
+				var resp errorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, test.code, resp.Code)
+			}
+			if f, ok := test.factory.(*ExpiredPurgerFactory); ok && test.spans != nil {
+				var spans []string
+				for name := range f.spans {
+					spans = append(spans, name)
+				}
+				assert.ElementsMatch(t, test.spans, spans)
+			}
+		})
+	}
+}
+
+func TestStorageCleanerStatusTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		ttls    map[string]string
+	}{
+		{name: "with TTL", factory: &ExpiredPurgerFactory{ttl: 72 * time.Hour}, ttls: map[string]string{"storage": "72h0m0s"}},
+		{name: "without TTL", factory: &PurgerFactory{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodGet, StatusURL)
+			require.Equal(t, http.StatusOK, w.Code)
+			var resp StatusResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.ttls, resp.TTLs)
+		})
+	}
+}
+
+func TestStorageCleanerPurgeRangeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{
+			name:   "range purge not supported",
+			target: URL + "?start=2024-01-01T00:00:00Z",
+			status: http.StatusNotImplemented,
+		},
+		{
+			name:   "service purge not supported",
+			target: URL + "?service=foo",
+			status: http.StatusNotImplemented,
+		},
+		{
+			name:   "service combined with time range",
+			target: URL + "?service=foo&start=2024-01-01T00:00:00Z",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid start",
+			target: URL + "?start=yesterday",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid end",
+			target: URL + "?end=tomorrow",
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, &PurgerFactory{})
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestStorageCleanerPurgeScopes(t *testing.T) {
+	const scopes = "only one of target=dependencies, traceID, traceIDs, service, start or end, " +
+		"tenant or all_tenants, pattern, filter, batch_size, expired_only can be set"
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		expectedErr string
+	}{
+		{
+			name:        "pattern and filter",
+			target:      URL + "?pattern=jaeger-*&filter=run=1",
+			expectedErr: scopes + ", got pattern and filter",
+		},
+		{
+			name:        "traceIDs and tenant",
+			target:      URL + "?tenant=a",
+			body:        `{"traceIDs":["1"]}`,
+			expectedErr: scopes + ", got traceIDs and tenant or all_tenants",
+		},
+		{
+			name:        "time range and dependencies",
+			target:      URL + "?target=dependencies&end=2024-01-01T00:00:00Z",
+			expectedErr: scopes + ", got target=dependencies and start or end",
+		},
+		{
+			name:        "batch_size and expired_only",
+			target:      URL + "?batch_size=10&expired_only=true",
+			expectedErr: scopes + ", got batch_size and expired_only",
+		},
+		{
+			name:        "wait with a scope",
+			target:      URL + "?wait=true&pattern=jaeger-*",
+			expectedErr: "wait cannot be combined with pattern",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, &PurgerFactory{})
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.expectedErr, resp.Error)
+		})
+	}
+}
+
+func TestStorageCleanerPurgeBody(t *testing.T) {
+	oldSpan := &model.Span{
+		TraceID:   model.NewTraceID(1, 1),
+		SpanID:    model.NewSpanID(1),
+		Process:   &model.Process{ServiceName: "frontend"},
+		StartTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	frontendSpan := &model.Span{
+		TraceID:   model.NewTraceID(2, 2),
+		SpanID:    model.NewSpanID(2),
+		Process:   &model.Process{ServiceName: "frontend"},
+		StartTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	backendSpan := &model.Span{
+		TraceID:   model.NewTraceID(3, 3),
+		SpanID:    model.NewSpanID(3),
+		Process:   &model.Process{ServiceName: "backend"},
+		StartTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	dbSpan := &model.Span{
+		TraceID:   model.NewTraceID(4, 4),
+		SpanID:    model.NewSpanID(4),
+		Process:   &model.Process{ServiceName: "db"},
+		StartTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	all := []*model.Span{oldSpan, frontendSpan, backendSpan, dbSpan}
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		purged      []*model.Span
+		otherPurged bool
+	}{
+		{
+			name:        "services and range across storages",
+			target:      URL,
+			body:        `{"services":["frontend","backend"],"start":"2024-05-01T00:00:00Z"}`,
+			purged:      []*model.Span{frontendSpan, backendSpan},
+			otherPurged: true,
+		},
+		{
+			name:   "services in selected storage",
+			target: URL,
+			body:   `{"storages":["storage"],"services":["frontend"]}`,
+			purged: []*model.Span{oldSpan, frontendSpan},
+		},
+		{
+			name:   "range in selected storage",
+			target: URL,
+			body:   `{"storages":["storage"],"end":"2024-02-01T00:00:00Z"}`,
+			purged: []*model.Span{oldSpan},
+		},
+		{
+			name:        "empty body purges everything",
+			target:      URL,
+			body:        `{}`,
+			purged:      all,
+			otherPurged: true,
+		},
+		{
+			name:   "body overrides query parameters",
+			target: URL + "?service=db&end=2024-02-01T00:00:00Z",
+			body:   `{"storages":["storage"],"services":["backend"]}`,
+			purged: []*model.Span{backendSpan},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factories := map[string]*memory.Factory{}
+			for _, name := range []string{"storage", "other"} {
+				factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+				writer, err := factory.CreateSpanWriter()
+				require.NoError(t, err)
+				for _, span := range all {
+					require.NoError(t, writer.WriteSpan(context.Background(), span))
+				}
+				factories[name] = factory
+			}
+			config := &Config{
+				TraceStorage:  "storage",
+				TraceStorages: []string{"other"},
+				Port:          Port,
+			}
+			s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+			host := storagetest.NewStorageHost().WithExtension(
+				jaegerstorage.ID,
+				&mockStorageExt{
+					name:      "storage",
+					factory:   factories["storage"],
+					factories: map[string]storage.Factory{"other": factories["other"]},
+				})
+			require.NoError(t, s.Start(context.Background(), host))
+			defer s.Shutdown(context.Background())
+
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body)))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			for name, factory := range factories {
+				reader, err := factory.CreateSpanReader()
+				require.NoError(t, err)
+				for _, span := range all {
+					purged := slices.Contains(test.purged, span) && (name == "storage" || test.otherPurged)
+					_, err := reader.GetTrace(context.Background(), span.TraceID)
+					if purged {
+						require.Error(t, err, "span of %s should be purged from %s", span.Process.ServiceName, name)
+					} else {
+						require.NoError(t, err, "span of %s should be kept in %s", span.Process.ServiceName, name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStorageCleanerPurgeBodyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		contains string
+	}{
+		{
+			name:     "malformed json",
+			body:     `{"services":`,
+			status:   http.StatusBadRequest,
+			contains: "malformed request body",
+		},
+		{
+			name:     "unknown field",
+			body:     `{"service":"foo"}`,
+			status:   http.StatusBadRequest,
+			contains: "malformed request body",
+		},
+		{
+			name:     "invalid time",
+			body:     `{"start":"yesterday"}`,
+			status:   http.StatusBadRequest,
+			contains: "malformed request body",
+		},
+		{
+			name:     "unknown storage",
+			body:     `{"storages":["unknown"]}`,
+			status:   http.StatusBadRequest,
+			contains: `storage "unknown" is not configured for purging`,
+		},
+		{
+			name:     "empty service name",
+			body:     `{"services":[""]}`,
+			status:   http.StatusBadRequest,
+			contains: "services must not contain empty names",
+		},
+		{
+			name:     "service range purge not supported",
+			body:     `{"services":["foo"],"end":"2024-01-01T00:00:00Z"}`,
+			status:   http.StatusNotImplemented,
+			contains: "does not support purging a service time range",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, &PurgerFactory{})
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, URL, strings.NewReader(test.body)))
+			assert.Equal(t, test.status, w.Code)
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Contains(t, resp.Error, test.contains)
+		})
+	}
+}
+
+func TestStorageCleanerErrorResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory storage.Factory
+		config  func(*Config)
+		method  string
+		target  string
+		status  int
+		code    string
+	}{
+		{
+			name:   "unauthorized",
+			config: func(c *Config) { c.AuthToken = "secret" },
+			target: URL,
+			status: http.StatusUnauthorized,
+			code:   CodeUnauthorized,
+		},
+		{
+			name:   "invalid request",
+			target: URL + "?start=yesterday",
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:   "invalid callback url",
+			target: URL + "?callback_url=localhost",
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+		},
+		{
+			name:   "confirmation required",
+			config: func(c *Config) { c.RequireConfirmation = true },
+			target: URL,
+			status: http.StatusBadRequest,
+			code:   CodeConfirmationRequired,
+		},
+		{
+			name:    "not implemented",
+			factory: &PurgerFactory{},
+			target:  URL + "?tenant=foo",
+			status:  http.StatusNotImplemented,
+			code:    CodeNotImplemented,
+		},
+		{
+			name:    "purger missing",
+			factory: &factoryMocks.Factory{},
+			target:  URL,
+			status:  http.StatusInternalServerError,
+			code:    CodePurgerMissing,
+		},
+		{
+			name:    "purger missing in dry run",
+			factory: &factoryMocks.Factory{},
+			target:  URL + "?dry_run=true",
+			status:  http.StatusInternalServerError,
+			code:    CodePurgerMissing,
+		},
+		{
+			name:    "purge failed",
+			factory: &PurgerFactory{err: fmt.Errorf("purge error")},
+			target:  URL,
+			status:  http.StatusInternalServerError,
+			code:    CodePurgeFailed,
+		},
+		{
+			name:   "unknown path",
+			target: "/unknown",
+			status: http.StatusNotFound,
+			code:   CodeNotFound,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPut,
+			target: URL,
+			status: http.StatusMethodNotAllowed,
+			code:   CodeMethodNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage: "storage",
+				Port:         Port,
+			}
+			if test.config != nil {
+				test.config(config)
+			}
+			factory := test.factory
+			if factory == nil {
+				factory = &PurgerFactory{}
+			}
+			s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+			method := test.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			w := serveRequest(s, method, test.target)
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.code, resp.Code)
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
+
+func TestStorageCleanerAllowHeader(t *testing.T) {
+	s := startStorageCleaner(t, &PurgerFactory{})
+	tests := []struct {
+		method string
+		target string
+		allow  string
+	}{
+		{method: http.MethodPut, target: URL, allow: "POST, DELETE"},
+		{method: http.MethodGet, target: URL, allow: "POST, DELETE"},
+		{method: http.MethodPost, target: StatusURL, allow: "GET"},
+		{method: http.MethodPost, target: StreamURL, allow: "GET"},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			w := serveRequest(s, test.method, test.target)
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+			assert.Equal(t, test.allow, w.Header().Get("Allow"))
+		})
+	}
+}
+
+func TestStorageCleanerPurgeBodyTooLarge(t *testing.T) {
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+		MaxBodyBytes: 64,
+	}
+	factory := &PurgerFactory{}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	body := `{"services":["` + strings.Repeat("a", 100) + `"]}`
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, URL, strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"error":"request body must not exceed 64 bytes","code":"body_too_large"}`, w.Body.String())
+	assert.Zero(t, factory.calls.Load())
+
+	// bodies within the limit are accepted
+	w = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, URL, strings.NewReader(`{"storages":["storage"]}`)))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestStorageCleanerPurgeMethods(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+	}{
+		{method: http.MethodPost, status: http.StatusOK},
+		{method: http.MethodDelete, status: http.StatusOK},
+		{method: http.MethodGet, status: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			s := startStorageCleaner(t, &PurgerFactory{})
+			w := serveRequest(s, test.method, URL)
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestStorageCleanerPathPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		pathPrefix string
+		found      []string
+		notFound   []string
+	}{
+		{
+			name:     "default",
+			found:    []string{URL, StatusURL, MetricsURL},
+			notFound: []string{"/cleaner/trace" + URL},
+		},
+		{
+			name:       "custom prefix",
+			pathPrefix: "/cleaner/trace",
+			found:      []string{"/cleaner/trace" + URL, "/cleaner/trace" + StatusURL, "/cleaner/trace" + MetricsURL},
+			notFound:   []string{URL, StatusURL, MetricsURL},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage: "storage",
+				Port:         Port,
+				PathPrefix:   test.pathPrefix,
+			}
+			s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), &PurgerFactory{})
+			for _, path := range test.found {
+				method := http.MethodGet
+				if strings.HasSuffix(path, URL) {
+					method = http.MethodPost
+				}
+				assert.Equal(t, http.StatusOK, serveRequest(s, method, path).Code, path)
+			}
+			for _, path := range test.notFound {
+				assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodPost, path).Code, path)
+			}
+		})
+	}
+}
+
+func TestStorageCleanerLoopbackEndpoint(t *testing.T) {
+	var externalIP net.IP
+	addrs, err := net.InterfaceAddrs()
+	require.NoError(t, err)
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			externalIP = ipNet.IP
+			break
+		}
+	}
+	if externalIP == nil {
+		t.Skip("no non-loopback IPv4 address available")
+	}
+
+	port := getFreePort(t)
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         port,
+	}
+	require.NoError(t, config.Validate())
+	startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), &PurgerFactory{})
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = net.DialTimeout("tcp", net.JoinHostPort(externalIP.String(), port), time.Second)
+	require.Error(t, err, "server must not be reachable from %s", externalIP)
+}
+
+func TestStorageCleanerPurgeCancelled(t *testing.T) {
+	factory := &ContextPurgerFactory{PurgerFactory: PurgerFactory{started: make(chan struct{})}}
+	s := startStorageCleaner(t, factory)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-factory.started
+		cancel()
+	}()
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, URL, nil).WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("purge handler did not return after the request was cancelled")
+	}
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), context.Canceled.Error())
+}
+
+func TestStorageCleanerShutdownCancelsPurge(t *testing.T) {
+	factory := &ContextPurgerFactory{PurgerFactory: PurgerFactory{started: make(chan struct{})}}
+	s := startStorageCleaner(t, factory)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serveRequest(s, http.MethodPost, URL)
+	}()
+	<-factory.started
+	require.NoError(t, s.Shutdown(context.Background()))
+	select {
+	case w := <-done:
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("purge handler did not return after shutdown")
+	}
+}
+
+func TestStorageCleanerShutdownCancelsStatsPurge(t *testing.T) {
+	factory := &StatsPurgerFactory{PurgerFactory: PurgerFactory{started: make(chan struct{})}}
+	s := startStorageCleaner(t, factory)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serveRequest(s, http.MethodPost, URL)
+	}()
+	<-factory.started
+	require.NoError(t, s.Shutdown(context.Background()))
+	select {
+	case w := <-done:
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), context.Canceled.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("stats purge did not return after shutdown")
+	}
+}
+
+func TestStorageCleanerShutdownWaitsForPurge(t *testing.T) {
+	// the legacy purger cannot be cancelled, so Shutdown has to wait for it
+	factory := &PurgerFactory{delay: 200 * time.Millisecond}
+	s := startStorageCleaner(t, factory)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serveRequest(s, http.MethodPost, URL)
+	}()
+	require.Eventually(t, func() bool {
+		return factory.calls.Load() == 1
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), factory.completed.Load())
+	<-done
+}
+
+func TestStorageCleanerShutdownContextExpires(t *testing.T) {
+	factory := &PurgerFactory{delay: 500 * time.Millisecond}
+	s := startStorageCleaner(t, factory)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serveRequest(s, http.MethodPost, URL)
+	}()
+	require.Eventually(t, func() bool {
+		return factory.calls.Load() == 1
+	}, 5*time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, factory.completed.Load())
+	<-done
+}
+
+func TestStorageCleanerPurgeOnShutdown(t *testing.T) {
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	writer, err := factory.CreateSpanWriter()
+	require.NoError(t, err)
+	traceID := model.NewTraceID(1, 1)
+	require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+		TraceID: traceID,
+		SpanID:  model.NewSpanID(1),
+		Process: &model.Process{ServiceName: "foo"},
+	}))
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), PurgeOnShutdown: true}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	reader, err := factory.CreateSpanReader()
+	require.NoError(t, err)
+	_, err = reader.GetTrace(context.Background(), traceID)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	_, err = reader.GetTrace(context.Background(), traceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+}
+
+func TestStorageCleanerPurgeOnShutdownFailure(t *testing.T) {
+	factory := &PurgerFactory{err: assert.AnError}
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), PurgeOnShutdown: true}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: factory,
+	})
+	require.NoError(t, s.Start(context.Background(), host))
+
+	err := s.Shutdown(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "error purging on shutdown")
+	// the server is stopped regardless
+	_, err = net.Dial("tcp", "localhost:"+config.Port)
+	require.Error(t, err)
+}
+
+func TestStorageCleanerSerializesPurges(t *testing.T) {
+	factory := &PurgerFactory{delay: 20 * time.Millisecond}
+	s := startStorageCleaner(t, factory)
+
+	const requests = 5
+	var wg sync.WaitGroup
+	codes := make([]int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serveRequest(s, http.MethodPost, URL).Code
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, int32(requests), factory.calls.Load())
+	assert.Equal(t, int32(1), factory.maxRunning.Load())
+}
+
+func TestStorageCleanerRejectsConcurrentPurge(t *testing.T) {
+	factory := &PurgerFactory{started: make(chan struct{}), release: make(chan struct{})}
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+		Concurrency:  ConcurrencyReject,
+	}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	first := make(chan int)
+	go func() {
+		first <- serveRequest(s, http.MethodPost, URL).Code
+	}()
+	<-factory.started
+
+	w := serveRequest(s, http.MethodPost, URL)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error":"another purge is in progress","code":"purge_in_progress"}`, w.Body.String())
+
+	close(factory.release)
+	assert.Equal(t, http.StatusOK, <-first)
+
+	// the lock is released once the first purge completes
+	go func() { <-factory.started }()
+	assert.Equal(t, http.StatusOK, serveRequest(s, http.MethodPost, URL).Code)
+}
+
+func TestStorageCleanerQueuedPurgeCancelled(t *testing.T) {
+	factory := &PurgerFactory{started: make(chan struct{}), release: make(chan struct{})}
+	s := startStorageCleaner(t, factory)
+
+	first := make(chan int)
+	go func() {
+		first <- serveRequest(s, http.MethodPost, URL).Code
+	}()
+	<-factory.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, URL, nil).WithContext(ctx))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, CodeAborted, resp.Code)
+	assert.Contains(t, resp.Error, "aborted while waiting for another purge")
+
+	close(factory.release)
+	assert.Equal(t, http.StatusOK, <-first)
+}
+
+func TestStorageCleanerTLS(t *testing.T) {
+	const certs = "../../../../../pkg/config/tlscfg/testdata"
+	serverTLS := tlscfg.Options{
+		Enabled:      true,
+		CertPath:     certs + "/example-server-cert.pem",
+		KeyPath:      certs + "/example-server-key.pem",
+		ClientCAPath: certs + "/example-CA-cert.pem",
+	}
+	tests := []struct {
+		name        string
+		clientTLS   tlscfg.Options
+		expectedErr bool
+	}{
+		{
+			name: "valid client certificate",
+			clientTLS: tlscfg.Options{
+				Enabled:    true,
+				CAPath:     certs + "/example-CA-cert.pem",
+				ServerName: "example.com",
+				CertPath:   certs + "/example-client-cert.pem",
+				KeyPath:    certs + "/example-client-key.pem",
+			},
+		},
+		{
+			name: "no client certificate",
+			clientTLS: tlscfg.Options{
+				Enabled:    true,
+				CAPath:     certs + "/example-CA-cert.pem",
+				ServerName: "example.com",
+			},
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage: "storage",
+				Endpoint:     "localhost:" + getFreePort(t),
+				TLS:          serverTLS,
+			}
+			startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), &PurgerFactory{})
+
+			clientTLS := test.clientTLS
+			tlsCfg, err := clientTLS.Config(zap.NewNop())
+			require.NoError(t, err)
+			defer clientTLS.Close()
+			transport := &http.Transport{TLSClientConfig: tlsCfg}
+			defer transport.CloseIdleConnections()
+			client := &http.Client{Transport: transport}
+
+			require.Eventually(t, func() bool {
+				conn, err := net.Dial("tcp", config.Endpoint)
+				if err != nil {
+					return false
+				}
+				conn.Close()
+				return true
+			}, 5*time.Second, 10*time.Millisecond)
+
+			resp, err := client.Post("https://"+config.Endpoint+URL, "", nil)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestStorageCleanerHandlerTimeout(t *testing.T) {
+	config := &Config{
+		TraceStorage:   "storage",
+		Port:           Port,
+		HandlerTimeout: 50 * time.Millisecond,
+	}
+	factory := &PurgerFactory{delay: 500 * time.Millisecond}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	w := serveRequest(s, http.MethodPost, URL)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"request timed out","code":"timeout"}`, w.Body.String())
+}
+
+func TestStorageCleanerGzip(t *testing.T) {
+	s := startStorageCleaner(t, &StatsPurgerFactory{deleted: 1234})
+
+	r := httptest.NewRequest(http.MethodPost, URL, nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"deleted_spans":1234}`, string(body))
+
+	// responses are not compressed by default
+	w = serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"deleted_spans":1234}`, w.Body.String())
+}
+
+func TestStorageCleanerRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		retry         RetryConfig
+		err           error
+		status        int
+		expectedCalls int32
+	}{
+		{
+			name:          "transient errors are retried",
+			retry:         RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			err:           temporaryError{},
+			status:        http.StatusOK,
+			expectedCalls: 3,
+		},
+		{
+			name:          "permanent errors fail immediately",
+			retry:         RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			err:           fmt.Errorf("permanent"),
+			status:        http.StatusInternalServerError,
+			expectedCalls: 1,
+		},
+		{
+			name:          "retries disabled",
+			err:           temporaryError{},
+			status:        http.StatusInternalServerError,
+			expectedCalls: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage: "storage",
+				Port:         Port,
+				Retry:        test.retry,
+			}
+			factory := &PurgerFactory{err: test.err, failures: 2}
+			s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+			w := serveRequest(s, http.MethodPost, URL)
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.expectedCalls, factory.calls.Load())
+		})
+	}
+}
+
+func TestStorageCleanerIdempotencyKey(t *testing.T) {
+	factory := &StatsPurgerFactory{deleted: 7}
+	s := startStorageCleaner(t, factory)
+
+	purge := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, URL, nil)
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := purge("run-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted_spans":7}`, w.Body.String())
+	assert.Equal(t, int32(1), factory.calls.Load())
+
+	factory.deleted = 0
+	w = purge("run-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted_spans":7}`, w.Body.String(), "duplicate key must return the prior result")
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(1), factory.calls.Load())
+
+	w = purge("run-2")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted_spans":0}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), factory.calls.Load())
+
+	purge("")
+	purge("")
+	assert.Equal(t, int32(4), factory.calls.Load(), "requests without a key always purge")
+}
+
+func TestStorageCleanerIdempotencyKeyParameters(t *testing.T) {
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	s := startStorageCleaner(t, factory)
+
+	purge := func(target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set(IdempotencyKeyHeader, "run-1")
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := purge(URL+"?service=foo", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	// the same parameters given in the body
+	w = purge(URL, `{"services":["foo"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+	for _, target := range []string{URL, URL + "?service=bar", URL + "?tenant=a"} {
+		w = purge(target, "")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, target)
+		assert.Contains(t, w.Body.String(), `"code":"idempotency_key_reused"`)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestStorageCleanerIdempotencyKeyFailedPurge(t *testing.T) {
+	factory := &PurgerFactory{err: fmt.Errorf("error"), failures: 1}
+	s := startStorageCleaner(t, factory)
+
+	for _, status := range []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, URL, nil)
+		r.Header.Set(IdempotencyKeyHeader, "run-1")
+		s.server.Handler.ServeHTTP(w, r)
+		assert.Equal(t, status, w.Code)
+	}
+	assert.Equal(t, int32(2), factory.calls.Load(), "failed purges must not be remembered")
+}
+
+func TestStorageCleanerPurgeLogs(t *testing.T) {
+	zapCore, logs := observer.New(zap.InfoLevel)
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.Logger = zap.New(zapCore)
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+	}
+	s := startStorageCleanerWithConfig(t, config, settings, &PurgerFactory{})
+
+	r := httptest.NewRequest(http.MethodPost, URL+"?service=foo", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), r)
+	r = httptest.NewRequest(http.MethodPost, URL, nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+
+	failed := entries[0]
+	assert.Equal(t, zap.ErrorLevel, failed.Level)
+	fields := failed.ContextMap()
+	assert.Equal(t, "10.0.0.1:1234", fields["remote_addr"])
+	assert.Equal(t, []interface{}{"storage"}, fields["storages"])
+	assert.Equal(t, []interface{}{"foo"}, fields["services"])
+	assert.Equal(t, "failure", fields["outcome"])
+	assert.Contains(t, fields["error"], "does not support purging a service")
+	assert.Contains(t, fields, "duration")
+
+	succeeded := entries[1]
+	assert.Equal(t, zap.InfoLevel, succeeded.Level)
+	fields = succeeded.ContextMap()
+	assert.Equal(t, "10.0.0.2:1234", fields["remote_addr"])
+	assert.Equal(t, "success", fields["outcome"])
+	assert.NotContains(t, fields, "services")
+	assert.NotContains(t, fields, "error")
+}
+
+func TestStorageCleanerDryRun(t *testing.T) {
+	t.Run("purger storage", func(t *testing.T) {
+		factory := &PurgerFactory{}
+		s := startStorageCleaner(t, factory)
+		w := serveRequest(s, http.MethodPost, URL+"?dry_run=true")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"dry_run":true,"would_purge":"storage","would_purge_spans":0}`, w.Body.String())
+		assert.Zero(t, factory.calls.Load())
+
+		w = serveRequest(s, http.MethodPost, URL+"?dry_run=false")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(1), factory.calls.Load())
+	})
+	t.Run("non-purger storage", func(t *testing.T) {
+		s := startStorageCleaner(t, &factoryMocks.Factory{})
+		w := serveRequest(s, http.MethodPost, URL+"?dry_run=true")
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "does not implement Purger interface")
+	})
+}
+
+func TestStorageCleanerPurgeStats(t *testing.T) {
+	t.Run("storage with stats", func(t *testing.T) {
+		s := startStorageCleaner(t, &StatsPurgerFactory{deleted: 1234})
+		w := serveRequest(s, http.MethodPost, URL)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"deleted_spans":1234}`, w.Body.String())
+	})
+	t.Run("storage with stats error", func(t *testing.T) {
+		s := startStorageCleaner(t, &StatsPurgerFactory{PurgerFactory: PurgerFactory{err: fmt.Errorf("error")}})
+		w := serveRequest(s, http.MethodPost, URL)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+	t.Run("storage without stats", func(t *testing.T) {
+		s := startStorageCleaner(t, &PurgerFactory{})
+		w := serveRequest(s, http.MethodPost, URL)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"message":"Purge request processed successfully"}`, w.Body.String())
+	})
+}
+
+func TestStorageCleanerMultipleStorages(t *testing.T) {
+	tests := []struct {
+		name     string
+		other    storage.Factory
+		status   int
+		contains string
+	}{
+		{
+			name:   "all storages purged",
+			other:  &PurgerFactory{},
+			status: http.StatusOK,
+		},
+		{
+			name:     "partial failure",
+			other:    &PurgerFactory{err: fmt.Errorf("other failed")},
+			status:   http.StatusInternalServerError,
+			contains: "error purging storage other: other failed",
+		},
+		{
+			name:     "other storage is not a purger",
+			other:    &factoryMocks.Factory{},
+			status:   http.StatusInternalServerError,
+			contains: "storage other does not implement Purger interface",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage:  "storage",
+				TraceStorages: []string{"other"},
+				Port:          Port,
+			}
+			s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+			mainFactory := &StatsPurgerFactory{deleted: 3}
+			host := storagetest.NewStorageHost().WithExtension(
+				jaegerstorage.ID,
+				&mockStorageExt{
+					name:      "storage",
+					factory:   mainFactory,
+					factories: map[string]storage.Factory{"other": test.other},
+				})
+			require.NoError(t, s.Start(context.Background(), host))
+			defer s.Shutdown(context.Background())
+
+			w := serveRequest(s, http.MethodPost, URL)
+			assert.Equal(t, test.status, w.Code)
+			assert.Contains(t, w.Body.String(), test.contains)
+
+			w = serveRequest(s, http.MethodGet, StatusURL)
+			require.Equal(t, http.StatusOK, w.Code)
+			var resp StatusResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "storage,other", resp.Storage)
+		})
+	}
+}
+
+func TestStorageCleanerMissingSecondStorage(t *testing.T) {
+	config := &Config{
+		TraceStorage:  "storage",
+		TraceStorages: []string{"missing"},
+	}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(
+		jaegerstorage.ID,
+		&mockStorageExt{
+			name:    "storage",
+			factory: &PurgerFactory{},
+		})
+	err := s.Start(context.Background(), host)
+	require.ErrorContains(t, err, "cannot find storage factory 'missing'")
+}
+
+func TestStorageCleanerMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+	}
+	factory := &PurgerFactory{}
+	s := startStorageCleanerWithConfig(t, config, settings, factory)
+
+	require.Equal(t, http.StatusOK, serveRequest(s, http.MethodPost, URL).Code)
+	factory.err = fmt.Errorf("error")
+	require.Equal(t, http.StatusInternalServerError, serveRequest(s, http.MethodPost, URL).Code)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	recorded := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		recorded[m.Name] = m.Data
+	}
+	purges := recorded["jaeger_storagecleaner_purge_total"].(metricdata.Sum[int64])
+	assert.Equal(t, int64(2), purges.DataPoints[0].Value)
+	purgeErrors := recorded["jaeger_storagecleaner_purge_errors_total"].(metricdata.Sum[int64])
+	assert.Equal(t, int64(1), purgeErrors.DataPoints[0].Value)
+	duration := recorded["jaeger_storagecleaner_purge_duration_seconds"].(metricdata.Histogram[float64])
+	assert.Equal(t, uint64(2), duration.DataPoints[0].Count)
+}
+
+func TestStorageCleanerMetricsEndpoint(t *testing.T) {
+	factory := &PurgerFactory{}
+	s := startStorageCleaner(t, factory)
+
+	require.Equal(t, http.StatusOK, serveRequest(s, http.MethodPost, URL).Code)
+	factory.err = fmt.Errorf("error")
+	require.Equal(t, http.StatusInternalServerError, serveRequest(s, http.MethodPost, URL).Code)
+
+	w := serveRequest(s, http.MethodGet, MetricsURL)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE jaeger_storagecleaner_purge_total counter")
+	assert.Contains(t, body, "jaeger_storagecleaner_purge_total 2\n")
+	assert.Contains(t, body, "jaeger_storagecleaner_purge_errors_total 1\n")
+	assert.Contains(t, body, "jaeger_storagecleaner_purge_duration_seconds_count 2\n")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serveRequest(s, http.MethodPost, MetricsURL).Code)
+}
+
+func TestStorageCleanerAuthToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{
+			name:   "missing header",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong scheme",
+			authorization: "Basic secret",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong token",
+			authorization: "Bearer wrong",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "correct token",
+			authorization: "Bearer secret",
+			status:        http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, &PurgerFactory{})
+			s.config.AuthToken = "secret"
+			r := httptest.NewRequest(http.MethodPost, URL, nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, r)
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestStorageCleanerRequireConfirmation(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+		calls  int32
+	}{
+		{
+			name:   "matching confirmation",
+			target: URL + "?confirm=storage",
+			status: http.StatusOK,
+			calls:  1,
+		},
+		{
+			name:   "mismatching confirmation",
+			target: URL + "?confirm=production",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing confirmation",
+			target: URL,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "dry run without confirmation",
+			target: URL + "?dry_run=true",
+			status: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := &PurgerFactory{}
+			s := startStorageCleaner(t, factory)
+			s.config.RequireConfirmation = true
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code, w.Body.String())
+			assert.Equal(t, test.calls, factory.calls.Load())
+			if test.status == http.StatusBadRequest {
+				assert.Contains(t, w.Body.String(), "confirm=storage")
+			}
+		})
+	}
+}
+
+func TestStorageCleanerMinInterval(t *testing.T) {
+	factory := &PurgerFactory{}
+	s := startStorageCleaner(t, factory)
+	s.config.MinInterval = 200 * time.Millisecond
+
+	w := serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = serveRequest(s, http.MethodPost, URL)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"throttled"`)
+	// resets share the cooldown of purges
+	w = serveRequest(s, http.MethodPost, ResetURL)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	// dry runs do not purge, so they are not throttled
+	w = serveRequest(s, http.MethodPost, URL+"?dry_run=true")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), factory.calls.Load())
+
+	require.Eventually(t, func() bool {
+		return serveRequest(s, http.MethodPost, URL).Code == http.StatusOK
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, int32(2), factory.calls.Load())
+}
+
+func TestStorageCleanerPurgeDependencies(t *testing.T) {
+	tests := []struct {
+		name            string
+		factory         storage.Factory
+		target          string
+		status          int
+		dependencyCalls int32
+	}{
+		{
+			name:            "dependencies target",
+			factory:         &DependencyPurgerFactory{},
+			target:          URL + "?target=dependencies",
+			status:          http.StatusOK,
+			dependencyCalls: 1,
+		},
+		{
+			name:    "traces target",
+			factory: &DependencyPurgerFactory{},
+			target:  URL + "?target=traces",
+			status:  http.StatusOK,
+		},
+		{
+			name:    "dependencies not supported",
+			factory: &PurgerFactory{},
+			target:  URL + "?target=dependencies",
+			status:  http.StatusNotImplemented,
+		},
+		{
+			name:            "dependencies purge error",
+			factory:         &DependencyPurgerFactory{PurgerFactory: PurgerFactory{err: errors.New("boom")}},
+			target:          URL + "?target=dependencies",
+			status:          http.StatusInternalServerError,
+			dependencyCalls: 1,
+		},
+		{
+			name:    "dependencies with service",
+			factory: &DependencyPurgerFactory{},
+			target:  URL + "?target=dependencies&service=frontend",
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "invalid target",
+			factory: &DependencyPurgerFactory{},
+			target:  URL + "?target=metrics",
+			status:  http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			assert.Equal(t, test.status, w.Code, w.Body.String())
+			if f, ok := test.factory.(*DependencyPurgerFactory); ok {
+				assert.Equal(t, test.dependencyCalls, f.dependencyCalls.Load())
+				if test.target == URL+"?target=traces" {
+					assert.Equal(t, int32(1), f.calls.Load())
+				} else {
+					assert.Zero(t, f.calls.Load())
+				}
+			}
+		})
+	}
+}
+
+func TestStorageCleanerPurgeTenants(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		factory        *TenantPurgerFactory
+		status         int
+		expectedPurged []string
+		fullPurge      bool
+	}{
+		{
+			name:      "without tenant",
+			target:    URL,
+			factory:   &TenantPurgerFactory{},
+			status:    http.StatusOK,
+			fullPurge: true,
+		},
+		{
+			name:           "single tenant",
+			target:         URL + "?tenant=acme",
+			factory:        &TenantPurgerFactory{},
+			status:         http.StatusOK,
+			expectedPurged: []string{"acme"},
+		},
+		{
+			name:           "all tenants",
+			target:         URL + "?all_tenants=true",
+			factory:        &TenantPurgerFactory{tenants: []string{"acme", "globex"}},
+			status:         http.StatusOK,
+			expectedPurged: []string{"acme", "globex"},
+		},
+		{
+			name:      "all tenants disabled",
+			target:    URL + "?all_tenants=false",
+			factory:   &TenantPurgerFactory{tenants: []string{"acme", "globex"}},
+			status:    http.StatusOK,
+			fullPurge: true,
+		},
+		{
+			name:    "tenant combined with all tenants",
+			target:  URL + "?tenant=acme&all_tenants=true",
+			factory: &TenantPurgerFactory{},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "tenant combined with service",
+			target:  URL + "?tenant=acme&service=frontend",
+			factory: &TenantPurgerFactory{},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "tenant combined with dependencies",
+			target:  URL + "?all_tenants=true&target=dependencies",
+			factory: &TenantPurgerFactory{},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "invalid all tenants",
+			target:  URL + "?all_tenants=maybe",
+			factory: &TenantPurgerFactory{},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "listing tenants fails",
+			target:  URL + "?all_tenants=true",
+			factory: &TenantPurgerFactory{listErr: errors.New("unavailable")},
+			status:  http.StatusInternalServerError,
+		},
+		{
+			name:           "purging a tenant fails",
+			target:         URL + "?all_tenants=true",
+			factory:        &TenantPurgerFactory{tenants: []string{"acme", "globex"}, tenantErr: errors.New("unavailable")},
+			status:         http.StatusInternalServerError,
+			expectedPurged: []string{"acme"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, test.target)
+			require.Equal(t, test.status, w.Code, w.Body.String())
+			assert.Equal(t, test.expectedPurged, test.factory.purged)
+			if test.fullPurge {
+				assert.Equal(t, int32(1), test.factory.calls.Load())
+			} else {
+				assert.Zero(t, test.factory.calls.Load())
+			}
+		})
+	}
+}
+
+func TestStorageCleanerPurgeTenantNotSupported(t *testing.T) {
+	s := startStorageCleaner(t, &PurgerFactory{})
+	w := serveRequest(s, http.MethodPost, URL+"?tenant=acme")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Contains(t, w.Body.String(), "storage storage does not support purging tenants")
+}
+
+func TestStorageCleanerDependencyStorage(t *testing.T) {
+	config := &Config{
+		TraceStorage:      "storage",
+		DependencyStorage: "dependencies",
+		Port:              getFreePort(t),
+	}
+	traces := &DependencyPurgerFactory{}
+	dependencies := &DependencyPurgerFactory{}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(
+		jaegerstorage.ID,
+		&mockStorageExt{
+			name:      "storage",
+			factory:   traces,
+			factories: map[string]storage.Factory{"dependencies": dependencies},
+		})
+	require.NoError(t, s.Start(context.Background(), host))
+	defer s.Shutdown(context.Background())
+
+	w := serveRequest(s, http.MethodPost, URL+"?target=dependencies")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int32(1), dependencies.dependencyCalls.Load())
+	assert.Zero(t, traces.dependencyCalls.Load())
+	assert.Zero(t, traces.calls.Load())
+
+	s.config.DependencyStorage = "unknown"
+	err := newStorageCleaner(s.config, componenttest.NewNopTelemetrySettings()).Start(context.Background(), host)
+	require.ErrorContains(t, err, "cannot find dependency storage factory 'unknown'")
+}
+
+func TestStorageCleanerStatusStorageNotFound(t *testing.T) {
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         getFreePort(t),
+	}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	storageExt := &mockStorageExt{
+		name:      "storage",
+		factory:   &PurgerFactory{},
+		factories: map[string]storage.Factory{"archive": &PurgerFactory{}},
+	}
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, storageExt)
+	require.NoError(t, s.Start(context.Background(), host))
+	defer s.Shutdown(context.Background())
+
+	// simulate a typo in the configured storage name
+	s.config.TraceStorage = "storgae"
+	w := serveRequest(s, http.MethodGet, StatusURL)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	var resp StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"archive", "storage"}, resp.AvailableStorages)
+	assert.Contains(t, resp.Error, "(available storages: archive, storage)")
+	assert.Equal(t, CodeStorageNotFound, resp.Code)
+
+	// the storage_cleaner cannot start with a misspelled storage name either
+	err := newStorageCleaner(s.config, componenttest.NewNopTelemetrySettings()).Start(context.Background(), host)
+	require.ErrorContains(t, err, "(available storages: archive, storage)")
+}
+
+func TestStorageCleanerWaitsForStorage(t *testing.T) {
+	tests := []struct {
+		name        string
+		readyAfter  time.Duration
+		waitTimeout time.Duration
+		expectedErr string
+	}{
+		{
+			name:        "storage ready during wait",
+			readyAfter:  200 * time.Millisecond,
+			waitTimeout: 5 * time.Second,
+		},
+		{
+			name:        "storage not ready in time",
+			readyAfter:  time.Hour,
+			waitTimeout: 100 * time.Millisecond,
+			expectedErr: "cannot find storage factory 'storage'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				TraceStorage:       "storage",
+				Port:               getFreePort(t),
+				StorageWaitTimeout: test.waitTimeout,
+			}
+			s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+			factory := &PurgerFactory{}
+			readyAt := time.Now().Add(test.readyAfter)
+			host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+				name:    "storage",
+				factory: factory,
+				ready: func() bool {
+					return !time.Now().Before(readyAt)
+				},
+			})
+			err := s.Start(context.Background(), host)
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			defer s.Shutdown(context.Background())
+			assert.Equal(t, http.StatusOK, serveRequest(s, http.MethodPost, URL).Code)
+			assert.Equal(t, int32(1), factory.calls.Load())
+		})
+	}
+}
+
+func TestStorageCleanerWaitForStorageCancelled(t *testing.T) {
+	config := &Config{
+		TraceStorage:       "storage",
+		Port:               getFreePort(t),
+		StorageWaitTimeout: time.Hour,
+	}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: &PurgerFactory{},
+		ready:   func() bool { return false },
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := s.Start(ctx, host)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStorageCleanerWaitForHungStorage(t *testing.T) {
+	config := &Config{
+		TraceStorage:       "storage",
+		Port:               getFreePort(t),
+		StorageWaitTimeout: 100 * time.Millisecond,
+	}
+	var events []*component.StatusEvent
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.ReportStatus = func(event *component.StatusEvent) {
+		events = append(events, event)
+	}
+	s := newStorageCleaner(config, settings)
+	hang := make(chan struct{})
+	defer close(hang)
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: &PurgerFactory{},
+		ready: func() bool {
+			<-hang
+			return true
+		},
+	})
+
+	start := time.Now()
+	err := s.Start(context.Background(), host)
+	require.ErrorIs(t, err, errStorageWaitTimeout)
+	require.ErrorContains(t, err, "cannot find storage factory 'storage': storage extension did not return the factory within storage_wait_timeout (100ms)")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, events, 1)
+	assert.Equal(t, component.StatusPermanentError, events[0].Status())
+	require.ErrorIs(t, events[0].Err(), errStorageWaitTimeout)
+}
+
+func TestStorageCleanerStatusMissingStorageExtension(t *testing.T) {
+	s := startStorageCleaner(t, &PurgerFactory{})
+	s.host = storagetest.NewStorageHost()
+	w := serveRequest(s, http.MethodGet, StatusURL)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var resp StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.AvailableStorages)
+	assert.Contains(t, resp.Error, "cannot find extension")
+	assert.Equal(t, CodeStorageUnavailable, resp.Code)
+}
+
+func TestStorageCleanerStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		factory      storage.Factory
+		purger       bool
+		capabilities []Capability
+	}{
+		{
+			name:         "purger storage",
+			factory:      &PurgerFactory{},
+			purger:       true,
+			capabilities: []Capability{CapabilityPurge},
+		},
+		{
+			name:    "non-purger storage",
+			factory: &factoryMocks.Factory{},
+			purger:  false,
+		},
+		{
+			name:    "memory storage",
+			factory: memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop()),
+			purger:  true,
+			capabilities: []Capability{
+				CapabilityPurge, CapabilityRangePurge, CapabilityServicePurge, CapabilityServiceRangePurge, CapabilityTracePurge,
+				CapabilityAttributePurge, CapabilityTenantPurge, CapabilityCount,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodGet, StatusURL)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var resp StatusResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, StatusResponse{Storage: "storage", Purger: test.purger, Capabilities: test.capabilities}, resp)
+		})
+	}
+}
+
+func TestStorageCleanerConfigEndpoint(t *testing.T) {
+	s := startStorageCleaner(t, &PurgerFactory{})
+	w := serveRequest(s, http.MethodGet, ConfigURL)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var effective map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &effective))
+	assert.Equal(t, "storage", effective["trace_storage"])
+	assert.Equal(t, "", effective["auth_token"])
+
+	s.config.AuthToken = "secret"
+	w = serveRequest(s, http.MethodGet, ConfigURL)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	r := httptest.NewRequest(http.MethodGet, ConfigURL, nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.Contains(t, w.Body.String(), `"auth_token":"[REDACTED]"`)
+}
+
+func TestStorageCleanerStatusLateBinding(t *testing.T) {
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+	}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	storageExt := &mockStorageExt{
+		name:    "storage",
+		factory: &PurgerFactory{},
+	}
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, storageExt)
+	require.NoError(t, s.Start(context.Background(), host))
+	defer s.Shutdown(context.Background())
+
+	storageExt.name = "other"
+	w := serveRequest(s, http.MethodGet, StatusURL)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	var resp StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "storage", resp.Storage)
+	assert.False(t, resp.Purger)
+	assert.Contains(t, resp.Error, "cannot find storage 'storage'")
+
+	storageExt.name = "storage"
+	w = serveRequest(s, http.MethodGet, StatusURL)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestStorageCleanerRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		echoed    bool
+	}{
+		{name: "generated"},
+		{name: "from the request", requestID: "e2e-run-42", echoed: true},
+		{name: "too long", requestID: strings.Repeat("x", maxRequestIDLength+1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zapCore, logs := observer.New(zap.InfoLevel)
+			settings := componenttest.NewNopTelemetrySettings()
+			settings.Logger = zap.New(zapCore)
+			config := &Config{TraceStorage: "storage", Port: getFreePort(t)}
+			s := startStorageCleanerWithConfig(t, config, settings, &PurgerFactory{})
+
+			for _, path := range []string{URL, ResetURL} {
+				r := httptest.NewRequest(http.MethodPost, path, nil)
+				if test.requestID != "" {
+					r.Header.Set(RequestIDHeader, test.requestID)
+				}
+				w := httptest.NewRecorder()
+				s.server.Handler.ServeHTTP(w, r)
+				require.Equal(t, http.StatusOK, w.Code)
+
+				requestID := w.Header().Get(RequestIDHeader)
+				if test.echoed {
+					assert.Equal(t, test.requestID, requestID)
+				} else {
+					assert.Regexp(t, "^[0-9a-f]{32}$", requestID)
+				}
+				entries := logs.TakeAll()
+				require.Len(t, entries, 1)
+				assert.Equal(t, requestID, entries[0].ContextMap()["request_id"])
+			}
+		})
+	}
+}
+
+func TestStorageCleanerRequestIDOnError(t *testing.T) {
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), AuthToken: "secret"}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), &PurgerFactory{})
+	r := httptest.NewRequest(http.MethodPost, URL, nil)
+	r.Header.Set(RequestIDHeader, "e2e-run-42")
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "e2e-run-42", w.Header().Get(RequestIDHeader))
+}
+
+func TestStorageCleanerSingleStorage(t *testing.T) {
+	config := &Config{Port: getFreePort(t)}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	factory := &PurgerFactory{}
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: factory,
+	})
+	require.NoError(t, s.Start(context.Background(), host))
+	defer s.Shutdown(context.Background())
+	assert.Equal(t, []string{"storage"}, config.storageNames())
+
+	w := serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), factory.calls.Load())
+}
+
+func TestStorageCleanerNoStorageConfigured(t *testing.T) {
+	s := newStorageCleaner(&Config{}, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{})
+	err := s.Start(context.Background(), host)
+	require.ErrorIs(t, err, errMissingTraceStorage)
+	require.EqualError(t, err, "cannot find storage factory: either trace_storage or trace_storages must be set, and no storage is configured")
+}
+
+func TestStorageCleanerSeveralStoragesNoneNamed(t *testing.T) {
+	config := &Config{}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		factories: map[string]storage.Factory{"b": &PurgerFactory{}, "a": &PurgerFactory{}},
+	})
+	err := s.Start(context.Background(), host)
+	require.ErrorIs(t, err, errMissingTraceStorage)
+	require.EqualError(t, err, "cannot find storage factory: either trace_storage or trace_storages must be set to pick one of the storages a, b")
+	// neither storage is picked
+	assert.Empty(t, config.storageNames())
+}
+
+func TestStorageCleanerNilFactory(t *testing.T) {
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t)}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: nil,
+	})
+	err := s.Start(context.Background(), host)
+	require.ErrorIs(t, err, errNilFactory)
+	require.EqualError(t, err, "cannot find storage factory 'storage': storage factory is nil")
+
+	_, err = purgeStorage(context.Background(), namedStorage{name: "storage"}, purgeRequest{})
+	require.ErrorIs(t, err, errNilFactory)
+}
+
+func TestStorageCleanerReportsRepeatedFailures(t *testing.T) {
+	config := &Config{
+		TraceStorage:     "storage",
+		Port:             getFreePort(t),
+		FailureThreshold: 2,
+	}
+	var events []*component.StatusEvent
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.ReportStatus = func(event *component.StatusEvent) {
+		events = append(events, event)
+	}
+	factory := &PurgerFactory{err: errors.New("backend is broken")}
+	s := startStorageCleanerWithConfig(t, config, settings, factory)
+
+	require.Equal(t, http.StatusInternalServerError, serveRequest(s, http.MethodPost, URL).Code)
+	assert.Empty(t, events, "a single failure must not be reported")
+
+	require.Equal(t, http.StatusInternalServerError, serveRequest(s, http.MethodPost, URL).Code)
+	require.Len(t, events, 1)
+	assert.Equal(t, component.StatusRecoverableError, events[0].Status())
+	require.ErrorContains(t, events[0].Err(), "2 consecutive purges failed, last error: error purging storage storage: backend is broken")
+
+	// a successful purge resets the counter and recovers the status
+	factory.err = nil
+	require.Equal(t, http.StatusOK, serveRequest(s, http.MethodPost, URL).Code)
+	require.Len(t, events, 2)
+	assert.Equal(t, component.StatusOK, events[1].Status())
+
+	factory.err = errors.New("backend is broken")
+	require.Equal(t, http.StatusInternalServerError, serveRequest(s, http.MethodPost, URL).Code)
+	assert.Len(t, events, 2)
+}
+
+func TestStorageExtensionStartTLSError(t *testing.T) {
+	config := &Config{
+		TraceStorage: "storage",
+		Port:         Port,
+	}
+	config.TLS = tlscfg.Options{
+		Enabled:  true,
+		CertPath: "invalid-cert.pem",
+		KeyPath:  "invalid-key.pem",
+	}
+	s := newStorageCleaner(config, componenttest.NewNopTelemetrySettings())
+	host := storagetest.NewStorageHost().WithExtension(
+		jaegerstorage.ID,
+		&mockStorageExt{
+			name:    "storage",
+			factory: &PurgerFactory{},
+		})
+	err := s.Start(context.Background(), host)
+	require.ErrorContains(t, err, "failed to load TLS config")
+}
+
+func TestStorageCleanerPurgeDisabled(t *testing.T) {
+	factory := &PurgerFactory{}
+	enabled := false
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), Purge: PurgeConfig{Enabled: &enabled}}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	for _, target := range []string{URL, URL + "?dry_run=true", ResetURL} {
+		w := serveRequest(s, http.MethodPost, target)
+		assert.Equal(t, http.StatusForbidden, w.Code, target)
+		assert.Contains(t, w.Body.String(), CodePurgeDisabled, target)
+	}
+	assert.Zero(t, factory.calls.Load())
+
+	w := serveRequest(s, http.MethodGet, StatusURL)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveRequest(s, http.MethodGet, MetricsURL)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestStorageCleanerMaxPurgeDuration(t *testing.T) {
+	// the legacy Purge method cannot observe the cancellation
+	factory := &PurgerFactory{delay: 500 * time.Millisecond}
+	config := &Config{
+		TraceStorage:     "storage",
+		Port:             getFreePort(t),
+		Concurrency:      ConcurrencyReject,
+		MaxPurgeDuration: 50 * time.Millisecond,
+	}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+
+	start := time.Now()
+	w := serveRequest(s, http.MethodPost, URL)
+	assert.Less(t, time.Since(start), factory.delay)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), CodePurgeTimeout)
+	assert.Zero(t, factory.completed.Load())
+
+	// the abandoned purge still holds the lock until it returns
+	w = serveRequest(s, http.MethodPost, URL)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	require.Eventually(t, func() bool {
+		return factory.completed.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return s.acquirePurge(context.Background()) == nil
+	}, time.Second, 10*time.Millisecond)
+	s.releasePurge()
+
+	// purges completing in time are not affected
+	factory.delay = 0
+	w = serveRequest(s, http.MethodPost, URL)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestStorageCleanerRegisteredFactory(t *testing.T) {
+	ctx := context.Background()
+	storageExtension, err := jaegerstorage.NewFactory().CreateExtension(ctx, extension.CreateSettings{
+		ID:                jaegerstorage.ID,
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}, &jaegerstorage.Config{
+		Memory: map[string]memoryCfg.Configuration{"memstore": {MaxTraces: 10}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, storageExtension.Start(ctx, componenttest.NewNopHost()))
+	defer func() {
+		require.NoError(t, storageExtension.Shutdown(ctx))
+	}()
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, storageExtension)
+
+	// a custom backend, not declared in the config of the storage extension
+	factory := &PurgerFactory{}
+	unregister, err := jaegerstorage.RegisterStorageFactory(host, "custom", factory)
+	require.NoError(t, err)
+	defer unregister()
+
+	s := newStorageCleaner(&Config{TraceStorage: "custom", Port: getFreePort(t)}, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, s.Start(ctx, host))
+	defer func() {
+		require.NoError(t, s.Shutdown(ctx))
+	}()
+	w := serveRequest(s, http.MethodPost, URL)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 1, factory.calls.Load())
+}
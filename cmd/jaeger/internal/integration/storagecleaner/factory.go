@@ -27,7 +27,9 @@ func NewFactory() extension.Factory {
 
 func createDefaultConfig() component.Config {
 	return &Config{
-		Port: Port,
+		Port:              Port,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		IdempotencyKeyTTL: defaultIdempotencyKeyTTL,
 	}
 }
 
@@ -36,5 +38,9 @@ func createExtension(
 	set extension.CreateSettings,
 	cfg component.Config,
 ) (extension.Extension, error) {
-	return newStorageCleaner(cfg.(*Config), set.TelemetrySettings), nil
+	config := cfg.(*Config)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return newStorageCleaner(config, set.TelemetrySettings), nil
 }
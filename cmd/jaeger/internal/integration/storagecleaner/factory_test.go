@@ -21,8 +21,16 @@ func TestCreateDefaultConfig(t *testing.T) {
 
 func TestCreateExtension(t *testing.T) {
 	cfg := createDefaultConfig().(*Config)
+	cfg.TraceStorage = "storage"
 	f := NewFactory()
 	r, err := f.CreateExtension(context.Background(), extensiontest.NewNopCreateSettings(), cfg)
 	require.NoError(t, err)
 	assert.NotNil(t, r)
 }
+
+func TestCreateExtensionEmptyTraceStorage(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.TraceStorages = []string{"a", ""}
+	_, err := NewFactory().CreateExtension(context.Background(), extensiontest.NewNopCreateSettings(), cfg)
+	require.ErrorIs(t, err, errMissingTraceStorage)
+}
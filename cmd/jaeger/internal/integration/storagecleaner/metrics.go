@@ -0,0 +1,87 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterScope = "github.com/jaegertracing/jaeger/cmd/jaeger/internal/integration/storagecleaner"
+
+// purgeMetrics holds the instruments recording purge operations.
+type purgeMetrics struct {
+	purges   metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+
+	// registry holds the same metrics for the /metrics endpoint of the extension,
+	// so that they can be scraped without a telemetry pipeline.
+	registry     *prometheus.Registry
+	promPurges   prometheus.Counter
+	promErrors   prometheus.Counter
+	promDuration prometheus.Histogram
+}
+
+func newPurgeMetrics(meterProvider metric.MeterProvider) (*purgeMetrics, error) {
+	meter := meterProvider.Meter(meterScope)
+	purges, err := meter.Int64Counter(
+		"jaeger_storagecleaner_purge_total",
+		metric.WithDescription("Number of purge requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter(
+		"jaeger_storagecleaner_purge_errors_total",
+		metric.WithDescription("Number of failed purge requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram(
+		"jaeger_storagecleaner_purge_duration_seconds",
+		metric.WithDescription("Duration of purge requests"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m := &purgeMetrics{
+		purges:   purges,
+		errors:   errors,
+		duration: duration,
+		registry: prometheus.NewRegistry(),
+		promPurges: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "jaeger_storagecleaner_purge_total",
+			Help: "Number of purge requests",
+		}),
+		promErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "jaeger_storagecleaner_purge_errors_total",
+			Help: "Number of failed purge requests",
+		}),
+		promDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "jaeger_storagecleaner_purge_duration_seconds",
+			Help: "Duration of purge requests",
+		}),
+	}
+	m.registry.MustRegister(m.promPurges, m.promErrors, m.promDuration)
+	return m, nil
+}
+
+// record records the outcome of a purge that started at the given time.
+func (m *purgeMetrics) record(ctx context.Context, start time.Time, err error) {
+	seconds := time.Since(start).Seconds()
+	m.purges.Add(ctx, 1)
+	m.promPurges.Inc()
+	if err != nil {
+		m.errors.Add(ctx, 1)
+		m.promErrors.Inc()
+	}
+	m.duration.Record(ctx, seconds)
+	m.promDuration.Observe(seconds)
+}
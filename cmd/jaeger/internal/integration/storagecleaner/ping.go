@@ -0,0 +1,63 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"net/http"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// PingURL is the path of the endpoint checking that the storages are reachable.
+const PingURL = "/ping"
+
+// PingResponse is returned by the ping endpoint.
+type PingResponse struct {
+	// Healthy is true when all storages are healthy.
+	Healthy  bool          `json:"healthy"`
+	Storages []StoragePing `json:"storages"`
+	// Code is set to CodeStorageUnavailable when a storage is unhealthy.
+	Code string `json:"code,omitempty"`
+}
+
+// StoragePing reports whether a storage is reachable.
+type StoragePing struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Pinged is false for storages that do not implement storage.Pinger,
+	// their health only reflects that their factory could be resolved.
+	Pinged bool   `json:"pinged"`
+	Error  string `json:"error,omitempty"`
+}
+
+// pingHandler resolves the factories of the storages and pings the backends of those
+// implementing storage.Pinger, without purging anything. It responds with 200 OK when
+// all of them are healthy, and 503 Service Unavailable otherwise.
+func (c *storageCleaner) pingHandler(w http.ResponseWriter, r *http.Request) {
+	resp := PingResponse{Healthy: true}
+	for _, name := range c.config.storageNames() {
+		result := StoragePing{Name: name, Healthy: true}
+		// resolve the factories on every request, like the status endpoint
+		f, err := jaegerstorage.GetStorageFactory(name, c.host)
+		if err == nil {
+			if pinger, ok := f.(storage.Pinger); ok {
+				result.Pinged = true
+				err = pinger.Ping(r.Context())
+			}
+		}
+		if err != nil {
+			result.Healthy = false
+			result.Error = err.Error()
+			resp.Healthy = false
+		}
+		resp.Storages = append(resp.Storages, result)
+	}
+	if !resp.Healthy {
+		resp.Code = CodeStorageUnavailable
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
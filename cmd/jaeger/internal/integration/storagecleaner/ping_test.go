@@ -0,0 +1,103 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+var _ storage.Pinger = (*PingerFactory)(nil)
+
+// PingerFactory reports its backend as reachable unless err is set.
+type PingerFactory struct {
+	PurgerFactory
+	err   error
+	pings int
+}
+
+func (f *PingerFactory) Ping(context.Context) error {
+	f.pings++
+	return f.err
+}
+
+func TestStorageCleanerPing(t *testing.T) {
+	tests := []struct {
+		name     string
+		factory  storage.Factory
+		status   int
+		expected PingResponse
+	}{
+		{
+			name:    "healthy",
+			factory: &PingerFactory{},
+			status:  http.StatusOK,
+			expected: PingResponse{
+				Healthy:  true,
+				Storages: []StoragePing{{Name: "storage", Healthy: true, Pinged: true}},
+			},
+		},
+		{
+			name:    "unhealthy",
+			factory: &PingerFactory{err: errors.New("connection refused")},
+			status:  http.StatusServiceUnavailable,
+			expected: PingResponse{
+				Storages: []StoragePing{{Name: "storage", Error: "connection refused", Pinged: true}},
+				Code:     CodeStorageUnavailable,
+			},
+		},
+		{
+			name:    "without pinger",
+			factory: &PurgerFactory{},
+			status:  http.StatusOK,
+			expected: PingResponse{
+				Healthy:  true,
+				Storages: []StoragePing{{Name: "storage", Healthy: true}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodGet, PingURL)
+			require.Equal(t, test.status, w.Code)
+			var resp PingResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.expected, resp)
+			if f, ok := test.factory.(*PingerFactory); ok {
+				assert.Equal(t, 1, f.pings)
+				// nothing is purged
+				assert.Zero(t, f.calls.Load())
+			}
+		})
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	factory := &PingerFactory{}
+	server := startClientServer(t, &Config{TraceStorage: "storage", Port: getFreePort(t)}, factory)
+	client := &Client{Endpoint: server.URL}
+
+	ping, err := client.Ping(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ping.Healthy)
+
+	factory.err = errors.New("connection refused")
+	ping, err = client.Ping(context.Background())
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusServiceUnavailable, respErr.StatusCode)
+	assert.Equal(t, CodeStorageUnavailable, respErr.Code)
+	assert.Equal(t, "storage storage is unhealthy: connection refused", respErr.Message)
+	require.NotNil(t, ping)
+	assert.False(t, ping.Healthy)
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.uber.org/zap"
+)
+
+// purgeOnce purges all storages, then asks the collector to shut down. Reporting a fatal error
+// is the only way for a component to stop the collector, which shuts down gracefully and exits
+// successfully. A failed purge fails Start instead, so that the collector exits with an error.
+func (c *storageCleaner) purgeOnce(ctx context.Context) error {
+	start := time.Now()
+	_, err := c.purge(ctx, purgeRequest{})
+	c.recordPurge(ctx, start, err)
+	if err != nil {
+		return fmt.Errorf("error purging once: %w", err)
+	}
+	c.settings.Logger.Info("Purged storages once, stopping the collector",
+		zap.Strings("storages", c.config.storageNames()),
+		zap.Duration("duration", time.Since(start)))
+	// the collector only receives fatal errors once all components are started,
+	// reporting one blocks until then
+	go c.settings.ReportStatus(component.NewFatalErrorEvent(errPurgeOnceDone))
+	return nil
+}
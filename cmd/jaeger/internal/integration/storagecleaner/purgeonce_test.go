@@ -0,0 +1,86 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+	"github.com/jaegertracing/jaeger/model"
+	memoryCfg "github.com/jaegertracing/jaeger/pkg/memory/config"
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/memory"
+	"github.com/jaegertracing/jaeger/storage"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// startPurgeOnce starts the extension with purge_once, returning the status events it reports.
+func startPurgeOnce(t *testing.T, factory storage.Factory) (*storageCleaner, <-chan *component.StatusEvent, error) {
+	events := make(chan *component.StatusEvent, 1)
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.ReportStatus = func(event *component.StatusEvent) {
+		events <- event
+	}
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), PurgeOnce: true}
+	s := newStorageCleaner(config, settings)
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: factory,
+	})
+	err := s.Start(context.Background(), host)
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown(context.Background()))
+	})
+	return s, events, err
+}
+
+func TestStorageCleanerPurgeOnce(t *testing.T) {
+	factory := memory.NewFactoryWithConfig(memoryCfg.Configuration{}, metrics.NullFactory, zap.NewNop())
+	writer, err := factory.CreateSpanWriter()
+	require.NoError(t, err)
+	traceID := model.NewTraceID(1, 1)
+	require.NoError(t, writer.WriteSpan(context.Background(), &model.Span{
+		TraceID: traceID,
+		SpanID:  model.NewSpanID(1),
+		Process: &model.Process{ServiceName: "foo"},
+	}))
+
+	s, events, err := startPurgeOnce(t, factory)
+	require.NoError(t, err)
+	reader, err := factory.CreateSpanReader()
+	require.NoError(t, err)
+	_, err = reader.GetTrace(context.Background(), traceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	// the collector is asked to shut down
+	select {
+	case event := <-events:
+		assert.Equal(t, component.StatusFatalError, event.Status())
+		require.ErrorIs(t, event.Err(), errPurgeOnceDone)
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown was not requested")
+	}
+	// no endpoint is served
+	assert.Nil(t, s.server)
+}
+
+func TestStorageCleanerPurgeOnceFailure(t *testing.T) {
+	_, events, err := startPurgeOnce(t, &PurgerFactory{err: assert.AnError})
+	require.ErrorIs(t, err, assert.AnError)
+	require.ErrorContains(t, err, "error purging once")
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected status %v", event.Status())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// ResetURL is the path of the endpoint purging the storages and recreating their schema.
+const ResetURL = "/reset"
+
+// errSchemaFailed marks a reset that purged the storages but could not recreate their schema.
+var errSchemaFailed = errors.New("schema step failed")
+
+// resetHandler gives the storages a clean slate: it purges them all, then recreates
+// the schema of those implementing storage.SchemaInitializer. Nothing is recreated
+// when the purge fails, the code of the error response reports the failed step.
+func (c *storageCleaner) resetHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := setRequestID(w, r)
+	if !c.authorized(r) {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	if !c.purgeEnabled(w) {
+		return
+	}
+	if !c.confirmed(w, r) {
+		return
+	}
+	if c.throttled(w) {
+		return
+	}
+	c.purges.Add(1)
+	defer c.purges.Done()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(c.shutdownCtx, cancel)
+	defer stop()
+
+	if err := c.acquirePurge(ctx); err != nil {
+		if errors.Is(err, errPurgeInProgress) {
+			writeError(w, http.StatusConflict, CodePurgeInProgress, err.Error())
+		} else {
+			writeError(w, http.StatusServiceUnavailable, CodeAborted, fmt.Sprintf("aborted while waiting for another purge: %v", err))
+		}
+		return
+	}
+	defer c.releasePurge()
+	resetStart := time.Now()
+	err := c.reset(ctx)
+	c.recordPurge(r.Context(), resetStart, err)
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.Strings("storages", c.config.storageNames()),
+		zap.Duration("duration", time.Since(resetStart)),
+	}
+	if err != nil {
+		c.settings.Logger.Error("Reset failed", append(fields, zap.String("outcome", "failure"), zap.Error(err))...)
+		writePurgeError(w, err)
+		return
+	}
+	c.settings.Logger.Info("Reset completed", append(fields, zap.String("outcome", "success"))...)
+	writeJSON(w, http.StatusOK, purgeMessage{Message: "Reset request processed successfully"})
+}
+
+func (c *storageCleaner) reset(ctx context.Context) error {
+	if _, err := c.purge(ctx, purgeRequest{}); err != nil {
+		return fmt.Errorf("purge step failed: %w", err)
+	}
+	for _, s := range c.storages {
+		initializer, ok := s.factory.(storage.SchemaInitializer)
+		if !ok {
+			continue
+		}
+		if err := initializer.InitializeSchema(ctx); err != nil {
+			return fmt.Errorf("%w: error initializing schema of storage %s: %w", errSchemaFailed, s.name, err)
+		}
+	}
+	return nil
+}
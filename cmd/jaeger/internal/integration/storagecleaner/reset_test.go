@@ -0,0 +1,101 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+var _ storage.SchemaInitializer = (*SchemaPurgerFactory)(nil)
+
+// SchemaPurgerFactory recreates its schema after being purged.
+type SchemaPurgerFactory struct {
+	PurgerFactory
+	schemaErr   error
+	schemaCalls atomic.Int32
+}
+
+func (f *SchemaPurgerFactory) InitializeSchema(context.Context) error {
+	f.schemaCalls.Add(1)
+	return f.schemaErr
+}
+
+func TestStorageCleanerReset(t *testing.T) {
+	t.Run("purge and schema", func(t *testing.T) {
+		factory := &SchemaPurgerFactory{}
+		s := startStorageCleaner(t, factory)
+		w := serveRequest(s, http.MethodPost, ResetURL)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"message":"Reset request processed successfully"}`, w.Body.String())
+		assert.Equal(t, int32(1), factory.calls.Load())
+		assert.Equal(t, int32(1), factory.schemaCalls.Load())
+	})
+	t.Run("storage without schema", func(t *testing.T) {
+		factory := &PurgerFactory{}
+		s := startStorageCleaner(t, factory)
+		w := serveRequest(s, http.MethodPost, ResetURL)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int32(1), factory.calls.Load())
+	})
+}
+
+func TestStorageCleanerResetErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		factory     *SchemaPurgerFactory
+		code        string
+		message     string
+		schemaCalls int32
+	}{
+		{
+			name:    "purge step",
+			factory: &SchemaPurgerFactory{PurgerFactory: PurgerFactory{err: errors.New("purge error")}},
+			code:    CodePurgeFailed,
+			message: "purge step failed: error purging storage storage: purge error",
+		},
+		{
+			name:        "schema step",
+			factory:     &SchemaPurgerFactory{schemaErr: errors.New("schema error")},
+			code:        CodeSchemaFailed,
+			message:     "schema step failed: error initializing schema of storage storage: schema error",
+			schemaCalls: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startStorageCleaner(t, test.factory)
+			w := serveRequest(s, http.MethodPost, ResetURL)
+			require.Equal(t, http.StatusInternalServerError, w.Code)
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, test.code, resp.Code)
+			assert.Equal(t, test.message, resp.Error)
+			assert.Equal(t, test.schemaCalls, test.factory.schemaCalls.Load())
+		})
+	}
+}
+
+func TestStorageCleanerResetRequiresConfirmation(t *testing.T) {
+	factory := &SchemaPurgerFactory{}
+	s := startStorageCleaner(t, factory)
+	s.config.RequireConfirmation = true
+
+	w := serveRequest(s, http.MethodPost, ResetURL)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Zero(t, factory.calls.Load())
+
+	w = serveRequest(s, http.MethodPost, ResetURL+"?confirm=storage")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), factory.schemaCalls.Load())
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+)
+
+// RetryConfig defines how purges that fail with a transient error are retried.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of purge attempts per storage.
+	// Values below 2 disable retries, which is the default.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialBackoff is the delay before the first retry, doubled after each attempt.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+func (cfg *RetryConfig) validate() error {
+	if cfg.MaxAttempts < 0 || cfg.InitialBackoff < 0 || cfg.MaxBackoff < 0 {
+		return errors.New("retry settings must not be negative")
+	}
+	if cfg.InitialBackoff == 0 {
+		cfg.InitialBackoff = defaultInitialBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = max(defaultMaxBackoff, cfg.InitialBackoff)
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		return errors.New("retry max_backoff must not be less than initial_backoff")
+	}
+	return nil
+}
+
+// isTransient reports whether err is worth retrying. Storage backends mark
+// transient errors (e.g. throttling) with a Temporary method, like net.Error.
+func isTransient(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// withRetry calls fn until it succeeds, fails with a non-transient error,
+// runs out of attempts or ctx is done.
+func withRetry[T any](ctx context.Context, cfg RetryConfig, fn func() (T, error)) (T, error) {
+	backoff := cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= cfg.MaxAttempts || !isTransient(err) {
+			return result, err
+		}
+		select {
+		case <-ctx.Done():
+			return result, errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, cfg.MaxBackoff)
+	}
+}
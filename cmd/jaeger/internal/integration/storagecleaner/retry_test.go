@@ -0,0 +1,114 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporarily unavailable" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(temporaryError{}))
+	assert.True(t, isTransient(fmt.Errorf("purge failed: %w", temporaryError{})))
+	assert.False(t, isTransient(errors.New("permanent")))
+	assert.False(t, isTransient(nil))
+}
+
+func TestWithRetry(t *testing.T) {
+	cfg := RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}
+	tests := []struct {
+		name          string
+		cfg           RetryConfig
+		errs          []error
+		expectedCalls int
+		expectedErr   bool
+	}{
+		{
+			name:          "succeeds after transient failures",
+			cfg:           cfg,
+			errs:          []error{temporaryError{}, temporaryError{}},
+			expectedCalls: 3,
+		},
+		{
+			name:          "gives up after max attempts",
+			cfg:           cfg,
+			errs:          []error{temporaryError{}, temporaryError{}, temporaryError{}},
+			expectedCalls: 3,
+			expectedErr:   true,
+		},
+		{
+			name:          "does not retry permanent errors",
+			cfg:           cfg,
+			errs:          []error{errors.New("permanent")},
+			expectedCalls: 1,
+			expectedErr:   true,
+		},
+		{
+			name:          "disabled by default",
+			errs:          []error{temporaryError{}},
+			expectedCalls: 1,
+			expectedErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			result, err := withRetry(context.Background(), test.cfg, func() (int, error) {
+				calls++
+				if calls <= len(test.errs) {
+					return 0, test.errs[calls-1]
+				}
+				return calls, nil
+			})
+			assert.Equal(t, test.expectedCalls, calls)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, calls, result)
+		})
+	}
+}
+
+func TestWithRetryContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg := RetryConfig{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	calls := 0
+	_, err := withRetry(ctx, cfg, func() (any, error) {
+		calls++
+		return nil, temporaryError{}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryConfigValidate(t *testing.T) {
+	cfg := RetryConfig{MaxAttempts: 3}
+	require.NoError(t, cfg.validate())
+	assert.Equal(t, defaultInitialBackoff, cfg.InitialBackoff)
+	assert.Equal(t, defaultMaxBackoff, cfg.MaxBackoff)
+
+	cfg = RetryConfig{MaxAttempts: -1}
+	require.ErrorContains(t, cfg.validate(), "must not be negative")
+
+	cfg = RetryConfig{InitialBackoff: time.Second, MaxBackoff: time.Millisecond}
+	require.ErrorContains(t, cfg.validate(), "max_backoff must not be less than initial_backoff")
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxScheduleSearch bounds the search for the next time matching a schedule,
+// which never comes for expressions such as "0 0 30 2 *" (February 30).
+const maxScheduleSearch = 5 * 365 * 24 * time.Hour
+
+// scheduleDescriptors are the shorthands accepted in place of a cron expression.
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the name and the range of values of a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// both 0 and 7 are Sunday
+	{name: "day of week", min: 0, max: 7},
+}
+
+// schedule is a parsed cron expression with the five standard fields: minute, hour,
+// day of month, month and day of week. Each field is the set of its matching values.
+type schedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// anyDayOfMonth and anyDayOfWeek are set when the field starts with "*". As in cron,
+	// a day matches either day field when both are restricted, and both otherwise.
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+// parseSchedule parses a cron expression such as "*/15 * * * *" or "0 3 * * 1-5",
+// or one of the scheduleDescriptors such as "@daily".
+func parseSchedule(expr string) (*schedule, error) {
+	if descriptor, ok := scheduleDescriptors[expr]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron expression %q, got %d", len(cronFields), expr, len(fields))
+	}
+	var values [len(cronFields)]uint64
+	for i, field := range cronFields {
+		var err error
+		values[i], err = parseCronField(fields[i], field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", field.name, fields[i], err)
+		}
+	}
+	if values[4]&(1<<7) != 0 {
+		values[4] = values[4]&^(1<<7) | 1
+	}
+	return &schedule{
+		minute:        values[0],
+		hour:          values[1],
+		dayOfMonth:    values[2],
+		month:         values[3],
+		dayOfWeek:     values[4],
+		anyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField returns the set of values matched by a comma-separated list
+// of "*", single values and ranges such as "1-5", each with an optional step.
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var values uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("step %q must be a positive integer", stepExpr)
+			}
+		}
+		low, high := field.min, field.max
+		if rangeExpr != "*" {
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if low, err = strconv.Atoi(lowExpr); err != nil {
+				return 0, fmt.Errorf("%q is not a number", lowExpr)
+			}
+			switch {
+			case isRange:
+				if high, err = strconv.Atoi(highExpr); err != nil {
+					return 0, fmt.Errorf("%q is not a number", highExpr)
+				}
+			case !hasStep:
+				// a single value, while "5/15" starts at 5 and goes up to the maximum
+				high = low
+			}
+		}
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%d-%d is not within %d-%d", low, high, field.min, field.max)
+		}
+		for v := low; v <= high; v += step {
+			values |= 1 << uint(v)
+		}
+	}
+	return values, nil
+}
+
+// next returns the first minute after t matching the schedule, in the location of t.
+// It returns the zero time when there is none within maxScheduleSearch.
+func (s *schedule) next(t time.Time) time.Time {
+	limit := t.Add(maxScheduleSearch)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// clock is the source of time of the purge schedule, replaced in tests.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// startSchedule purges all storages at the times matching the schedule,
+// until the extension shuts down.
+func (c *storageCleaner) startSchedule(sched *schedule) {
+	c.purges.Add(1)
+	go func() {
+		defer c.purges.Done()
+		for {
+			now := c.clock.Now()
+			next := sched.next(now)
+			if next.IsZero() {
+				c.settings.Logger.Warn("Purge schedule never matches, no purge is scheduled",
+					zap.String("schedule", c.config.Schedule))
+				return
+			}
+			select {
+			case <-c.shutdownCtx.Done():
+				return
+			case <-c.clock.After(next.Sub(now)):
+				c.scheduledPurge(c.shutdownCtx)
+			}
+		}
+	}()
+}
+
+// scheduledPurge purges all storages, waiting for the purge in flight if any, or skipping
+// this run when the concurrency setting is ConcurrencyReject.
+func (c *storageCleaner) scheduledPurge(ctx context.Context) {
+	fields := []zap.Field{zap.String("schedule", c.config.Schedule)}
+	if err := c.acquirePurge(ctx); err != nil {
+		c.settings.Logger.Warn("Skipping scheduled purge", append(fields, zap.Error(err))...)
+		return
+	}
+	defer c.releasePurge()
+	start := time.Now()
+	_, err := c.purge(ctx, purgeRequest{})
+	c.recordPurge(ctx, start, err)
+	fields = append(fields, zap.Duration("duration", time.Since(start)))
+	if err != nil {
+		c.settings.Logger.Error("Scheduled purge failed", append(fields, zap.Error(err))...)
+		return
+	}
+	c.settings.Logger.Info("Scheduled purge completed", fields...)
+}
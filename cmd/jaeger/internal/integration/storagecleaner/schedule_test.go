@@ -0,0 +1,182 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/jaegertracing/jaeger/cmd/jaeger/internal/extension/jaegerstorage"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// Saturday
+	from := time.Date(2024, 6, 1, 10, 2, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{expr: "* * * * *", next: time.Date(2024, 6, 1, 10, 3, 0, 0, time.UTC)},
+		{expr: "*/5 * * * *", next: time.Date(2024, 6, 1, 10, 5, 0, 0, time.UTC)},
+		{expr: "1,2 * * * *", next: time.Date(2024, 6, 1, 11, 1, 0, 0, time.UTC)},
+		{expr: "30 3 * * *", next: time.Date(2024, 6, 2, 3, 30, 0, 0, time.UTC)},
+		{expr: "0 9-17/4 * * *", next: time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 1-5", next: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", next: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{expr: "0 0 15 * 1", next: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", next: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "@daily", next: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", next: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *"},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			sched, err := parseSchedule(test.expr)
+			require.NoError(t, err)
+			assert.Equal(t, test.next, sched.next(from))
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		expr        string
+		expectedErr string
+	}{
+		{expr: "", expectedErr: "expected 5 fields"},
+		{expr: "* * * *", expectedErr: "expected 5 fields"},
+		{expr: "@often", expectedErr: "expected 5 fields"},
+		{expr: "60 * * * *", expectedErr: `invalid minute "60": 60-60 is not within 0-59`},
+		{expr: "* 5-1 * * *", expectedErr: `invalid hour "5-1"`},
+		{expr: "* * 0 * *", expectedErr: `invalid day of month "0"`},
+		{expr: "* * * jan *", expectedErr: `invalid month "jan": "jan" is not a number`},
+		{expr: "* * * * 1-x", expectedErr: `invalid day of week "1-x"`},
+		{expr: "*/0 * * * *", expectedErr: `step "0" must be a positive integer`},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := parseSchedule(test.expr)
+			require.ErrorContains(t, err, test.expectedErr)
+		})
+	}
+}
+
+// fakeClock is a clock whose time only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeTimer{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the time forward, firing the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var waiters []fakeTimer
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+func (c *fakeClock) waiting() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters) > 0
+}
+
+// startScheduledCleaner starts the extension purging every 5 minutes, from 10:02 on the fake clock.
+func startScheduledCleaner(t *testing.T, factory *PurgerFactory) (*storageCleaner, *fakeClock, *observer.ObservedLogs) {
+	zapCore, logs := observer.New(zap.InfoLevel)
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.Logger = zap.New(zapCore)
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), Schedule: "*/5 * * * *"}
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 10, 2, 0, 0, time.UTC)}
+	s := newStorageCleaner(config, settings)
+	s.clock = clock
+	host := storagetest.NewStorageHost().WithExtension(jaegerstorage.ID, &mockStorageExt{
+		name:    "storage",
+		factory: factory,
+	})
+	require.NoError(t, s.Start(context.Background(), host))
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown(context.Background()))
+	})
+	require.Eventually(t, clock.waiting, 5*time.Second, time.Millisecond)
+	return s, clock, logs
+}
+
+func TestStorageCleanerSchedule(t *testing.T) {
+	factory := &PurgerFactory{}
+	s, clock, logs := startScheduledCleaner(t, factory)
+
+	clock.Advance(2 * time.Minute)
+	// 10:04 is not scheduled
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, factory.calls.Load())
+
+	for i := int32(1); i <= 2; i++ {
+		clock.Advance(time.Minute)
+		require.Eventually(t, func() bool {
+			return factory.calls.Load() == i
+		}, 5*time.Second, time.Millisecond)
+		require.Eventually(t, clock.waiting, 5*time.Second, time.Millisecond)
+		clock.Advance(4 * time.Minute)
+	}
+	// the runs are logged before the next one is scheduled
+	assert.Equal(t, 2, logs.FilterMessage("Scheduled purge completed").Len())
+
+	// manual purges still work
+	w := serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(3), factory.calls.Load())
+}
+
+func TestStorageCleanerScheduleFailure(t *testing.T) {
+	factory := &PurgerFactory{err: assert.AnError}
+	_, clock, logs := startScheduledCleaner(t, factory)
+
+	clock.Advance(3 * time.Minute)
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("Scheduled purge failed").Len() == 1
+	}, 5*time.Second, time.Millisecond)
+	failure := logs.FilterMessage("Scheduled purge failed").All()[0]
+	assert.Equal(t, "*/5 * * * *", failure.ContextMap()["schedule"])
+	assert.Contains(t, failure.ContextMap()["error"], assert.AnError.Error())
+}
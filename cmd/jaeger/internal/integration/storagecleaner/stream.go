@@ -0,0 +1,173 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// StreamURL is the path of the endpoint streaming the progress of a purge as Server-Sent Events.
+const StreamURL = URL + "/stream"
+
+// defaultProgressInterval is how often storages implementing storage.ProgressReporter are polled.
+const defaultProgressInterval = time.Second
+
+// Types of the events sent by the stream endpoint.
+const (
+	eventStart    = "start"
+	eventProgress = "progress"
+	eventEnd      = "end"
+)
+
+// eventBufferSize is the number of events buffered for each client of the stream endpoint.
+// Events are dropped for clients lagging further behind, so that they cannot block purges.
+const eventBufferSize = 64
+
+// purgeEvent is an event sent by the stream endpoint, its type is the SSE event name.
+type purgeEvent struct {
+	typ string
+	// Storages lists the storages purged, in start events.
+	Storages []string `json:"storages,omitempty"`
+	// Storage is the storage being purged, in progress events.
+	Storage      string `json:"storage,omitempty"`
+	DeletedSpans int64  `json:"deleted_spans,omitempty"`
+	TotalSpans   int64  `json:"total_spans,omitempty"`
+	// Error is the reason of a failed purge, in end events.
+	Error string `json:"error,omitempty"`
+}
+
+// progressHub broadcasts the events of purges to the clients of the stream endpoint.
+type progressHub struct {
+	mu          sync.Mutex
+	subscribers map[chan purgeEvent]struct{}
+	// running is the start event of the purge in flight, nil when none runs.
+	running *purgeEvent
+}
+
+// subscribe returns the channel receiving the events of the next purge, or of the
+// purge in flight, starting with its start event.
+func (h *progressHub) subscribe() (events chan purgeEvent, unsubscribe func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan purgeEvent]struct{})
+	}
+	events = make(chan purgeEvent, eventBufferSize)
+	if h.running != nil {
+		events <- *h.running
+	}
+	h.subscribers[events] = struct{}{}
+	return events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, events)
+	}
+}
+
+func (h *progressHub) publish(event purgeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch event.typ {
+	case eventStart:
+		h.running = &event
+	case eventEnd:
+		h.running = nil
+	}
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// reportProgress polls the progress of the storage while it is purged, if it implements
+// storage.ProgressReporter, until the returned function is called.
+func (c *storageCleaner) reportProgress(s namedStorage) (stop func()) {
+	reporter, ok := s.factory.(storage.ProgressReporter)
+	if !ok {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(c.progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				progress := reporter.PurgeProgress()
+				c.progress.publish(purgeEvent{
+					typ:          eventProgress,
+					Storage:      s.name,
+					DeletedSpans: progress.DeletedSpans,
+					TotalSpans:   progress.TotalSpans,
+				})
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// streamHandler follows the purge in flight, or the next one, and sends its start, progress
+// and end events as Server-Sent Events. It returns once the end event has been sent.
+// Progress events are only sent for storages implementing storage.ProgressReporter.
+func (c *storageCleaner) streamHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// the stream outlives the write timeout of the server
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		writeError(w, http.StatusInternalServerError, CodeInternalError, err.Error())
+		return
+	}
+	events, unsubscribe := c.progress.subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.shutdownCtx.Done():
+			return
+		case event := <-events:
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			if event.typ == eventEnd {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event purgeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.typ, data)
+	return err
+}
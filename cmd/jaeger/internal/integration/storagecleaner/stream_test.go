@@ -0,0 +1,132 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+
+	"github.com/jaegertracing/jaeger/storage"
+	factoryMocks "github.com/jaegertracing/jaeger/storage/mocks"
+)
+
+var _ storage.ProgressReporter = (*ProgressPurgerFactory)(nil)
+
+// ProgressPurgerFactory deletes its spans in steps, reporting how many are deleted so far.
+type ProgressPurgerFactory struct {
+	factoryMocks.Factory
+	steps   int64
+	deleted atomic.Int64
+}
+
+func (f *ProgressPurgerFactory) Purge(context.Context) error {
+	for i := int64(1); i <= f.steps; i++ {
+		time.Sleep(20 * time.Millisecond)
+		f.deleted.Store(i * 10)
+	}
+	return nil
+}
+
+func (f *ProgressPurgerFactory) PurgeProgress() storage.PurgeProgress {
+	return storage.PurgeProgress{DeletedSpans: f.deleted.Load(), TotalSpans: f.steps * 10}
+}
+
+type streamEvent struct {
+	name string
+	data purgeEvent
+}
+
+// startStream opens the stream endpoint, once it returns the client follows the next purge.
+func startStream(t *testing.T, server *httptest.Server) <-chan streamEvent {
+	resp, err := http.Get(server.URL + StreamURL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	events := make(chan streamEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		var event streamEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.data))
+			case line == "":
+				events <- event
+				event = streamEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func TestStorageCleanerStream(t *testing.T) {
+	factory := &ProgressPurgerFactory{steps: 5}
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t)}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+	s.progressInterval = 10 * time.Millisecond
+	server := httptest.NewServer(s.server.Handler)
+	defer server.Close()
+
+	events := startStream(t, server)
+	require.NoError(t, (&Client{Endpoint: server.URL}).Purge(context.Background()))
+
+	var received []streamEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	require.GreaterOrEqual(t, len(received), 3, "expected start, progress and end events: %v", received)
+	assert.Equal(t, streamEvent{name: eventStart, data: purgeEvent{Storages: []string{"storage"}}}, received[0])
+	assert.Equal(t, streamEvent{name: eventEnd}, received[len(received)-1])
+	var deleted int64
+	for _, event := range received[1 : len(received)-1] {
+		assert.Equal(t, eventProgress, event.name)
+		assert.Equal(t, "storage", event.data.Storage)
+		assert.Equal(t, int64(50), event.data.TotalSpans)
+		assert.GreaterOrEqual(t, event.data.DeletedSpans, deleted)
+		deleted = event.data.DeletedSpans
+	}
+}
+
+func TestStorageCleanerStreamWithoutProgress(t *testing.T) {
+	factory := &PurgerFactory{err: assert.AnError}
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t)}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+	server := httptest.NewServer(s.server.Handler)
+	defer server.Close()
+
+	events := startStream(t, server)
+	require.Error(t, (&Client{Endpoint: server.URL}).Purge(context.Background()))
+
+	var received []streamEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	require.Len(t, received, 2)
+	assert.Equal(t, eventStart, received[0].name)
+	assert.Equal(t, eventEnd, received[1].name)
+	assert.Equal(t, "error purging storage storage: "+assert.AnError.Error(), received[1].data.Error)
+}
+
+func TestStorageCleanerStreamMethodNotAllowed(t *testing.T) {
+	s := startStorageCleaner(t, &PurgerFactory{})
+	w := serveRequest(s, http.MethodPost, StreamURL)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Contains(t, w.Body.String(), CodeMethodNotAllowed)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultConsistencyInterval is how often a storage is read while waiting for a purge to settle.
+const defaultConsistencyInterval = 100 * time.Millisecond
+
+// errStillNotEmpty is returned when a storage still returns data wait_timeout after a purge with wait=true.
+var errStillNotEmpty = errors.New("still returns data")
+
+// waitUntilEmpty reads the storages until none of them returns data, so that purges
+// of eventually consistent backends such as Elasticsearch are visible to readers
+// before the purge request completes. It gives up after WaitTimeout.
+func (c *storageCleaner) waitUntilEmpty(ctx context.Context, storages []namedStorage) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.WaitTimeout)
+	defer cancel()
+	for _, s := range storages {
+		if err := c.waitUntilStorageEmpty(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitUntilStorageEmpty polls the span reader of the storage until it reports no services.
+func (c *storageCleaner) waitUntilStorageEmpty(ctx context.Context, s namedStorage) error {
+	reader, err := s.factory.CreateSpanReader()
+	if err != nil {
+		return fmt.Errorf("cannot create span reader of storage %s: %w", s.name, err)
+	}
+	ticker := time.NewTicker(c.consistencyInterval)
+	defer ticker.Stop()
+	for {
+		services, err := reader.GetServices(ctx)
+		if err == nil && len(services) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ctx.Err()
+			}
+			if err != nil {
+				return fmt.Errorf("storage %s %w %v after the purge: %w", s.name, errStillNotEmpty, c.config.WaitTimeout, err)
+			}
+			return fmt.Errorf("storage %s %w %v after the purge, services %v remain", s.name, errStillNotEmpty, c.config.WaitTimeout, services)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storagecleaner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// settlingReader keeps returning a service for the first `stale` reads after a purge.
+type settlingReader struct {
+	spanstore.Reader
+	stale int32
+	reads atomic.Int32
+}
+
+func (r *settlingReader) GetServices(context.Context) ([]string, error) {
+	if r.reads.Add(1) <= r.stale {
+		return []string{"stale-service"}, nil
+	}
+	return nil, nil
+}
+
+// SettlingPurgerFactory is a purger whose reader only reflects a purge after a while.
+type SettlingPurgerFactory struct {
+	PurgerFactory
+	reader    *settlingReader
+	readerErr error
+}
+
+func (f *SettlingPurgerFactory) CreateSpanReader() (spanstore.Reader, error) {
+	return f.reader, f.readerErr
+}
+
+func startSettlingCleaner(t *testing.T, factory *SettlingPurgerFactory, waitTimeout time.Duration) *storageCleaner {
+	config := &Config{TraceStorage: "storage", Port: getFreePort(t), WaitTimeout: waitTimeout}
+	s := startStorageCleanerWithConfig(t, config, componenttest.NewNopTelemetrySettings(), factory)
+	s.consistencyInterval = time.Millisecond
+	return s
+}
+
+func TestStorageCleanerPurgeWait(t *testing.T) {
+	factory := &SettlingPurgerFactory{reader: &settlingReader{stale: 3}}
+	s := startSettlingCleaner(t, factory, 5*time.Second)
+
+	w := serveRequest(s, http.MethodPost, URL+"?wait=true")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int32(1), factory.calls.Load())
+	// the response waits for the first read reporting an empty storage
+	assert.Equal(t, int32(4), factory.reader.reads.Load())
+
+	w = serveRequest(s, http.MethodPost, URL)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(4), factory.reader.reads.Load(), "the storage is only read with wait=true")
+}
+
+func TestStorageCleanerPurgeWaitTimeout(t *testing.T) {
+	factory := &SettlingPurgerFactory{reader: &settlingReader{stale: 1 << 30}}
+	s := startSettlingCleaner(t, factory, 50*time.Millisecond)
+
+	w := serveRequest(s, http.MethodPost, URL+"?wait=true")
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, CodeStillNotEmpty, resp.Code)
+	assert.Equal(t, "storage storage still returns data 50ms after the purge, services [stale-service] remain", resp.Error)
+}
+
+func TestStorageCleanerPurgeWaitReaderError(t *testing.T) {
+	factory := &SettlingPurgerFactory{readerErr: assert.AnError}
+	s := startSettlingCleaner(t, factory, time.Second)
+
+	w := serveRequest(s, http.MethodPost, URL+"?wait=true")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot create span reader of storage storage")
+}
+
+func TestStorageCleanerPurgeWaitInvalid(t *testing.T) {
+	factory := &SettlingPurgerFactory{reader: &settlingReader{}}
+	s := startSettlingCleaner(t, factory, time.Second)
+
+	tests := []struct {
+		query       string
+		expectedErr string
+	}{
+		{query: "?wait=maybe", expectedErr: `invalid wait \"maybe\"`},
+		{query: "?wait=true&service=frontend", expectedErr: "wait cannot be combined with"},
+		{query: "?wait=true&target=dependencies", expectedErr: "wait cannot be combined with"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			w := serveRequest(s, http.MethodPost, URL+test.query)
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), test.expectedErr)
+		})
+	}
+	assert.Zero(t, factory.calls.Load())
+}
@@ -525,7 +525,7 @@ func TestGetDependenciesSuccessGRPC(t *testing.T) {
 	withServerAndClient(t, func(server *grpcServer, client *grpcClient) {
 		expectedDependencies := []model.DependencyLink{{Parent: "killer", Child: "queen", CallCount: 12}}
 		endTs := time.Now().UTC()
-		server.depReader.On("GetDependencies", endTs.Add(time.Duration(-1)*defaultDependencyLookbackDuration), defaultDependencyLookbackDuration).
+		server.depReader.On("GetDependencies", endTs, defaultDependencyLookbackDuration).
 			Return(expectedDependencies, nil).Times(1)
 
 		res, err := client.GetDependencies(context.Background(), &api_v2.GetDependenciesRequest{
@@ -537,10 +537,27 @@ func TestGetDependenciesSuccessGRPC(t *testing.T) {
 	})
 }
 
+// TestGetDependenciesTimeRangeGRPC checks that the requested range is looked up as its end time
+// and a lookback, like the HTTP handler does, rather than a window ending at its start time.
+func TestGetDependenciesTimeRangeGRPC(t *testing.T) {
+	withServerAndClient(t, func(server *grpcServer, client *grpcClient) {
+		endTs := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+		server.depReader.On("GetDependencies", endTs, 2*time.Hour).
+			Return([]model.DependencyLink{}, nil).Times(1)
+
+		_, err := client.GetDependencies(context.Background(), &api_v2.GetDependenciesRequest{
+			StartTime: endTs.Add(-2 * time.Hour),
+			EndTime:   endTs,
+		})
+		require.NoError(t, err)
+		server.depReader.AssertExpectations(t)
+	})
+}
+
 func TestGetDependenciesFailureGRPC(t *testing.T) {
 	withServerAndClient(t, func(server *grpcServer, client *grpcClient) {
 		endTs := time.Now().UTC()
-		server.depReader.On("GetDependencies", endTs.Add(time.Duration(-1)*defaultDependencyLookbackDuration), defaultDependencyLookbackDuration).
+		server.depReader.On("GetDependencies", endTs, defaultDependencyLookbackDuration).
 			Return(nil, errStorageGRPC).Times(1)
 
 		_, err := client.GetDependencies(context.Background(), &api_v2.GetDependenciesRequest{
@@ -30,6 +30,7 @@ type Client interface {
 	Index() IndexService
 	Search(indices ...string) SearchService
 	MultiSearch() MultiSearchService
+	DeleteByQuery(indices ...string) DeleteByQueryService
 	io.Closer
 	GetVersion() uint
 }
@@ -75,3 +76,13 @@ type MultiSearchService interface {
 	Index(indices ...string) MultiSearchService
 	Do(ctx context.Context) (*elastic.MultiSearchResult, error)
 }
+
+// DeleteByQueryService is an abstraction for elastic.DeleteByQueryService
+type DeleteByQueryService interface {
+	Query(query elastic.Query) DeleteByQueryService
+	ProceedOnVersionConflict() DeleteByQueryService
+	IgnoreUnavailable(ignoreUnavailable bool) DeleteByQueryService
+	Refresh(refresh string) DeleteByQueryService
+	Slices(slices interface{}) DeleteByQueryService
+	Do(ctx context.Context) (*elastic.BulkIndexByScrollResponse, error)
+}
@@ -97,6 +97,11 @@ func (c ClientWrapper) MultiSearch() es.MultiSearchService {
 	return WrapESMultiSearchService(multiSearchService)
 }
 
+// DeleteByQuery calls this function to internal client.
+func (c ClientWrapper) DeleteByQuery(indices ...string) es.DeleteByQueryService {
+	return WrapESDeleteByQueryService(c.client.DeleteByQuery(indices...))
+}
+
 // Close closes ESClient and flushes all data to the storage.
 func (c ClientWrapper) Close() error {
 	c.client.Stop()
@@ -284,3 +289,45 @@ func (s MultiSearchServiceWrapper) Index(indices ...string) es.MultiSearchServic
 func (s MultiSearchServiceWrapper) Do(ctx context.Context) (*elastic.MultiSearchResult, error) {
 	return s.multiSearchService.Do(ctx)
 }
+
+// ---
+
+// DeleteByQueryServiceWrapper is a wrapper around elastic.DeleteByQueryService
+type DeleteByQueryServiceWrapper struct {
+	deleteByQueryService *elastic.DeleteByQueryService
+}
+
+// WrapESDeleteByQueryService creates an ESDeleteByQueryService out of *elastic.DeleteByQueryService.
+func WrapESDeleteByQueryService(deleteByQueryService *elastic.DeleteByQueryService) DeleteByQueryServiceWrapper {
+	return DeleteByQueryServiceWrapper{deleteByQueryService: deleteByQueryService}
+}
+
+// Query calls this function to internal service.
+func (s DeleteByQueryServiceWrapper) Query(query elastic.Query) es.DeleteByQueryService {
+	return WrapESDeleteByQueryService(s.deleteByQueryService.Query(query))
+}
+
+// ProceedOnVersionConflict calls this function to internal service.
+func (s DeleteByQueryServiceWrapper) ProceedOnVersionConflict() es.DeleteByQueryService {
+	return WrapESDeleteByQueryService(s.deleteByQueryService.ProceedOnVersionConflict())
+}
+
+// IgnoreUnavailable calls this function to internal service.
+func (s DeleteByQueryServiceWrapper) IgnoreUnavailable(ignoreUnavailable bool) es.DeleteByQueryService {
+	return WrapESDeleteByQueryService(s.deleteByQueryService.IgnoreUnavailable(ignoreUnavailable))
+}
+
+// Refresh calls this function to internal service.
+func (s DeleteByQueryServiceWrapper) Refresh(refresh string) es.DeleteByQueryService {
+	return WrapESDeleteByQueryService(s.deleteByQueryService.Refresh(refresh))
+}
+
+// Slices calls this function to internal service.
+func (s DeleteByQueryServiceWrapper) Slices(slices interface{}) es.DeleteByQueryService {
+	return WrapESDeleteByQueryService(s.deleteByQueryService.Slices(slices))
+}
+
+// Do calls this function to internal service.
+func (s DeleteByQueryServiceWrapper) Do(ctx context.Context) (*elastic.BulkIndexByScrollResponse, error) {
+	return s.deleteByQueryService.Do(ctx)
+}
@@ -15,6 +15,7 @@
 package badger
 
 import (
+	"context"
 	"errors"
 	"expvar"
 	"flag"
@@ -308,7 +309,10 @@ func (f *Factory) registerBadgerExpvarMetrics(metricsFactory metrics.Factory) {
 // Purge removes all data from the Factory's underlying Badger store.
 // This function is intended for testing purposes only and should not be used in production environments.
 // Calling Purge in production will result in permanent data loss.
-func (f *Factory) Purge() error {
+func (f *Factory) Purge(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return f.store.Update(func(txn *badger.Txn) error {
 		return f.store.DropAll()
 	})
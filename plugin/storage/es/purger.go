@@ -0,0 +1,49 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package es
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/olivere/elastic"
+
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// purgeIndexPattern matches the span, service, dependency and sampling indices,
+// including the archive ones, of a Factory without index prefix.
+const purgeIndexPattern = "jaeger-*"
+
+// deleteByQueryPurger removes all documents from the indices of a Factory with
+// delete-by-query, which keeps the indices and their mappings in place.
+type deleteByQueryPurger struct {
+	factory *Factory
+}
+
+// NewPurger returns the storage.Purger of a Factory backed by Elasticsearch or OpenSearch.
+// The delete-by-query is sliced automatically so that large indices are purged in parallel,
+// which both backends support.
+func NewPurger(f *Factory) storage.Purger {
+	return &deleteByQueryPurger{factory: f}
+}
+
+// Purge implements storage.Purger.
+func (p *deleteByQueryPurger) Purge(ctx context.Context) error {
+	index := purgeIndexPattern
+	if prefix := p.factory.primaryConfig.IndexPrefix; prefix != "" {
+		index = prefix + "-" + index
+	}
+	_, err := p.factory.getPrimaryClient().DeleteByQuery(index).
+		Query(elastic.NewMatchAllQuery()).
+		ProceedOnVersionConflict().
+		IgnoreUnavailable(true).
+		Refresh("true").
+		Slices("auto").
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to purge indices %s: %w", index, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package es
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jaegertracing/jaeger/pkg/es"
+	escfg "github.com/jaegertracing/jaeger/pkg/es/config"
+	"github.com/jaegertracing/jaeger/pkg/es/mocks"
+	"github.com/jaegertracing/jaeger/storage"
+)
+
+// newPurgerFactory returns a Factory whose primary client expects a delete-by-query on index.
+func newPurgerFactory(t *testing.T, indexPrefix, index string) (*Factory, *mocks.DeleteByQueryService) {
+	deleteByQuery := &mocks.DeleteByQueryService{}
+	deleteByQuery.On("Query", elastic.NewMatchAllQuery()).Return(deleteByQuery)
+	deleteByQuery.On("ProceedOnVersionConflict").Return(deleteByQuery)
+	deleteByQuery.On("IgnoreUnavailable", true).Return(deleteByQuery)
+	deleteByQuery.On("Refresh", "true").Return(deleteByQuery)
+	deleteByQuery.On("Slices", "auto").Return(deleteByQuery)
+	client := &mocks.Client{}
+	client.On("DeleteByQuery", index).Return(deleteByQuery)
+	t.Cleanup(func() {
+		client.AssertExpectations(t)
+		deleteByQuery.AssertExpectations(t)
+	})
+
+	f := NewFactory()
+	f.primaryConfig = &escfg.Configuration{IndexPrefix: indexPrefix}
+	var c es.Client = client
+	f.primaryClient.Store(&c)
+	return f, deleteByQuery
+}
+
+func TestPurger(t *testing.T) {
+	f, deleteByQuery := newPurgerFactory(t, "", "jaeger-*")
+	deleteByQuery.On("Do", mock.Anything).Return(&elastic.BulkIndexByScrollResponse{}, nil)
+
+	var purger storage.Purger = NewPurger(f)
+	require.NoError(t, purger.Purge(context.Background()))
+}
+
+func TestPurgerIndexPrefix(t *testing.T) {
+	f, deleteByQuery := newPurgerFactory(t, "tenant", "tenant-jaeger-*")
+	deleteByQuery.On("Do", mock.Anything).Return(&elastic.BulkIndexByScrollResponse{}, nil)
+
+	require.NoError(t, NewPurger(f).Purge(context.Background()))
+}
+
+func TestPurgerError(t *testing.T) {
+	f, deleteByQuery := newPurgerFactory(t, "", "jaeger-*")
+	deleteByQuery.On("Do", mock.Anything).Return(nil, errors.New("index is read-only"))
+
+	err := NewPurger(f).Purge(context.Background())
+	require.EqualError(t, err, "failed to purge indices jaeger-*: index is read-only")
+}
@@ -15,6 +15,7 @@
 package integration
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -47,12 +48,17 @@ func (s *BadgerIntegrationStorage) initialize(t *testing.T) {
 	s.SpanReader, err = s.factory.CreateSpanReader()
 	require.NoError(t, err)
 
+	s.DependencyReader, err = s.factory.CreateDependencyReader()
+	require.NoError(t, err)
+	s.DependenciesFromSpans = true
+	s.ManyServicesCount = 5000
+
 	s.SamplingStore, err = s.factory.CreateSamplingStore(0)
 	require.NoError(t, err)
 }
 
 func (s *BadgerIntegrationStorage) cleanUp(t *testing.T) {
-	s.factory.Purge()
+	s.factory.Purge(context.Background())
 }
 
 func TestBadgerStorage(t *testing.T) {
@@ -180,7 +180,7 @@ func testElasticsearchStorage(t *testing.T, allTagsAsFields bool) {
 	s := &ESStorageIntegration{}
 	s.initializeES(t, allTagsAsFields)
 
-	s.Fixtures = LoadAndParseQueryTestCases(t, "fixtures/queries_es.json")
+	s.Fixtures = s.LoadQueryFixtures(t, "fixtures/queries_es.json")
 
 	s.RunAll(t)
 }
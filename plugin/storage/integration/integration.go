@@ -79,6 +79,28 @@ type StorageIntegration struct {
 	// Skip testing trace binary tags, logs, and process
 	SkipBinaryAttrs bool
 
+	// Number of distinct services written by the GetManyServices test, e.g. 5000, checking
+	// that GetServices does not cap its results. The test is skipped when it is zero, since
+	// the spans are written one by one, which is slow with remote backends.
+	ManyServicesCount int
+
+	// DependenciesFromSpans enables the GetDependenciesFromSpans test for backends computing
+	// dependency links from the stored spans when queried, such as memory and badger.
+	DependenciesFromSpans bool
+
+	// AggregateDependencies is called by the GetDependenciesFromSpans test after writing spans,
+	// for backends that compute dependency links asynchronously (e.g. with a Spark job).
+	// Setting it also enables the test. Backends only returning the links computed by
+	// an external job, such as Elasticsearch or Cassandra, skip the test otherwise.
+	AggregateDependencies func(t *testing.T)
+
+	// TimeReference is the time the dates of the fixtures are relative to, they are moved
+	// to the day before and two days before it. It defaults to the time the first fixture
+	// is loaded, so that the traces and the queries agree even when the tests run past
+	// midnight. Backends searching a fixed window, e.g. the last 72 hours, may need
+	// it to be set explicitly so that the fixtures fall into that window.
+	TimeReference time.Time
+
 	// List of tests which has to be skipped, it can be regex too.
 	SkipList []string
 
@@ -162,6 +184,53 @@ func (s *StorageIntegration) testGetServices(t *testing.T) {
 	}
 }
 
+func (s *StorageIntegration) testGetManyServices(t *testing.T) {
+	s.skipIfNeeded(t)
+	count := s.ManyServicesCount
+	if count == 0 {
+		t.Skip("Skipping GetManyServices test because ManyServicesCount is not set")
+	}
+	defer s.cleanUp(t)
+
+	t.Logf("Testing GetServices with %d services ...", count)
+	startTime := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+	expected := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		service := fmt.Sprintf("many-services-%05d", i)
+		expected = append(expected, service)
+		span := &model.Span{
+			TraceID:       model.NewTraceID(0, uint64(i+1)),
+			SpanID:        model.NewSpanID(uint64(i + 1)),
+			OperationName: "many-services-operation",
+			StartTime:     startTime,
+			Duration:      time.Millisecond,
+			Process:       model.NewProcess(service, model.KeyValues{}),
+		}
+		require.NoError(t, s.SpanWriter.WriteSpan(context.Background(), span))
+	}
+
+	var actual []string
+	found := s.waitForCondition(t, func(t *testing.T) bool {
+		var err error
+		services, err := s.SpanReader.GetServices(context.Background())
+		require.NoError(t, err)
+		// Some backends cache service names, so services written by
+		// earlier tests may still be reported after a purge.
+		actual = actual[:0]
+		for _, service := range services {
+			if strings.HasPrefix(service, "many-services-") {
+				actual = append(actual, service)
+			}
+		}
+		sort.Strings(actual)
+		return assert.ObjectsAreEqualValues(expected, actual)
+	})
+
+	if !assert.True(t, found) {
+		t.Logf("\t Expected %d services, actual %d", len(expected), len(actual))
+	}
+}
+
 func (s *StorageIntegration) testArchiveTrace(t *testing.T) {
 	s.skipIfNeeded(t)
 	if s.SkipArchiveTest {
@@ -280,7 +349,7 @@ func (s *StorageIntegration) testFindTraces(t *testing.T) {
 	defer s.cleanUp(t)
 
 	// Note: all cases include ServiceName + StartTime range
-	s.Fixtures = append(s.Fixtures, LoadAndParseQueryTestCases(t, "fixtures/queries.json")...)
+	s.Fixtures = append(s.Fixtures, s.LoadQueryFixtures(t, "fixtures/queries.json")...)
 
 	// Each query test case only specifies matching traces, but does not provide counterexamples.
 	// To improve coverage we get all possible traces and store all of them before running queries.
@@ -361,7 +430,7 @@ func (s *StorageIntegration) loadParseAndWriteLargeTrace(t *testing.T) *model.Tr
 
 func (s *StorageIntegration) getTraceFixture(t *testing.T, fixture string) *model.Trace {
 	fileName := fmt.Sprintf("fixtures/traces/%s.json", fixture)
-	trace := getTraceFixtureExact(t, fileName)
+	trace := getTraceFixtureExact(t, fileName, s.timeReference())
 
 	if s.SkipBinaryAttrs {
 		t.Logf("Dropped binary type attributes from trace ID: %s", trace.Spans[0].TraceID.String())
@@ -396,39 +465,55 @@ func (s *StorageIntegration) dropBinaryTags(_ *testing.T, tags []model.KeyValue)
 	return newTags
 }
 
-func getTraceFixtureExact(t *testing.T, fileName string) *model.Trace {
+// timeReference returns TimeReference, setting it to the current time if it is unset.
+func (s *StorageIntegration) timeReference() time.Time {
+	if s.TimeReference.IsZero() {
+		s.TimeReference = time.Now()
+	}
+	return s.TimeReference
+}
+
+func getTraceFixtureExact(t *testing.T, fileName string, reference time.Time) *model.Trace {
 	var trace model.Trace
-	loadAndParseJSONPB(t, fileName, &trace)
+	loadAndParseJSONPB(t, fileName, &trace, reference)
 	return &trace
 }
 
-func loadAndParseJSONPB(t *testing.T, path string, object proto.Message) {
+func loadAndParseJSONPB(t *testing.T, path string, object proto.Message, reference time.Time) {
 	// #nosec
 	inStr, err := fixtures.ReadFile(path)
 	require.NoError(t, err, "Not expecting error when loading fixture %s", path)
-	err = jsonpb.Unmarshal(bytes.NewReader(correctTime(inStr)), object)
+	err = jsonpb.Unmarshal(bytes.NewReader(correctTime(inStr, reference)), object)
 	require.NoError(t, err, "Not expecting error when unmarshaling fixture %s", path)
 }
 
-// LoadAndParseQueryTestCases loads and parses query test cases
+// LoadAndParseQueryTestCases loads and parses query test cases, with dates relative to the current time.
 func LoadAndParseQueryTestCases(t *testing.T, queriesFile string) []*QueryFixtures {
 	var queries []*QueryFixtures
-	loadAndParseJSON(t, queriesFile, &queries)
+	loadAndParseJSON(t, queriesFile, &queries, time.Now())
 	return queries
 }
 
-func loadAndParseJSON(t *testing.T, path string, object interface{}) {
+// LoadQueryFixtures loads and parses query test cases, with dates relative to TimeReference.
+func (s *StorageIntegration) LoadQueryFixtures(t *testing.T, queriesFile string) []*QueryFixtures {
+	var queries []*QueryFixtures
+	loadAndParseJSON(t, queriesFile, &queries, s.timeReference())
+	return queries
+}
+
+func loadAndParseJSON(t *testing.T, path string, object interface{}, reference time.Time) {
 	// #nosec
 	inStr, err := fixtures.ReadFile(path)
 	require.NoError(t, err, "Not expecting error when loading fixture %s", path)
-	err = json.Unmarshal(correctTime(inStr), object)
+	err = json.Unmarshal(correctTime(inStr, reference), object)
 	require.NoError(t, err, "Not expecting error when unmarshaling fixture %s", path)
 }
 
-// required, because we want to only query on recent traces, so we replace all the dates with recent dates.
-func correctTime(json []byte) []byte {
+// required, because we want to only query on recent traces, so we replace all the dates
+// with the day before and two days before the reference time.
+func correctTime(json []byte, reference time.Time) []byte {
 	jsonString := string(json)
-	now := time.Now().UTC()
+	now := reference.UTC()
 	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
 	twoDaysAgo := now.AddDate(0, 0, -2).Format("2006-01-02")
 	retString := strings.ReplaceAll(jsonString, "2017-01-26", yesterday)
@@ -494,6 +579,85 @@ func (s *StorageIntegration) testGetDependencies(t *testing.T) {
 	}
 }
 
+// dependencySpan returns a span of service that is a child of parent, or a root span if parent is nil.
+func dependencySpan(traceID model.TraceID, spanID uint64, service string, parent *model.Span, startTime time.Time) *model.Span {
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        model.NewSpanID(spanID),
+		OperationName: "call",
+		Process:       model.NewProcess(service, nil),
+		StartTime:     startTime,
+		Duration:      time.Millisecond,
+	}
+	if parent != nil {
+		span.References = []model.SpanRef{model.NewChildOfRef(traceID, parent.SpanID)}
+	}
+	return span
+}
+
+func (s *StorageIntegration) testGetDependenciesFromSpans(t *testing.T) {
+	if s.DependencyReader == nil {
+		t.Skipf("Skipping GetDependenciesFromSpans test because dependency reader is nil")
+		return
+	}
+	if !s.DependenciesFromSpans && s.AggregateDependencies == nil {
+		t.Skipf("Skipping GetDependenciesFromSpans test because the backend does not compute dependency links from spans")
+		return
+	}
+
+	s.skipIfNeeded(t)
+	defer s.cleanUp(t)
+
+	const prefix = "deps-"
+	now := time.Now()
+	startTime := now.Add(-time.Minute)
+	traceID := model.NewTraceID(0, 0xde9)
+	frontend := dependencySpan(traceID, 1, prefix+"frontend", nil, startTime)
+	backend1 := dependencySpan(traceID, 2, prefix+"backend", frontend, startTime)
+	backend2 := dependencySpan(traceID, 3, prefix+"backend", frontend, startTime)
+	db := dependencySpan(traceID, 4, prefix+"db", backend1, startTime)
+	s.writeTrace(t, &model.Trace{Spans: []*model.Span{frontend, backend1, backend2, db}})
+
+	// this trace starts before the queried time window and must not contribute any links
+	oldTraceID := model.NewTraceID(0, 0xde8)
+	oldStartTime := now.Add(-2 * time.Hour)
+	oldParent := dependencySpan(oldTraceID, 1, prefix+"old-parent", nil, oldStartTime)
+	oldChild := dependencySpan(oldTraceID, 2, prefix+"old-child", oldParent, oldStartTime)
+	s.writeTrace(t, &model.Trace{Spans: []*model.Span{oldParent, oldChild}})
+
+	if s.AggregateDependencies != nil {
+		s.AggregateDependencies(t)
+	}
+
+	expected := []model.DependencyLink{
+		{Parent: prefix + "backend", Child: prefix + "db", CallCount: 1},
+		{Parent: prefix + "frontend", Child: prefix + "backend", CallCount: 2},
+	}
+	var actual []model.DependencyLink
+	found := s.waitForCondition(t, func(t *testing.T) bool {
+		links, err := s.DependencyReader.GetDependencies(context.Background(), now, time.Hour)
+		require.NoError(t, err)
+		actual = actual[:0]
+		for _, link := range links {
+			if !strings.HasPrefix(link.Parent, prefix) {
+				continue
+			}
+			// backends differ in whether they report the source of computed links
+			link.Source = ""
+			actual = append(actual, link)
+		}
+		sort.Slice(actual, func(i, j int) bool {
+			return actual[i].Parent < actual[j].Parent
+		})
+		return assert.ObjectsAreEqualValues(expected, actual)
+	})
+
+	if !assert.True(t, found) {
+		t.Log("\t Expected:", expected)
+		t.Log("\t Actual  :", actual)
+	}
+}
+
 // === Sampling Store Integration Tests ===
 
 func (s *StorageIntegration) testGetThroughput(t *testing.T) {
@@ -557,6 +721,7 @@ func (s *StorageIntegration) RunAll(t *testing.T) {
 	s.RunSpanStoreTests(t)
 	t.Run("ArchiveTrace", s.testArchiveTrace)
 	t.Run("GetDependencies", s.testGetDependencies)
+	t.Run("GetDependenciesFromSpans", s.testGetDependenciesFromSpans)
 	t.Run("GetThroughput", s.testGetThroughput)
 	t.Run("GetLatestProbability", s.testGetLatestProbability)
 }
@@ -564,6 +729,7 @@ func (s *StorageIntegration) RunAll(t *testing.T) {
 // RunTestSpanstore runs only span related integration tests
 func (s *StorageIntegration) RunSpanStoreTests(t *testing.T) {
 	t.Run("GetServices", s.testGetServices)
+	t.Run("GetManyServices", s.testGetManyServices)
 	t.Run("GetOperations", s.testGetOperations)
 	t.Run("GetTrace", s.testGetTrace)
 	t.Run("GetLargeSpans", s.testGetLargeSpan)
@@ -39,6 +39,9 @@ func (s *MemStorageIntegrationTestSuite) initialize(_ *testing.T) {
 	s.SpanWriter = store
 	s.ArchiveSpanReader = archiveStore
 	s.ArchiveSpanWriter = archiveStore
+	s.DependencyReader = store
+	s.DependenciesFromSpans = true
+	s.ManyServicesCount = 5000
 
 	// TODO DependencyWriter is not implemented in memory store
 
@@ -16,11 +16,14 @@
 package memory
 
 import (
+	"context"
 	"flag"
+	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/pkg/distributedlock"
 	"github.com/jaegertracing/jaeger/pkg/memory/config"
 	"github.com/jaegertracing/jaeger/pkg/metrics"
@@ -35,6 +38,15 @@ var ( // interface comformance checks
 	_ storage.Factory              = (*Factory)(nil)
 	_ storage.ArchiveFactory       = (*Factory)(nil)
 	_ storage.SamplingStoreFactory = (*Factory)(nil)
+	_ storage.Purger               = (*Factory)(nil)
+	_ storage.StatsPurger          = (*Factory)(nil)
+	_ storage.RangePurger          = (*Factory)(nil)
+	_ storage.ServicePurger        = (*Factory)(nil)
+	_ storage.ServiceRangePurger   = (*Factory)(nil)
+	_ storage.TracePurger          = (*Factory)(nil)
+	_ storage.TenantPurger         = (*Factory)(nil)
+	_ storage.AttributePurger      = (*Factory)(nil)
+	_ storage.Counter              = (*Factory)(nil)
 	_ plugin.Configurable          = (*Factory)(nil)
 )
 
@@ -123,6 +135,101 @@ func (f *Factory) CreateLock() (distributedlock.Lock, error) {
 	return &lock{}, nil
 }
 
+// Purge removes all data from the Factory's underlying in-memory store.
+// This function is intended for testing purposes only and should not be used in production environments.
+func (f *Factory) Purge(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.store.purge()
+	return nil
+}
+
+// PurgeWithStats implements storage.StatsPurger
+func (f *Factory) PurgeWithStats(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.store.purgeWithStats(), nil
+}
+
+// PurgeRange implements storage.RangePurger
+func (f *Factory) PurgeRange(_ context.Context, start, end time.Time) error {
+	f.store.purgeSpans(func(span *model.Span) bool {
+		return startsWithin(span, start, end)
+	})
+	return nil
+}
+
+// PurgeServiceRange implements storage.ServiceRangePurger
+func (f *Factory) PurgeServiceRange(_ context.Context, service string, start, end time.Time) error {
+	f.store.purgeSpans(func(span *model.Span) bool {
+		return span.Process.ServiceName == service && startsWithin(span, start, end)
+	})
+	return nil
+}
+
+// startsWithin reports whether the span starts within [start, end], where a zero
+// start or end leaves that side of the range unbounded.
+func startsWithin(span *model.Span, start, end time.Time) bool {
+	if !start.IsZero() && span.StartTime.Before(start) {
+		return false
+	}
+	if !end.IsZero() && span.StartTime.After(end) {
+		return false
+	}
+	return true
+}
+
+// PurgeService implements storage.ServicePurger
+func (f *Factory) PurgeService(_ context.Context, service string) error {
+	f.store.purgeSpans(func(span *model.Span) bool {
+		return span.Process.ServiceName == service
+	})
+	return nil
+}
+
+// PurgeTrace implements storage.TracePurger
+func (f *Factory) PurgeTrace(_ context.Context, traceID model.TraceID) error {
+	purged := f.store.purgeSpans(func(span *model.Span) bool {
+		return span.TraceID == traceID
+	})
+	if purged == 0 {
+		return spanstore.ErrTraceNotFound
+	}
+	return nil
+}
+
+// PurgeByAttribute implements storage.AttributePurger
+func (f *Factory) PurgeByAttribute(_ context.Context, key, value string) error {
+	f.store.purgeSpans(func(span *model.Span) bool {
+		return hasTag(span.Tags, key, value) || hasTag(span.Process.Tags, key, value)
+	})
+	return nil
+}
+
+// hasTag reports whether tags contain key with the given value, compared as a string.
+func hasTag(tags model.KeyValues, key, value string) bool {
+	tag, ok := tags.FindByKey(key)
+	return ok && tag.AsString() == value
+}
+
+// PurgeTenant implements storage.TenantPurger
+func (f *Factory) PurgeTenant(_ context.Context, tenant string) error {
+	f.store.purgeTenant(tenant)
+	return nil
+}
+
+// Tenants implements storage.TenantPurger
+func (f *Factory) Tenants(context.Context) ([]string, error) {
+	return f.store.tenants(), nil
+}
+
+// CountTraces implements storage.Counter
+func (f *Factory) CountTraces(context.Context) (int64, error) {
+	return f.store.countTraces(), nil
+}
+
 func (f *Factory) publishOpts() {
 	internalFactory := f.metricsFactory.Namespace(metrics.NSOptions{Name: "internal"})
 	internalFactory.Gauge(metrics.Options{Name: limit}).
@@ -16,6 +16,9 @@
 package memory
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,9 +28,12 @@ import (
 
 	"github.com/jaegertracing/jaeger/internal/metrics/fork"
 	"github.com/jaegertracing/jaeger/internal/metricstest"
+	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/pkg/config"
 	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/pkg/tenancy"
 	"github.com/jaegertracing/jaeger/storage"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
 )
 
 var _ storage.Factory = new(Factory)
@@ -86,3 +92,343 @@ func TestPublishOpts(t *testing.T) {
 		Value: f.options.Configuration.MaxTraces,
 	})
 }
+
+func TestPurge(t *testing.T) {
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	require.NoError(t, f.store.WriteSpan(context.Background(), testingSpan))
+
+	require.NoError(t, f.Purge(context.Background()))
+
+	_, err := f.store.GetTrace(context.Background(), testingSpan.TraceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	services, err := f.store.GetServices(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestPurgeWithStats(t *testing.T) {
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	for i := uint64(1); i <= 3; i++ {
+		require.NoError(t, f.store.WriteSpan(context.Background(), &model.Span{
+			TraceID: model.NewTraceID(1, i%2),
+			SpanID:  model.NewSpanID(i),
+			Process: &model.Process{ServiceName: "service"},
+		}))
+	}
+
+	deleted, err := f.PurgeWithStats(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, deleted)
+	services, err := f.store.GetServices(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, services)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = f.PurgeWithStats(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPurgeConcurrentWithReads(t *testing.T) {
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	ctx := context.Background()
+	const writers, spans = 4, 200
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < spans; j++ {
+				span := makeTestingSpan(model.NewTraceID(uint64(i+1), uint64(j+1)), fmt.Sprintf("-%d", i))
+				assert.NoError(t, f.store.WriteSpan(ctx, span))
+				_, err := f.store.GetTrace(ctx, span.TraceID)
+				// the trace may be purged right after being written
+				if err != nil {
+					assert.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+				}
+				_, err = f.store.GetServices(ctx)
+				assert.NoError(t, err)
+				_, err = f.store.FindTraces(ctx, &spanstore.TraceQueryParameters{ServiceName: span.Process.ServiceName, NumTraces: 10})
+				assert.NoError(t, err)
+				_, err = f.CountTraces(ctx)
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	purges := 0
+	for running := true; running; purges++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		require.NoError(t, f.Purge(ctx))
+	}
+	assert.Greater(t, purges, 1)
+
+	// the last purge ran after all writes
+	services, err := f.store.GetServices(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, services)
+	count, err := f.CountTraces(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestPurgeRange(t *testing.T) {
+	oldSpan := makeTestingSpan(model.NewTraceID(1, 1), "old")
+	oldSpan.StartTime = time.Unix(100, 0)
+	newSpan := makeTestingSpan(model.NewTraceID(2, 2), "new")
+	newSpan.StartTime = time.Unix(500, 0)
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		purged     []*model.Span
+		kept       []*model.Span
+	}{
+		{
+			name:   "bounded range",
+			start:  time.Unix(50, 0),
+			end:    time.Unix(200, 0),
+			purged: []*model.Span{oldSpan},
+			kept:   []*model.Span{newSpan},
+		},
+		{
+			name:   "unbounded start",
+			end:    time.Unix(200, 0),
+			purged: []*model.Span{oldSpan},
+			kept:   []*model.Span{newSpan},
+		},
+		{
+			name:   "unbounded end",
+			start:  time.Unix(200, 0),
+			purged: []*model.Span{newSpan},
+			kept:   []*model.Span{oldSpan},
+		},
+		{
+			name:   "unbounded range",
+			purged: []*model.Span{oldSpan, newSpan},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFactory()
+			require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+			require.NoError(t, f.store.WriteSpan(context.Background(), oldSpan))
+			require.NoError(t, f.store.WriteSpan(context.Background(), newSpan))
+
+			require.NoError(t, f.PurgeRange(context.Background(), test.start, test.end))
+
+			for _, span := range test.purged {
+				_, err := f.store.GetTrace(context.Background(), span.TraceID)
+				require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+			}
+			var services []string
+			for _, span := range test.kept {
+				trace, err := f.store.GetTrace(context.Background(), span.TraceID)
+				require.NoError(t, err)
+				assert.Len(t, trace.Spans, 1)
+				services = append(services, span.Process.ServiceName)
+			}
+			actual, err := f.store.GetServices(context.Background())
+			require.NoError(t, err)
+			assert.ElementsMatch(t, services, actual)
+		})
+	}
+}
+
+func TestPurgeServiceRange(t *testing.T) {
+	fooOld := makeTestingSpan(model.NewTraceID(1, 1), "foo")
+	fooOld.StartTime = time.Unix(100, 0)
+	fooNew := makeTestingSpan(model.NewTraceID(2, 2), "foo")
+	fooNew.StartTime = time.Unix(300, 0)
+	barOld := makeTestingSpan(model.NewTraceID(3, 3), "bar")
+	barOld.StartTime = time.Unix(100, 0)
+
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	for _, span := range []*model.Span{fooOld, fooNew, barOld} {
+		require.NoError(t, f.store.WriteSpan(context.Background(), span))
+	}
+
+	require.NoError(t, f.PurgeServiceRange(context.Background(), fooOld.Process.ServiceName, time.Time{}, time.Unix(200, 0)))
+
+	_, err := f.store.GetTrace(context.Background(), fooOld.TraceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	for _, span := range []*model.Span{fooNew, barOld} {
+		_, err := f.store.GetTrace(context.Background(), span.TraceID)
+		require.NoError(t, err)
+	}
+}
+
+func TestCountTraces(t *testing.T) {
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	count, err := f.CountTraces(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	require.NoError(t, f.store.WriteSpan(context.Background(), makeTestingSpan(model.NewTraceID(1, 1), "foo")))
+	require.NoError(t, f.store.WriteSpan(context.Background(), makeTestingSpan(model.NewTraceID(1, 1), "bar")))
+	tenantCtx := tenancy.WithTenant(context.Background(), "acme")
+	require.NoError(t, f.store.WriteSpan(tenantCtx, makeTestingSpan(model.NewTraceID(2, 2), "foo")))
+	count, err = f.CountTraces(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestPurgeTenant(t *testing.T) {
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	acmeCtx := tenancy.WithTenant(context.Background(), "acme")
+	globexCtx := tenancy.WithTenant(context.Background(), "globex")
+	require.NoError(t, f.store.WriteSpan(context.Background(), makeTestingSpan(model.NewTraceID(1, 1), "foo")))
+	require.NoError(t, f.store.WriteSpan(acmeCtx, makeTestingSpan(model.NewTraceID(2, 2), "foo")))
+	require.NoError(t, f.store.WriteSpan(globexCtx, makeTestingSpan(model.NewTraceID(3, 3), "foo")))
+
+	tenants, err := f.Tenants(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "acme", "globex"}, tenants)
+
+	require.NoError(t, f.PurgeTenant(context.Background(), "acme"))
+	tenants, err = f.Tenants(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "globex"}, tenants)
+
+	_, err = f.store.GetTrace(acmeCtx, model.NewTraceID(2, 2))
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	_, err = f.store.GetTrace(globexCtx, model.NewTraceID(3, 3))
+	require.NoError(t, err)
+	_, err = f.store.GetTrace(context.Background(), model.NewTraceID(1, 1))
+	require.NoError(t, err)
+}
+
+func TestPurgeTrace(t *testing.T) {
+	f := NewFactory()
+	require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+	acmeCtx := tenancy.WithTenant(context.Background(), "acme")
+	fooSpan := makeTestingSpan(model.NewTraceID(1, 1), "foo")
+	barSpan := makeTestingSpan(model.NewTraceID(2, 2), "bar")
+	require.NoError(t, f.store.WriteSpan(context.Background(), fooSpan))
+	require.NoError(t, f.store.WriteSpan(acmeCtx, fooSpan))
+	require.NoError(t, f.store.WriteSpan(context.Background(), barSpan))
+
+	// the trace is removed from all tenants
+	require.NoError(t, f.PurgeTrace(context.Background(), fooSpan.TraceID))
+	_, err := f.store.GetTrace(context.Background(), fooSpan.TraceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	_, err = f.store.GetTrace(acmeCtx, fooSpan.TraceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	_, err = f.store.GetTrace(context.Background(), barSpan.TraceID)
+	require.NoError(t, err)
+	services, err := f.store.GetServices(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{barSpan.Process.ServiceName}, services)
+
+	err = f.PurgeTrace(context.Background(), fooSpan.TraceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+}
+
+func TestPurgeService(t *testing.T) {
+	fooSpan := makeTestingSpan(model.NewTraceID(1, 1), "foo")
+	barSpan := makeTestingSpan(model.NewTraceID(2, 2), "bar")
+
+	tests := []struct {
+		name    string
+		service string
+		kept    []string
+	}{
+		{
+			name:    "present service",
+			service: fooSpan.Process.ServiceName,
+			kept:    []string{barSpan.Process.ServiceName},
+		},
+		{
+			name:    "absent service",
+			service: "baz",
+			kept:    []string{fooSpan.Process.ServiceName, barSpan.Process.ServiceName},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFactory()
+			require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+			require.NoError(t, f.store.WriteSpan(context.Background(), fooSpan))
+			require.NoError(t, f.store.WriteSpan(context.Background(), barSpan))
+
+			require.NoError(t, f.PurgeService(context.Background(), test.service))
+
+			services, err := f.store.GetServices(context.Background())
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.kept, services)
+		})
+	}
+}
+
+func TestPurgeByAttribute(t *testing.T) {
+	// spans of two concurrent test runs, and one without run
+	runSpan := makeTestingSpan(model.NewTraceID(1, 1), "run")
+	runSpan.Tags = append(runSpan.Tags, model.String("test.run", "abc123"))
+	processSpan := makeTestingSpan(model.NewTraceID(2, 2), "process")
+	processSpan.Process.Tags = []model.KeyValue{model.String("test.run", "abc123")}
+	otherRunSpan := makeTestingSpan(model.NewTraceID(3, 3), "other")
+	otherRunSpan.Tags = append(otherRunSpan.Tags, model.String("test.run", "def456"))
+	untaggedSpan := makeTestingSpan(model.NewTraceID(4, 4), "untagged")
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		kept  []string
+	}{
+		{
+			name:  "matching spans",
+			key:   "test.run",
+			value: "abc123",
+			kept:  []string{otherRunSpan.Process.ServiceName, untaggedSpan.Process.ServiceName},
+		},
+		{
+			name:  "no matching value",
+			key:   "test.run",
+			value: "xyz789",
+			kept: []string{
+				runSpan.Process.ServiceName, processSpan.Process.ServiceName,
+				otherRunSpan.Process.ServiceName, untaggedSpan.Process.ServiceName,
+			},
+		},
+		{
+			name:  "no matching key",
+			key:   "test.id",
+			value: "abc123",
+			kept: []string{
+				runSpan.Process.ServiceName, processSpan.Process.ServiceName,
+				otherRunSpan.Process.ServiceName, untaggedSpan.Process.ServiceName,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFactory()
+			require.NoError(t, f.Initialize(metrics.NullFactory, zap.NewNop()))
+			for _, span := range []*model.Span{runSpan, processSpan, otherRunSpan, untaggedSpan} {
+				require.NoError(t, f.store.WriteSpan(context.Background(), span))
+			}
+
+			require.NoError(t, f.PurgeByAttribute(context.Background(), test.key, test.value))
+
+			services, err := f.store.GetServices(context.Background())
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.kept, services)
+		})
+	}
+}
@@ -155,21 +155,7 @@ func (st *Store) WriteSpan(ctx context.Context, span *model.Span) error {
 	m := st.getTenant(tenancy.GetTenant(ctx))
 	m.Lock()
 	defer m.Unlock()
-	if _, ok := m.operations[span.Process.ServiceName]; !ok {
-		m.operations[span.Process.ServiceName] = map[spanstore.Operation]struct{}{}
-	}
-
-	spanKind, _ := span.GetSpanKind()
-	operation := spanstore.Operation{
-		Name:     span.OperationName,
-		SpanKind: spanKind.String(),
-	}
-
-	if _, ok := m.operations[span.Process.ServiceName][operation]; !ok {
-		m.operations[span.Process.ServiceName][operation] = struct{}{}
-	}
-
-	m.services[span.Process.ServiceName] = struct{}{}
+	m.indexSpan(span)
 	if _, ok := m.traces[span.TraceID]; !ok {
 		m.traces[span.TraceID] = &model.Trace{}
 
@@ -194,6 +180,154 @@ func (st *Store) WriteSpan(ctx context.Context, span *model.Span) error {
 	return nil
 }
 
+// indexSpan records the service and operation of the given span.
+// The caller must hold the tenant's write lock.
+func (m *Tenant) indexSpan(span *model.Span) {
+	if _, ok := m.operations[span.Process.ServiceName]; !ok {
+		m.operations[span.Process.ServiceName] = map[spanstore.Operation]struct{}{}
+	}
+
+	spanKind, _ := span.GetSpanKind()
+	operation := spanstore.Operation{
+		Name:     span.OperationName,
+		SpanKind: spanKind.String(),
+	}
+
+	if _, ok := m.operations[span.Process.ServiceName][operation]; !ok {
+		m.operations[span.Process.ServiceName][operation] = struct{}{}
+	}
+
+	m.services[span.Process.ServiceName] = struct{}{}
+}
+
+// purgeSpans removes the spans matching the given predicate, dropping traces
+// that become empty and rebuilding the service and operation indices.
+// It returns the number of removed spans.
+func (m *Tenant) purgeSpans(match func(span *model.Span) bool) int {
+	m.Lock()
+	defer m.Unlock()
+	purged := 0
+	for traceID, trace := range m.traces {
+		spans := trace.Spans[:0]
+		for _, span := range trace.Spans {
+			if match(span) {
+				purged++
+			} else {
+				spans = append(spans, span)
+			}
+		}
+		if len(spans) == 0 {
+			delete(m.traces, traceID)
+			continue
+		}
+		trace.Spans = spans
+	}
+	if m.config.MaxTraces > 0 {
+		m.compactIDs()
+	}
+	m.services = map[string]struct{}{}
+	m.operations = map[string]map[spanstore.Operation]struct{}{}
+	for _, trace := range m.traces {
+		for _, span := range trace.Spans {
+			m.indexSpan(span)
+		}
+	}
+	return purged
+}
+
+// compactIDs rebuilds the eviction ring with the IDs of the remaining traces, oldest
+// first, so that the IDs of purged traces are not evicted again once rewritten.
+// The caller must hold the tenant's write lock.
+func (m *Tenant) compactIDs() {
+	ids := make([]*model.TraceID, m.config.MaxTraces)
+	n := 0
+	for i := 1; i <= m.config.MaxTraces; i++ {
+		id := m.ids[(m.index+i)%m.config.MaxTraces]
+		if id == nil {
+			continue
+		}
+		if _, ok := m.traces[*id]; ok {
+			ids[n] = id
+			n++
+		}
+	}
+	m.ids = ids
+	// the next trace is written after the remaining ones
+	m.index = n - 1
+}
+
+// purge removes all data for all tenants. It is safe to call concurrently with reads and
+// writes: those that already hold a tenant finish with it, and it is then unreachable.
+func (st *Store) purge() {
+	st.Lock()
+	defer st.Unlock()
+	st.perTenant = make(map[string]*Tenant)
+}
+
+// purgeWithStats removes all data like purge and returns the number of removed spans.
+func (st *Store) purgeWithStats() int64 {
+	st.Lock()
+	defer st.Unlock()
+	var deleted int64
+	for _, tenant := range st.perTenant {
+		tenant.RLock()
+		for _, trace := range tenant.traces {
+			deleted += int64(len(trace.Spans))
+		}
+		tenant.RUnlock()
+	}
+	st.perTenant = make(map[string]*Tenant)
+	return deleted
+}
+
+// purgeSpans removes the spans matching the given predicate for all tenants
+// and returns the number of removed spans.
+func (st *Store) purgeSpans(match func(span *model.Span) bool) int {
+	st.RLock()
+	tenants := make([]*Tenant, 0, len(st.perTenant))
+	for _, tenant := range st.perTenant {
+		tenants = append(tenants, tenant)
+	}
+	st.RUnlock()
+	purged := 0
+	for _, tenant := range tenants {
+		purged += tenant.purgeSpans(match)
+	}
+	return purged
+}
+
+// purgeTenant removes all data of the given tenant.
+func (st *Store) purgeTenant(tenantID string) {
+	st.Lock()
+	defer st.Unlock()
+	delete(st.perTenant, tenantID)
+}
+
+// tenants returns the sorted IDs of the tenants with data in the store.
+func (st *Store) tenants() []string {
+	st.RLock()
+	defer st.RUnlock()
+	tenants := make([]string, 0, len(st.perTenant))
+	for tenantID := range st.perTenant {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// countTraces returns the number of traces stored for all tenants.
+func (st *Store) countTraces() int64 {
+	st.RLock()
+	defer st.RUnlock()
+	var count int64
+	for _, tenant := range st.perTenant {
+		tenant.RLock()
+		count += int64(len(tenant.traces))
+		tenant.RUnlock()
+	}
+	return count
+}
+
 // GetTrace gets a trace
 func (st *Store) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
 	m := st.getTenant(tenancy.GetTenant(ctx))
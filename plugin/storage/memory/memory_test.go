@@ -197,6 +197,33 @@ func TestStoreWithLimit(t *testing.T) {
 	assert.Len(t, store.getTenant("").ids, maxTraces)
 }
 
+func TestStoreWithLimitAfterPurge(t *testing.T) {
+	store := WithConfiguration(config.Configuration{MaxTraces: 3})
+	write := func(id uint64) {
+		require.NoError(t, store.WriteSpan(context.Background(), &model.Span{
+			TraceID: model.NewTraceID(1, id),
+			Process: &model.Process{ServiceName: "TestStoreWithLimitAfterPurge"},
+		}))
+	}
+	for i := uint64(1); i <= 3; i++ {
+		write(i)
+	}
+	purged := store.purgeSpans(func(span *model.Span) bool {
+		return span.TraceID == model.NewTraceID(1, 1)
+	})
+	require.Equal(t, 1, purged)
+
+	// the purged trace is written again, then a new one evicts the oldest remaining trace
+	write(1)
+	write(4)
+	traces := store.getTenant("").traces
+	assert.Len(t, traces, 3)
+	assert.NotContains(t, traces, model.NewTraceID(1, 2))
+	for _, id := range []uint64{1, 3, 4} {
+		assert.Contains(t, traces, model.NewTraceID(1, id))
+	}
+}
+
 func TestStoreGetTraceSuccess(t *testing.T) {
 	withPopulatedMemoryStore(func(store *Store) {
 		trace, err := store.GetTrace(context.Background(), testingSpan.TraceID)
@@ -16,10 +16,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/pkg/distributedlock"
 	"github.com/jaegertracing/jaeger/pkg/metrics"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
@@ -52,10 +55,191 @@ type Factory interface {
 // Purger defines an interface that is capable of purging the storage.
 // Only meant to be used from integration tests.
 type Purger interface {
+	// Purge removes all data from the storage.
+	// Implementations should stop early and return ctx.Err() when ctx is cancelled.
+	Purge(ctx context.Context) error
+}
+
+// LegacyPurger is the context-less version of Purger.
+//
+// Deprecated: implement Purger instead. This interface is kept so that
+// existing implementations keep working while they are migrated.
+type LegacyPurger interface {
 	// Purge removes all data from the storage.
 	Purge() error
 }
 
+// GetPurger returns the Purger implemented by the factory, adapting a LegacyPurger if needed.
+func GetPurger(f any) (Purger, bool) {
+	switch p := f.(type) {
+	case Purger:
+		return p, true
+	case LegacyPurger:
+		return legacyPurger{p}, true
+	default:
+		return nil, false
+	}
+}
+
+// legacyPurger adapts a LegacyPurger to Purger. The context is only
+// checked before purging since the legacy implementation cannot observe it.
+type legacyPurger struct {
+	purger LegacyPurger
+}
+
+func (p legacyPurger) Purge(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.purger.Purge()
+}
+
+// RangePurger is an additional interface that can be implemented by a Purger
+// to support removing only the data within a time range.
+// Only meant to be used from integration tests.
+type RangePurger interface {
+	// PurgeRange removes all spans with a start time within [start, end].
+	// A zero start or end leaves that side of the range unbounded.
+	PurgeRange(ctx context.Context, start, end time.Time) error
+}
+
+// ServicePurger is an additional interface that can be implemented by a Purger
+// to support removing only the spans of a single service.
+// Only meant to be used from integration tests.
+type ServicePurger interface {
+	// PurgeService removes all spans of the given service.
+	PurgeService(ctx context.Context, service string) error
+}
+
+// ServiceRangePurger is an additional interface that can be implemented by a Purger
+// to support removing only the spans of a single service within a time range.
+// Only meant to be used from integration tests.
+type ServiceRangePurger interface {
+	// PurgeServiceRange removes all spans of the given service with a start time within [start, end].
+	// A zero start or end leaves that side of the range unbounded.
+	PurgeServiceRange(ctx context.Context, service string, start, end time.Time) error
+}
+
+// TracePurger is an additional interface that can be implemented by a factory
+// to support removing a single trace, e.g. to re-ingest it while debugging.
+// Only meant to be used from integration tests.
+type TracePurger interface {
+	// PurgeTrace removes all spans of the given trace.
+	// It returns spanstore.ErrTraceNotFound when the storage has no such trace.
+	PurgeTrace(ctx context.Context, traceID model.TraceID) error
+}
+
+// PatternPurger is an additional interface that can be implemented by a factory
+// to support removing the indices or keyspaces matching a glob pattern, e.g. the
+// timestamped ones created by a test such as "jaeger-span-2024-06-*".
+// Only meant to be used from integration tests.
+type PatternPurger interface {
+	// PurgePattern removes the data stored under the names matching the glob pattern.
+	PurgePattern(ctx context.Context, pattern string) error
+}
+
+// AttributePurger is an additional interface that can be implemented by a factory
+// to support removing the spans with a given attribute, e.g. the ID of the test run
+// that wrote them, so that concurrent test runs do not delete each other's data.
+// Only meant to be used from integration tests.
+type AttributePurger interface {
+	// PurgeByAttribute removes all spans with a span or process tag key whose value is value.
+	PurgeByAttribute(ctx context.Context, key, value string) error
+}
+
+// BatchPurger is an additional interface that can be implemented by a factory
+// to support removing all data in bounded batches, so that purging a large
+// backend does not overwhelm it with a single delete-all request.
+// Only meant to be used from integration tests.
+type BatchPurger interface {
+	// PurgeBatched removes all data from the storage, deleting at most batchSize spans
+	// per request, and returns the number of batches once everything is deleted.
+	PurgeBatched(ctx context.Context, batchSize int) (batches int, err error)
+}
+
+// ExpiredPurger is an additional interface that can be implemented by a factory
+// of a storage with a retention period to support removing only the data that
+// outlived it, e.g. when the backend does not remove expired data by itself.
+// Only meant to be used from integration tests.
+type ExpiredPurger interface {
+	// PurgeExpired removes the data older than the TTL of the storage, keeping the rest.
+	PurgeExpired(ctx context.Context) error
+}
+
+// TTLReporter is an additional interface that can be implemented by a factory
+// to expose the retention period configured for the data of the storage.
+type TTLReporter interface {
+	// TTL returns how long the data is retained, zero when it never expires.
+	TTL() time.Duration
+}
+
+// TenantPurger is an additional interface that can be implemented by a factory
+// of a multi-tenant storage to support removing the data of a single tenant.
+// Only meant to be used from integration tests.
+type TenantPurger interface {
+	// PurgeTenant removes all data of the given tenant.
+	PurgeTenant(ctx context.Context, tenant string) error
+	// Tenants returns the tenants that have data in the storage.
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// SchemaInitializer is an additional interface that can be implemented by a factory
+// to recreate the schema of the storage, e.g. index templates, after it has been purged.
+// Only meant to be used from integration tests.
+type SchemaInitializer interface {
+	// InitializeSchema creates the schema of the storage if it does not exist.
+	InitializeSchema(ctx context.Context) error
+}
+
+// DependencyPurger is an additional interface that can be implemented by a factory
+// to support removing only the dependency links, leaving the spans intact.
+// Only meant to be used from integration tests.
+type DependencyPurger interface {
+	// PurgeDependencies removes all dependency links from the storage.
+	PurgeDependencies(ctx context.Context) error
+}
+
+// StatsPurger is an additional interface that can be implemented by a Purger
+// to report how much data was removed.
+// Only meant to be used from integration tests.
+type StatsPurger interface {
+	// PurgeWithStats removes all data from the storage and returns the number of deleted spans.
+	PurgeWithStats(ctx context.Context) (int64, error)
+}
+
+// PurgeProgress describes how far a purge in flight has come.
+type PurgeProgress struct {
+	// DeletedSpans is the number of spans deleted so far.
+	DeletedSpans int64
+	// TotalSpans is the number of spans to delete, zero when unknown.
+	TotalSpans int64
+}
+
+// ProgressReporter is an additional interface that can be implemented by a Purger
+// to report the progress of long-running purges.
+// Only meant to be used from integration tests.
+type ProgressReporter interface {
+	// PurgeProgress returns the progress of the purge in flight.
+	// It is called periodically, concurrently with Purge.
+	PurgeProgress() PurgeProgress
+}
+
+// Counter is an additional interface that can be implemented by a factory
+// to report how much data it holds, e.g. to purge the storage when it grows too large.
+// Only meant to be used from integration tests.
+type Counter interface {
+	// CountTraces returns the number of traces in the storage.
+	CountTraces(ctx context.Context) (int64, error)
+}
+
+// Pinger is an additional interface that can be implemented by a factory
+// to check that the storage backend is reachable without reading or writing data.
+// Only meant to be used from integration tests.
+type Pinger interface {
+	// Ping returns an error when the storage backend cannot be reached.
+	Ping(ctx context.Context) error
+}
+
 // SamplingStoreFactory defines an interface that is capable of returning the necessary backends for
 // adaptive sampling.
 type SamplingStoreFactory interface {
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 The Jaeger Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type legacyPurgerStub struct {
+	calls int
+}
+
+func (p *legacyPurgerStub) Purge() error {
+	p.calls++
+	return nil
+}
+
+type purgerStub struct {
+	ctx context.Context
+}
+
+func (p *purgerStub) Purge(ctx context.Context) error {
+	p.ctx = ctx
+	return nil
+}
+
+func TestGetPurger(t *testing.T) {
+	_, ok := GetPurger(struct{}{})
+	assert.False(t, ok)
+
+	stub := &purgerStub{}
+	purger, ok := GetPurger(stub)
+	require.True(t, ok)
+	assert.Same(t, stub, purger)
+
+	legacy := &legacyPurgerStub{}
+	purger, ok = GetPurger(legacy)
+	require.True(t, ok)
+	require.NoError(t, purger.Purge(context.Background()))
+	assert.Equal(t, 1, legacy.calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, purger.Purge(ctx), context.Canceled)
+	assert.Equal(t, 1, legacy.calls)
+}